@@ -2,14 +2,17 @@ package main
 
 import (
 	"flag"
-
+	"os"
 )
 
 type rsvpckConf struct {
 	textRender  	bool
 	tableRender 	bool
 	forceASCII 		bool
-	//speedtest  		bool
+	verbose			bool
+	speedtest  		bool
+	bandwidthPeer	string // host[:port] of a peer running rsvpck serve
+	configPath		string // YAML or JSON file replacing the embedded defaults
 	printVersion	bool
 }
 
@@ -35,17 +38,29 @@ func (r *rsvpckConf) SetRender(textRender bool) {
 	r.setTextRenderOff()
 }
 
-func parseFlagsToConfig() *rsvpckConf {
-	txtRender := flag.Bool("text", false, "render connectivity info as text. Default table")
-	flagForceASCII := flag.Bool("ascii", false, "Force ASCII-only output (no Unicode symbols)")
-	//speedtestFlag := flag.Bool("speedtest", false, "Run optional speedtest")
-	printVersion := flag.Bool("version", false, "Print version")
-	flag.Parse()
+// parseFlagsToConfig reads the command line without the program name. A bad
+// or unknown flag is an error for main to exit with domain.ExitUsage on; -h
+// returns flag.ErrHelp once the usage is printed.
+func parseFlagsToConfig(args []string) (*rsvpckConf, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	txtRender := fs.Bool("text", false, "render connectivity info as text. Default table")
+	flagForceASCII := fs.Bool("ascii", false, "Force ASCII-only output (no Unicode symbols)")
+	verbose := fs.Bool("verbose", false, "Show probe details such as DNS answers")
+	speedtestFlag := fs.Bool("speedtest", false, "Run the throughput tests of the speedtest endpoints instead of the connectivity checks")
+	bandwidthPeer := fs.String("bandwidth", "", "Measure throughput, RTT and jitter to a peer running rsvpck serve (host[:port])")
+	configPath := fs.String("config", "", "Load endpoints from this YAML or JSON file instead of the embedded defaults")
+	printVersion := fs.Bool("version", false, "Print version")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
 	r := NewRsvpckConf()
 	r.SetRender(*txtRender)
 	r.forceASCII = *flagForceASCII
-	//r.speedtest = *speedtestFlag
+	r.verbose = *verbose
+	r.speedtest = *speedtestFlag
+	r.bandwidthPeer = *bandwidthPeer
+	r.configPath = *configPath
 	r.printVersion = *printVersion
-	return &r
+	return &r, nil
 }
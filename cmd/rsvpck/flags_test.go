@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestParseFlagsToConfig(t *testing.T) {
+	conf, err := parseFlagsToConfig([]string{"--text", "--config", "site.yaml", "--bandwidth", "relay:5201"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !conf.textRender || conf.tableRender || conf.configPath != "site.yaml" || conf.bandwidthPeer != "relay:5201" {
+		t.Fatalf("flags not applied: %+v", *conf)
+	}
+
+	// the usage goes to stderr; keep the test output clean
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = devNull
+	t.Cleanup(func() { os.Stderr = stderr; devNull.Close() })
+
+	if _, err := parseFlagsToConfig([]string{"--no-such-flag"}); err == nil || errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("want an unknown flag returned as an error for ExitUsage, got %v", err)
+	}
+	if _, err := parseFlagsToConfig([]string{"--bandwidth"}); err == nil {
+		t.Fatal("want a flag missing its value returned as an error")
+	}
+	if _, err := parseFlagsToConfig([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("want -h to return flag.ErrHelp, got %v", err)
+	}
+}
@@ -5,19 +5,21 @@ import (
 	"github.com/azargarov/rsvpck/internal/adapters/dns"
 	"github.com/azargarov/rsvpck/internal/adapters/hostinfo"
 	"github.com/azargarov/rsvpck/internal/adapters/http"
-	"github.com/azargarov/rsvpck/internal/adapters/httpx"
 	"github.com/azargarov/rsvpck/internal/adapters/icmp"
+	"github.com/azargarov/rsvpck/internal/adapters/pac"
 	"github.com/azargarov/rsvpck/internal/adapters/render/text"
+	"github.com/azargarov/rsvpck/internal/adapters/sysproxy"
 	"github.com/azargarov/rsvpck/internal/adapters/tcp"
 	"github.com/azargarov/rsvpck/internal/app"
 	"github.com/azargarov/rsvpck/internal/config"
 	"github.com/azargarov/rsvpck/internal/domain"
 	"github.com/azargarov/rsvpck/internal/version"
     "github.com/mattn/go-isatty"
-	//"github.com/azargarov/rsvpck/internal/adapters/speedtest"
 
 	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -33,8 +35,17 @@ const (
 )
 
 func main() {
-	
-	rsvpConf := parseFlagsToConfig()
+	if len(os.Args) > 1 && os.Args[1] == serveCommand {
+		os.Exit(runServe(os.Args[2:]))
+	}
+
+	rsvpConf, err := parseFlagsToConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(domain.ExitUsage)
+	}
 	if rsvpConf.printVersion{
 		fmt.Printf("%s, version %s\n", applicationName, version.String())
 		return
@@ -44,32 +55,53 @@ func main() {
 	
 
 	var renderer domain.Renderer
-	renderConf := text.NewRenderConfig(text.WithForceASCII(rsvpConf.forceASCII))
+	renderConf := text.NewRenderConfig(
+		text.WithForceASCII(rsvpConf.forceASCII),
+		text.WithVerbose(rsvpConf.verbose),
+	)
 	
-	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), totalTimeout)
 	defer cancel()
 
-	//if rsvpConf.speedtest{
-	//	res :=runSpeedTest(ctx)
-	//	if res != nil{
-	//		fmt.Println(res.String())
-	//	}
-	//	return
-	//}
-
-	testConfig, err := config.LoadEmbedded()
+	testConfig, err := config.LoadFromFileOrEmbedded(rsvpConf.configPath)
 	if err != nil {
-		fmt.Printf("Invalid config: %v", err)
-		return
+		fmt.Printf("Invalid config: %v\n", err)
+		os.Exit(domain.ExitUsage)
 	}
 	
+	testConfig.EnvProxy = sysproxy.FromEnvironment()
+
 	tcpChecker := &tcp.Checker{}
 	dnsChecker := &dns.Checker{}
 	httpChecker := &http.Checker{}
 	icmpChecker := &icmp.Checker{}
 
-	prober := app.NewCompositeProber(tcpChecker,dnsChecker, httpChecker, icmpChecker)
+	prober := app.NewCompositeProber(tcpChecker,dnsChecker, httpChecker, icmpChecker).
+		WithPAC(pac.NewResolver()).
+		WithSystemProxy(sysproxy.NewResolver(testConfig.EnvProxy))
+
+	if rsvpConf.bandwidthPeer != "" {
+		ep, err := domain.NewBandwidthEndpoint(rsvpConf.bandwidthPeer, domain.EndpointTypePublic, "bandwidth to "+rsvpConf.bandwidthPeer)
+		if err != nil {
+			fmt.Printf("Invalid bandwidth peer: %v\n", err)
+			os.Exit(domain.ExitUsage)
+		}
+		code := runSpeedTest(ctx, prober, []domain.Endpoint{ep}, renderConf)
+		waitForEnterOnWindows()
+		os.Exit(code)
+	}
+	if rsvpConf.speedtest {
+		if len(testConfig.SpeedtestEndpoints) == 0 {
+			// no default: a public speed test server is not ours to load
+			fmt.Println("--speedtest needs speedtestEndpoints in a --config file, pointing at a throughput server you host (or use --bandwidth host)")
+			waitForEnterOnWindows()
+			os.Exit(domain.ExitUsage)
+		}
+		code := runSpeedTest(ctx, prober, testConfig.SpeedtestEndpoints, renderConf)
+		waitForEnterOnWindows()
+		os.Exit(code)
+	}
+
 	stopSpinner := startAnimatedSpinner(os.Stdout, ctx, 120 * time.Millisecond)
 	executor := app.NewExecutor(prober, domain.PolicyExhaustive)
 	result := executor.Run(ctx, testConfig)
@@ -80,12 +112,6 @@ func main() {
 		autostrCfg := autostr.Config{Separator: autostr.Ptr("\n"), FieldValueSeparator: autostr.Ptr(" : "), PrettyPrint: true}
 
 		text.PrintBlock(os.Stdout, "SYSTEM INFORMATION", autostr.String(h, autostrCfg), renderConf)
-		h.TLSCert, err = httpx.GetCertificatesSmart(ctx, "insite-eu.gehealthcare.com:443", "insite-eu.gehealthcare.com", testConfig.VPNIPs)
-		if err == nil {
-			text.PrintList(os.Stdout, "TLS certificates, eu-insite.gehealthcare.com\n", h.TLSCert, renderConf)
-		} else {
-			fmt.Println("Failed fetching certificates")
-		}
 	}
 
 
@@ -101,6 +127,8 @@ func main() {
 		}
 	}
 	waitForEnterOnWindows()
+	cancel()
+	os.Exit(result.ExitCode())
 }
 
 func startAnimatedSpinner(w io.Writer, parent context.Context, interval time.Duration) (stop func()) {
@@ -158,16 +186,16 @@ func waitForEnterOnWindows() {
 	}
 }
 
-//func runSpeedTest(ctx context.Context) *speedtest.SpeedtestResult{
-//	fmt.Println("Test Network Speed")
-//	spTest := speedtest.SpeedtestChecker{}
-//	result, err :=spTest.Run(ctx)
-//	if err != nil{
-//		return nil
-//	}
-//
-//	return result
-//}
+// runSpeedTest renders the transfers and returns the exit code of their
+// outcome.
+func runSpeedTest(ctx context.Context, prober app.PortProber, endpoints []domain.Endpoint, renderConf *text.RenderConfig) int {
+	fmt.Println("Test Network Speed")
+	stopSpinner := startAnimatedSpinner(os.Stdout, ctx, 120 * time.Millisecond)
+	probes := app.NewExecutor(prober, domain.PolicyExhaustive).RunEndpoints(ctx, endpoints)
+	stopSpinner()
+	text.PrintBlock(os.Stdout, "THROUGHPUT", text.SpeedtestText(probes, renderConf), renderConf)
+	return domain.ProbesExitCode(probes)
+}
 
 //docker run --rm -ti -v "$PWD":/app -w/app golang:1.23-alpine sh
 //apk add build-base
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/azargarov/rsvpck/internal/adapters/http"
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/version"
+)
+
+// serveCommand runs the peer of --bandwidth and of bandwidth endpoints
+// instead of the checks.
+const serveCommand = "serve"
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet(serveCommand, flag.ContinueOnError)
+	listen := fs.String("listen", net.JoinHostPort("", domain.DefaultBandwidthPort), "Address to listen on")
+	quiet := fs.Bool("quiet", false, "Do not log each transfer")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: rsvpck serve [-listen addr] [-quiet]\n\n"+
+			"Runs the bandwidth and echo server that rsvpck --bandwidth measures against.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return domain.ExitOK
+		}
+		return domain.ExitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("%s, version %s, bandwidth server\n", applicationName, version.String())
+	srv := http.NewBandwidthServer(os.Stdout)
+	if *quiet {
+		srv = http.NewBandwidthServer(nil)
+	}
+	if err := srv.ListenAndServe(ctx, *listen); err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
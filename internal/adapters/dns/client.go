@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxUDPReply is the largest UDP reply read; servers truncate above 512
+// bytes unless EDNS is used, so this leaves plenty of room.
+const maxUDPReply = 4096
+
+// wireClient sends queries straight to one server: over UDP with a TCP retry
+// when the reply is truncated, or over TCP only if the server asks for it.
+// It remembers how the last reply arrived.
+type wireClient struct {
+	server domain.DNSServer
+
+	truncated   bool
+	tcpFallback bool
+	responder   string
+}
+
+func newWireClient(server domain.DNSServer) *wireClient {
+	return &wireClient{server: server}
+}
+
+// exchange is an exchangeFunc. Each query gets a fresh random ID, and only
+// a reply carrying that ID is accepted.
+func (c *wireClient) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, errors.New("DNS query too short")
+	}
+	id := uint16(rand.Uint32())
+	query[0], query[1] = byte(id>>8), byte(id)
+
+	if c.server.Transport == domain.DNSTransportTCP {
+		return c.exchangeTCP(ctx, query, id)
+	}
+	reply, err := c.exchangeUDP(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isTruncated(reply) {
+		return reply, nil
+	}
+	c.truncated, c.tcpFallback = true, true
+	return c.exchangeTCP(ctx, query, id)
+}
+
+// exchangeUDP uses an unconnected socket so that the address the reply
+// actually came from can be reported; a middlebox answering in the server's
+// place shows up there.
+func (c *wireClient) exchangeUDP(ctx context.Context, query []byte, id uint16) ([]byte, error) {
+	raddr, err := net.ResolveUDPAddr("udp", c.server.Address)
+	if err != nil {
+		return nil, err
+	}
+	var lc net.ListenConfig
+	conn, err := lc.ListenPacket(ctx, "udp", "")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	setDeadline(ctx, conn)
+
+	if _, err := conn.WriteTo(query, raddr); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxUDPReply)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, err
+		}
+		if replyID(buf[:n]) != id {
+			continue // stale or spoofed
+		}
+		c.responder = from.String()
+		return buf[:n], nil
+	}
+}
+
+func (c *wireClient) exchangeTCP(ctx context.Context, query []byte, id uint16) ([]byte, error) {
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", c.server.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	setDeadline(ctx, conn)
+
+	reply, err := streamExchange(conn, query)
+	if err != nil {
+		return nil, err
+	}
+	if got := replyID(reply); got != id {
+		return nil, fmt.Errorf("DNS reply ID %d does not match query ID %d", got, id)
+	}
+	c.responder = conn.RemoteAddr().String()
+	return reply, nil
+}
+
+// apply copies what the client saw onto res.
+func (c *wireClient) apply(res *domain.DNSServerResult, info replyInfo) {
+	res.RCode = info.rcode
+	res.Authoritative = info.authoritative
+	res.NegativeSOA = info.soa
+	res.Truncated = c.truncated
+	res.TCPFallback = c.tcpFallback
+	res.Responder = c.responder
+}
+
+func setDeadline(ctx context.Context, conn interface{ SetDeadline(time.Time) error }) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+}
+
+func replyID(msg []byte) uint16 {
+	if len(msg) < 2 {
+		return 0
+	}
+	return uint16(msg[0])<<8 | uint16(msg[1])
+}
+
+func isTruncated(msg []byte) bool {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	return err == nil && hdr.Truncated
+}
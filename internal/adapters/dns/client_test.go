@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// newWireServer serves the stand-in zone over UDP and TCP on the same port.
+func newWireServer(t *testing.T) string {
+	t.Helper()
+	var (
+		pc  net.PacketConn
+		ln  net.Listener
+		err error
+	)
+	for range 10 {
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen udp: %v", err)
+		}
+		ln, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		_ = pc.Close()
+	}
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close(); _ = ln.Close() })
+
+	go func() {
+		buf := make([]byte, maxUDPReply)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(answer(t, buf[:n], false), from)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				for {
+					var lenBuf [2]byte
+					if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+						return
+					}
+					query := make([]byte, int(lenBuf[0])<<8|int(lenBuf[1]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					reply := answer(t, query, true)
+					_, _ = conn.Write(append([]byte{byte(len(reply) >> 8), byte(len(reply))}, reply...))
+				}
+			}()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// testEndpoint builds a public endpoint with newEndpoint and sets opts on it.
+func testEndpoint(t *testing.T, newEndpoint func(string, domain.EndpointType, string) (domain.Endpoint, error), target string, opts domain.DNSOptions) domain.Endpoint {
+	t.Helper()
+	ep, err := newEndpoint(target, domain.EndpointTypePublic, "test")
+	if err != nil {
+		t.Fatalf("endpoint: %v", err)
+	}
+	ep.SetDNSOptions(opts)
+	return ep
+}
+
+// wireA asks the server at addr for A records.
+func wireA(addr string, transport domain.DNSTransport) domain.DNSOptions {
+	return domain.DNSOptions{
+		Servers:    []domain.DNSServer{{Address: addr, Transport: transport}},
+		RecordType: domain.DNSRecordA,
+	}
+}
+
+func TestWireClient_RCodes(t *testing.T) {
+	addr := newWireServer(t)
+	cases := []struct {
+		name   string
+		status domain.Status
+		code   domain.ErrorCode
+		rcode  string
+		errHas string
+	}{
+		{"example.test", domain.StatusPass, 0, "NOERROR", ""},
+		{"servfail.example.test", domain.StatusDNSFailure, domain.ErrorCodeDNSServerFailure, "SERVFAIL", "SERVFAIL"},
+		{"refused.example.test", domain.StatusDNSFailure, domain.ErrorCodeDNSRefused, "REFUSED", "REFUSED"},
+		{"missing.example.test", domain.StatusDNSFailure, domain.ErrorCodeDNSNXDomain, "NXDOMAIN", "(SOA example.test)"},
+		{"host.lame.test", domain.StatusDNSFailure, domain.ErrorCodeDNSNXDomain, "NXDOMAIN", "unrelated zone elsewhere.test"},
+		{"nowhere.invalid", domain.StatusDNSFailure, domain.ErrorCodeDNSNXDomain, "NXDOMAIN", "without SOA"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := Checker{}.query(context.Background(), testEndpoint(t, domain.NewDNSEndpoint, tc.name, wireA(addr, domain.DNSTransportUDP)), &domain.DNSServer{Address: addr})
+			if res.Status != tc.status || res.RCode != tc.rcode {
+				t.Fatalf("got status %v rcode %q (%s)", res.Status, res.RCode, res.Error)
+			}
+			if tc.status == domain.StatusPass {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !domain.IsErrorCode(err, tc.code) {
+				t.Fatalf("want error code %v, got %v", tc.code, err)
+			}
+			if !strings.Contains(err.Error(), tc.errHas) {
+				t.Fatalf("error %q does not mention %q", err, tc.errHas)
+			}
+		})
+	}
+}
+
+func TestWireClient_Flags(t *testing.T) {
+	addr := newWireServer(t)
+
+	res, err := Checker{}.query(context.Background(), testEndpoint(t, domain.NewDNSEndpoint, "example.test", wireA(addr, domain.DNSTransportUDP)), &domain.DNSServer{Address: addr})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if !res.Authoritative || res.Truncated || res.TCPFallback || res.Responder != addr {
+		t.Fatalf("unexpected flags %+v", res)
+	}
+
+	// 40 A records do not fit in UDP: the client must retry over TCP
+	res, err = Checker{}.query(context.Background(), testEndpoint(t, domain.NewDNSEndpoint, "big.example.test", wireA(addr, domain.DNSTransportUDP)), &domain.DNSServer{Address: addr})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if !res.Truncated || !res.TCPFallback || len(res.Answers) != 40 {
+		t.Fatalf("want truncation and TCP fallback with 40 answers, got %+v", res)
+	}
+
+	// TCP-only servers never see the UDP query
+	server := &domain.DNSServer{Address: addr, Transport: domain.DNSTransportTCP}
+	res, err = Checker{}.query(context.Background(), testEndpoint(t, domain.NewDNSEndpoint, "big.example.test", wireA(addr, domain.DNSTransportTCP)), server)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if res.Truncated || res.TCPFallback || len(res.Answers) != 40 {
+		t.Fatalf("want a direct TCP answer, got %+v", res)
+	}
+}
+
+func TestWireClient_IgnoresMismatchedID(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, maxUDPReply)
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		reply := answer(t, buf[:n], false)
+		bogus := append([]byte(nil), reply...)
+		bogus[0] ^= 0xff
+		_, _ = pc.WriteTo(bogus, from)
+		_, _ = pc.WriteTo(reply, from)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c := newWireClient(domain.DNSServer{Address: pc.LocalAddr().String()})
+	answers, _, err := resolveWire(ctx, c.exchange, "example.test", domain.DNSRecordA)
+	if err != nil || len(answers) != 1 || answers[0] != "192.0.2.10" {
+		t.Fatalf("got %v, %v", answers, err)
+	}
+}
+
+func TestLookup_NoCNAME(t *testing.T) {
+	addr := newWireServer(t)
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	answers, err := lookup(context.Background(), resolver, "example.test.", domain.DNSRecordCNAME)
+	if err == nil || !strings.Contains(err.Error(), "no CNAME records") {
+		t.Fatalf("want no CNAME records for a name without one, got %v %v", answers, err)
+	}
+}
@@ -2,57 +2,356 @@ package dns
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"github.com/azargarov/rsvpck/internal/domain"
+	"math/rand/v2"
 	"net"
 	"net/netip"
 	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 const dnsTimeout = 800 * time.Millisecond
 
-type Checker struct{}
+type Checker struct {
+	rootCAs *x509.CertPool // nil means the system trust store
+}
 
 var _ domain.DNSChecker = (*Checker)(nil)
 
-func (r Checker) CheckWithContext(parentCtx context.Context, ep domain.Endpoint) domain.Probe {
+// public resolvers used by the hijack check when the endpoint names none
+var defaultPublicServers = []domain.DNSServer{
+	{Address: "1.1.1.1:53", Transport: domain.DNSTransportUDP},
+	{Address: "8.8.8.8:53", Transport: domain.DNSTransportUDP},
+}
+
+// CheckWithContext resolves ep.Target with the system resolver, or with the
+// endpoint's own servers tried in order. In compare mode the system resolver
+// and every server are queried side by side; the system answer decides the
+// probe status, the rest is reported in the details.
+func (r Checker) CheckWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	p := r.resolve(ctx, ep)
+	if ep.DNS.HijackCheck {
+		r.checkHijack(ctx, ep, &p)
+	}
+	return p
+}
+
+func (r Checker) resolve(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	if ep.DNS.Compare {
+		return r.compare(ctx, ep)
+	}
+	if len(ep.DNS.Servers) == 0 {
+		res, err := r.query(ctx, ep, nil)
+		return dnsProbe(ep, res, []domain.DNSServerResult{res}, err)
+	}
+
+	results := make([]domain.DNSServerResult, 0, len(ep.DNS.Servers))
+	var (
+		res domain.DNSServerResult
+		err error
+	)
+	for _, srv := range ep.DNS.Servers {
+		res, err = r.query(ctx, ep, &srv)
+		results = append(results, res)
+		if err == nil {
+			break
+		}
+	}
+	return dnsProbe(ep, res, results, err)
+}
+
+func (r Checker) compare(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	servers := make([]*domain.DNSServer, 0, len(ep.DNS.Servers)+1)
+	servers = append(servers, nil)
+	for i := range ep.DNS.Servers {
+		servers = append(servers, &ep.DNS.Servers[i])
+	}
+	results, errs := r.queryAll(ctx, ep, servers)
+	return dnsProbe(ep, results[0], results, errs[0])
+}
+
+// queryAll queries every server concurrently; a nil entry is the system resolver.
+func (r Checker) queryAll(ctx context.Context, ep domain.Endpoint, servers []*domain.DNSServer) ([]domain.DNSServerResult, []error) {
+	results := make([]domain.DNSServerResult, len(servers))
+	errs := make([]error, len(servers))
+
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = r.query(ctx, ep, srv)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// checkHijack compares the system resolver with public ones and probes for
+// NXDOMAIN rewriting. Findings turn a passing probe into a warning.
+func (r Checker) checkHijack(ctx context.Context, ep domain.Endpoint, p *domain.Probe) {
+	var (
+		system    domain.DNSServerResult
+		hasSystem bool
+		public    []domain.DNSServerResult
+	)
+	for _, res := range p.DNS.Results {
+		if res.Server == "" {
+			system, hasSystem = res, true
+		} else {
+			public = append(public, res)
+		}
+	}
+
+	var missing []*domain.DNSServer
+	if !hasSystem {
+		missing = append(missing, nil)
+	}
+	if len(public) == 0 {
+		servers := ep.DNS.Servers
+		if len(servers) == 0 {
+			servers = defaultPublicServers
+		}
+		for i := range servers {
+			missing = append(missing, &servers[i])
+		}
+	}
+	extra, _ := r.queryAll(ctx, ep, missing)
+	p.DNS.Results = append(p.DNS.Results, extra...)
+	for i, res := range extra {
+		if missing[i] == nil {
+			system = res
+		} else {
+			public = append(public, res)
+		}
+	}
+
+	findings := domain.DiagnoseDNSAnswers(ep.DNS, ep.Target, system, public)
+	if name, answers := r.nxdomainRewrite(ctx); len(answers) > 0 {
+		findings = append(findings, fmt.Sprintf(
+			"system resolver rewrites NXDOMAIN: non-existent %s resolved to %s",
+			name, strings.Join(answers, ", ")))
+	}
+	if len(findings) == 0 {
+		return
+	}
+	p.DNS.Diagnoses = findings
+	if p.IsSuccessful() {
+		p.MarkWarning(errors.New(strings.Join(findings, "; ")))
+	}
+}
+
+// nxdomainRewrite resolves a random name that cannot exist through the
+// system resolver and returns the answers, if any came back. The name is
+// fully qualified so no search domain is tried in its place.
+func (r Checker) nxdomainRewrite(parentCtx context.Context) (string, []string) {
+	ctx, cancel := context.WithTimeout(parentCtx, dnsTimeout)
+	defer cancel()
+
+	name := fmt.Sprintf("rsvpck-nx-%016x.com", rand.Uint64())
+	answers, err := net.DefaultResolver.LookupHost(ctx, name+".")
+	if err != nil {
+		return name, nil
+	}
+	return name, answers
+}
+
+var errServerFound = errors.New("system DNS server found")
+
+// systemServer finds the first server the system resolver asks, by letting
+// the Go resolver dial for a name that cannot exist and stopping it there.
+func systemServer(ctx context.Context) (domain.DNSServer, bool) {
+	var (
+		mu     sync.Mutex
+		server domain.DNSServer
+		found  bool
+	)
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(_ context.Context, network, address string) (net.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !found {
+				server, found = domain.DNSServer{Address: address, Transport: domain.DNSTransportUDP}, true
+				if strings.HasPrefix(network, "tcp") {
+					server.Transport = domain.DNSTransportTCP
+				}
+			}
+			return nil, errServerFound
+		},
+	}
+	_, _ = resolver.LookupHost(ctx, fmt.Sprintf("rsvpck-nx-%016x.com.", rand.Uint64()))
+	mu.Lock()
+	defer mu.Unlock()
+	return server, found
+}
+
+// query resolves the endpoint once and checks the answers against its
+// expectations; a nil server means the system resolver.
+func (r Checker) query(parentCtx context.Context, ep domain.Endpoint, server *domain.DNSServer) (domain.DNSServerResult, error) {
 	ctx, cancel := context.WithTimeout(parentCtx, dnsTimeout)
-    defer cancel()
+	defer cancel()
 
+	res := domain.DNSServerResult{}
+	via := ""
+	if server != nil {
+		res.Server = server.String()
+		via = " via " + server.String()
+	}
+
+	var (
+		answers []string
+		err     error
+	)
 	start := time.Now()
-	_, err := net.DefaultResolver.LookupHost(ctx, ep.Target)
-	latencyMs := time.Since(start).Seconds() * 1000
+	wire := server
+	if wire == nil && ep.DNS.RecordType == domain.DNSRecordCNAME {
+		// the stdlib resolver hides a missing CNAME behind the queried name,
+		// so ask the system's server for the answer section itself
+		if sys, ok := systemServer(ctx); ok {
+			wire = &sys
+		}
+	}
+	if wire == nil {
+		answers, err = lookup(ctx, net.DefaultResolver, ep.Target, ep.DNS.RecordType)
+	} else {
+		client := newWireClient(*wire)
+		var info replyInfo
+		answers, info, err = resolveWire(ctx, client.exchange, ep.Target, ep.DNS.RecordType)
+		client.apply(&res, info)
+	}
+	res.LatencyMs = time.Since(start).Seconds() * 1000
+	res.Answers = answers
 
 	if err != nil {
-		detailedErr := domain.Errorf(
-			domain.ErrorCodeDNSUnresolvable,
-			"DNS resolution failed for %q: %w", ep.Target, err,
+		res.Status = mapDNSError(err, ctx.Err())
+		res.Error = err.Error()
+		return res, domain.Errorf(
+			dnsErrorCode(err),
+			"DNS resolution failed for %q%s: %w", ep.Target, via, err,
 		)
-		return domain.NewFailedProbe(
-			ep,
-			mapDNSError(err, ctx.Err()),
-			detailedErr,
+	}
+
+	return res, checkAnswers(ep, ep.Target, via, &res)
+}
+
+// checkAnswers matches res.Answers against the endpoint's expectations and
+// sets the result status accordingly.
+func checkAnswers(ep domain.Endpoint, name, via string, res *domain.DNSServerResult) error {
+	if bad := ep.DNS.UnexpectedAnswers(res.Answers); len(bad) > 0 {
+		err := domain.Errorf(
+			domain.ErrorCodeDNSUnexpectedAnswer,
+			"unexpected %s answer for %q%s: %s (expected %s)",
+			ep.DNS.RecordType, name, via, strings.Join(bad, ", "), expectString(ep.DNS.Expect),
 		)
+		res.Status = domain.StatusDNSMismatch
+		res.Error = err.Error()
+		return err
 	}
-	return domain.NewSuccessfulProbe(ep, latencyMs)
+	res.Status = domain.StatusPass
+	return nil
 }
 
-func (r *Checker) LookupHost(ctx context.Context, host string, timeout time.Duration) (ips []netip.Addr, err error) {
+// lookup resolves name for the given record type and renders each answer as a string.
+func lookup(ctx context.Context, resolver *net.Resolver, name string, rtype domain.DNSRecordType) ([]string, error) {
+	switch rtype {
+	case domain.DNSRecordA, domain.DNSRecordAAAA:
+		network := "ip4"
+		if rtype == domain.DNSRecordAAAA {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			out = append(out, ip.String())
+		}
+		return out, nil
+	case domain.DNSRecordCNAME:
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		cname = strings.TrimSuffix(cname, ".")
+		if strings.EqualFold(cname, strings.TrimSuffix(name, ".")) {
+			return nil, fmt.Errorf("no %s records for %s", rtype, name)
+		}
+		return []string{cname}, nil
+	case domain.DNSRecordMX:
+		mxs, err := resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(mxs))
+		for _, mx := range mxs {
+			out = append(out, fmt.Sprintf("%d %s", mx.Pref, strings.TrimSuffix(mx.Host, ".")))
+		}
+		return out, nil
+	case domain.DNSRecordTXT:
+		return resolver.LookupTXT(ctx, name)
+	case domain.DNSRecordSRV:
+		_, srvs, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(srvs))
+		for _, srv := range srvs {
+			out = append(out, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, strings.TrimSuffix(srv.Target, ".")))
+		}
+		return out, nil
+	case domain.DNSRecordPTR:
+		names, err := resolver.LookupAddr(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]string, 0, len(names))
+		for _, n := range names {
+			out = append(out, strings.TrimSuffix(n, "."))
+		}
+		return out, nil
+	default:
+		return resolver.LookupHost(ctx, name)
+	}
+}
+
+func expectString(expect []domain.DNSExpect) string {
+	parts := make([]string, 0, len(expect))
+	for _, e := range expect {
+		parts = append(parts, e.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func dnsProbe(ep domain.Endpoint, decisive domain.DNSServerResult, results []domain.DNSServerResult, err error) domain.Probe {
+	var p domain.Probe
+	if err != nil {
+		p = domain.NewFailedProbe(ep, decisive.Status, err)
+	} else {
+		p = domain.NewSuccessfulProbe(ep, decisive.LatencyMs)
+	}
+	p.DNS = &domain.DNSDetails{RecordType: ep.DNS.RecordType, Results: results}
+	return p
+}
+
+// LookupHost resolves host through server, or the system resolver if server is nil.
+func (r *Checker) LookupHost(ctx context.Context, host string, server *domain.DNSServer, timeout time.Duration) (ips []netip.Addr, err error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	var dialer = &net.Dialer{Timeout: 800 * time.Millisecond}
-
-	var fastResolver = &net.Resolver{
-    	PreferGo: true,
-    	Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-    	    // Force a short DNS timeout regardless of system resolver settings
-    	    return dialer.DialContext(ctx, "udp", "8.8.8.8:53")
-    	},
+	var strIPs []string
+	if server == nil {
+		strIPs, err = net.DefaultResolver.LookupHost(ctx, host)
+	} else {
+		strIPs, _, err = resolveWire(ctx, newWireClient(*server).exchange, host, domain.DNSRecordHost)
 	}
-	strIPs, err := fastResolver.LookupHost(ctx, host)
-	//strIPs, err := net.DefaultResolver.LookupHost(ctx, host)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +365,24 @@ func (r *Checker) LookupHost(ctx context.Context, host string, timeout time.Dura
 	return addrs, nil
 }
 
+// dnsErrorCode tells the RCODEs that mean different things apart.
+func dnsErrorCode(err error) domain.ErrorCode {
+	var rcErr *rcodeError
+	if !errors.As(err, &rcErr) {
+		return domain.ErrorCodeDNSUnresolvable
+	}
+	switch rcErr.rcode {
+	case dnsmessage.RCodeNameError:
+		return domain.ErrorCodeDNSNXDomain
+	case dnsmessage.RCodeServerFailure:
+		return domain.ErrorCodeDNSServerFailure
+	case dnsmessage.RCodeRefused:
+		return domain.ErrorCodeDNSRefused
+	default:
+		return domain.ErrorCodeDNSUnresolvable
+	}
+}
+
 func mapDNSError(err, contextErr error) domain.Status {
 	if contextErr != nil {
 		if errors.Is(contextErr, context.DeadlineExceeded) ||
@@ -74,6 +391,11 @@ func mapDNSError(err, contextErr error) domain.Status {
 		}
 	}
 
+	var rcErr *rcodeError
+	if errors.As(err, &rcErr) {
+		return domain.StatusDNSFailure
+	}
+
 	var dnsErr *net.DNSError
 	if errors.As(err, &dnsErr) {
 		if dnsErr.Timeout() {
@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+const (
+	encryptedDNSTimeout = 2 * time.Second
+	maxDNSMessage       = 64 * 1024
+	dnsMessageMediaType = "application/dns-message"
+)
+
+// httpStatusError is a DoH reply with a non-200 status.
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return "DoH server returned " + e.status
+}
+
+// CheckDoHWithContext resolves ep.DNS.Query through the DNS-over-HTTPS server
+// at ep.Target (RFC 8484), through proxyURL if set.
+func (r Checker) CheckDoHWithContext(parentCtx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe {
+	ctx, cancel := context.WithTimeout(parentCtx, encryptedDNSTimeout)
+	defer cancel()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: r.rootCAs}
+	if proxyURL != "" {
+		pu, err := url.Parse(proxyURL)
+		if err != nil {
+			return domain.NewFailedProbe(ep, domain.StatusInvalid,
+				domain.Errorf(domain.ErrorCodeInvalidConfig, "invalid proxy URL: %w", err))
+		}
+		transport.Proxy = http.ProxyURL(pu)
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	var state *tls.ConnectionState
+	exchange := func(ctx context.Context, query []byte) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.Target, bytes.NewReader(query))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", dnsMessageMediaType)
+		req.Header.Set("Accept", dnsMessageMediaType)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		state = resp.TLS
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, &httpStatusError{code: resp.StatusCode, status: resp.Status}
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxDNSMessage))
+	}
+
+	p := r.encryptedProbe(ctx, ep, exchange)
+	if state != nil {
+		p.TLS = domain.NewTLSDetails(state.ServerName, state.PeerCertificates)
+	}
+	return p
+}
+
+// CheckDoTWithContext resolves ep.DNS.Query through the DNS-over-TLS server
+// at ep.Target (RFC 7858).
+func (r Checker) CheckDoTWithContext(parentCtx context.Context, ep domain.Endpoint) domain.Probe {
+	ctx, cancel := context.WithTimeout(parentCtx, encryptedDNSTimeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(ep.Target)
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid,
+			domain.Errorf(domain.ErrorCodeInvalidConfig, "invalid DoT server %q: %w", ep.Target, err))
+	}
+
+	var conn *tls.Conn
+	defer func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}()
+	exchange := func(ctx context.Context, query []byte) ([]byte, error) {
+		if conn == nil {
+			d := &net.Dialer{}
+			raw, err := d.DialContext(ctx, "tcp", ep.Target)
+			if err != nil {
+				return nil, err
+			}
+			conn = tls.Client(raw, &tls.Config{ServerName: host, RootCAs: r.rootCAs})
+			if err := conn.HandshakeContext(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		return streamExchange(conn, query)
+	}
+
+	p := r.encryptedProbe(ctx, ep, exchange)
+	if conn != nil {
+		if state := conn.ConnectionState(); state.HandshakeComplete {
+			p.TLS = domain.NewTLSDetails(host, state.PeerCertificates)
+		}
+	}
+	return p
+}
+
+func (r Checker) encryptedProbe(ctx context.Context, ep domain.Endpoint, exchange exchangeFunc) domain.Probe {
+	res := domain.DNSServerResult{Server: ep.Target}
+
+	start := time.Now()
+	answers, info, err := resolveWire(ctx, exchange, ep.DNS.Query, ep.DNS.RecordType)
+	res.LatencyMs = time.Since(start).Seconds() * 1000
+	res.Answers = answers
+	res.RCode, res.Authoritative, res.NegativeSOA = info.rcode, info.authoritative, info.soa
+
+	if err != nil {
+		status, code := mapEncryptedDNSError(err, ctx.Err())
+		res.Status = status
+		res.Error = err.Error()
+		err = domain.Errorf(code, "%s lookup of %q via %s failed: %w",
+			strings.ToUpper(ep.TargetType.String()), ep.DNS.Query, ep.Target, err)
+	} else {
+		err = checkAnswers(ep, ep.DNS.Query, " via "+ep.Target, &res)
+	}
+	return dnsProbe(ep, res, []domain.DNSServerResult{res}, err)
+}
+
+// streamExchange sends a query over a stream transport (TCP, TLS) using
+// the two-byte length prefix of RFC 1035 4.2.2.
+func streamExchange(rw io.ReadWriter, query []byte) ([]byte, error) {
+	if len(query) > maxDNSMessage-1 {
+		return nil, errors.New("DNS query too large")
+	}
+	msg := make([]byte, 2+len(query))
+	msg[0], msg[1] = byte(len(query)>>8), byte(len(query))
+	copy(msg[2:], query)
+	if _, err := rw.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(rw, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, int(lenBuf[0])<<8|int(lenBuf[1]))
+	if _, err := io.ReadFull(rw, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func mapEncryptedDNSError(err, contextErr error) (domain.Status, domain.ErrorCode) {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.code == http.StatusProxyAuthRequired {
+			return domain.StatusProxyAuth, domain.ErrorCodeProxyAuthRequired
+		}
+		return domain.StatusHTTPError, domain.ErrorCodeHTTPBadStatus
+	}
+	if isTLSError(err) {
+		return domain.StatusFail, domain.ErrorCodeTLSFailed
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "connection refused") {
+		return domain.StatusConnectionRefused, domain.ErrorCodeConnectionRefused
+	}
+	return mapDNSError(err, contextErr), dnsErrorCode(err)
+}
+
+func isTLSError(err error) bool {
+	var (
+		verifyErr   *tls.CertificateVerificationError
+		unknownAuth x509.UnknownAuthorityError
+		hostErr     x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+		recordErr   tls.RecordHeaderError
+	)
+	switch {
+	case errors.As(err, &verifyErr), errors.As(err, &unknownAuth), errors.As(err, &hostErr),
+		errors.As(err, &invalidErr), errors.As(err, &recordErr):
+		return true
+	}
+	return strings.Contains(err.Error(), "tls:")
+}
@@ -0,0 +1,176 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func newDoHServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dnsMessageMediaType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", dnsMessageMediaType)
+		_, _ = w.Write(answer(t, query, true))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newDoTServer serves DNS over TLS with the certificate of an httptest server.
+func newDoTServer(t *testing.T) (addr string, roots *x509.CertPool) {
+	t.Helper()
+	certSrc := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(certSrc.Close)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certSrc.TLS.Certificates})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				for {
+					var lenBuf [2]byte
+					if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+						return
+					}
+					query := make([]byte, int(lenBuf[0])<<8|int(lenBuf[1]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					reply := answer(t, query, true)
+					_, _ = conn.Write(append([]byte{byte(len(reply) >> 8), byte(len(reply))}, reply...))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), certSrc.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+}
+
+func dohRoots(srv *httptest.Server) *x509.CertPool {
+	return srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+}
+
+func TestCheckDoH(t *testing.T) {
+	srv := newDoHServer(t)
+	c := Checker{rootCAs: dohRoots(srv)}
+	ctx := context.Background()
+
+	p := c.CheckDoHWithContext(ctx, testEndpoint(t, domain.NewDoHEndpoint, srv.URL+"/dns-query", domain.DNSOptions{Query: "multi.example.test"}), "")
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %+v", p)
+	}
+	if got := p.DNS.Results[0].Answers; len(got) != 2 || got[0] != "192.0.2.11" || got[1] != "2001:db8::11" {
+		t.Fatalf("unexpected answers %v", got)
+	}
+	if p.TLS == nil || len(p.TLS.Certificates) == 0 || !p.TLS.Certificates[0].Valid {
+		t.Fatalf("want a valid certificate reported, got %+v", p.TLS)
+	}
+
+	p = c.CheckDoHWithContext(ctx, testEndpoint(t, domain.NewDoHEndpoint, srv.URL+"/dns-query", domain.DNSOptions{Query: "missing.example.test"}), "")
+	if p.Status != domain.StatusDNSFailure {
+		t.Fatalf("want DNS failure for NXDOMAIN, got %v (%s)", p.Status, p.Error)
+	}
+
+	// without the test CA the certificate must be rejected
+	p = Checker{}.CheckDoHWithContext(ctx, testEndpoint(t, domain.NewDoHEndpoint, srv.URL+"/dns-query", domain.DNSOptions{Query: "example.test"}), "")
+	if p.Status != domain.StatusFail || !strings.Contains(p.Error, "certificate") {
+		t.Fatalf("want TLS failure with untrusted certificate, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckDoH_ViaProxy(t *testing.T) {
+	srv := newDoHServer(t)
+
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		tunnels.Add(1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		_, _ = io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() { _, _ = io.Copy(upstream, client); upstream.Close() }()
+		_, _ = io.Copy(client, upstream)
+		client.Close()
+	}))
+	defer proxy.Close()
+
+	c := Checker{rootCAs: dohRoots(srv)}
+	p := c.CheckDoHWithContext(context.Background(), testEndpoint(t, domain.NewDoHEndpoint, srv.URL, domain.DNSOptions{Query: "example.test"}), proxy.URL)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success via proxy, got %v (%s)", p.Status, p.Error)
+	}
+	if tunnels.Load() == 0 {
+		t.Fatalf("request did not go through the proxy")
+	}
+}
+
+func TestCheckDoT(t *testing.T) {
+	addr, roots := newDoTServer(t)
+	c := Checker{rootCAs: roots}
+
+	ep := testEndpoint(t, domain.NewDoTEndpoint, addr, domain.DNSOptions{Query: "example.test"})
+	exp, _ := domain.ParseDNSExpect("192.0.2.0/24")
+	ep.DNS.Expect = []domain.DNSExpect{exp}
+
+	p := c.CheckDoTWithContext(context.Background(), ep)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	if p.TLS == nil || p.TLS.ServerName != "127.0.0.1" {
+		t.Fatalf("want TLS details for 127.0.0.1, got %+v", p.TLS)
+	}
+
+	exp, _ = domain.ParseDNSExpect("198.51.100.0/24")
+	ep.DNS.Expect = []domain.DNSExpect{exp}
+	if p := c.CheckDoTWithContext(context.Background(), ep); p.Status != domain.StatusDNSMismatch {
+		t.Fatalf("want DNS mismatch, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.1":   "1.2.0.192.in-addr.arpa.",
+		"2001:db8::1": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+	}
+	for in, want := range cases {
+		got, err := reverseName(in)
+		if err != nil || got != want {
+			t.Fatalf("reverseName(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
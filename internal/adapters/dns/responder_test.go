@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// zone is the fake data served by the in-process DNS stand-ins. Names not
+// listed answer NXDOMAIN.
+var zone = map[string][]netip.Addr{
+	"example.test.":       {netip.MustParseAddr("192.0.2.10")},
+	"multi.example.test.": {netip.MustParseAddr("192.0.2.11"), netip.MustParseAddr("2001:db8::11")},
+	"big.example.test.":   bigAnswer(),
+}
+
+// failing names answer with a fixed RCODE.
+var failing = map[string]dnsmessage.RCode{
+	"servfail.example.test.": dnsmessage.RCodeServerFailure,
+	"refused.example.test.":  dnsmessage.RCodeRefused,
+}
+
+// negative answers carry the SOA of the zone they fall under; names under
+// lame.test. get the SOA of a different zone, anything else none at all.
+var soaFor = map[string]string{
+	"example.test.": "example.test.",
+	"lame.test.":    "elsewhere.test.",
+}
+
+// bigAnswer returns more A records than fit a 512-byte UDP reply.
+func bigAnswer() []netip.Addr {
+	addrs := make([]netip.Addr, 40)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom4([4]byte{192, 0, 2, byte(100 + i)})
+	}
+	return addrs
+}
+
+// answer builds the stand-in reply to query. Replies over 512 bytes are
+// truncated unless sent over a stream.
+func answer(t *testing.T, query []byte, stream bool) []byte {
+	t.Helper()
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		t.Errorf("stand-in: bad query: %v", err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Errorf("stand-in: bad question: %v", err)
+		return nil
+	}
+
+	name := strings.ToLower(q.Name.String())
+	addrs, known := zone[name]
+	rhdr := dnsmessage.Header{ID: hdr.ID, Response: true, RecursionDesired: hdr.RecursionDesired, RecursionAvailable: true}
+	rhdr.Authoritative = strings.HasSuffix(name, "example.test.")
+	if rc, ok := failing[name]; ok {
+		rhdr.RCode = rc
+	} else if !known {
+		rhdr.RCode = dnsmessage.RCodeNameError
+	}
+
+	msg := buildReply(t, rhdr, q, addrs)
+	if !stream && len(msg) > 512 {
+		rhdr.Truncated = true
+		msg = buildReply(t, rhdr, q, nil)
+	}
+	return msg
+}
+
+func buildReply(t *testing.T, hdr dnsmessage.Header, q dnsmessage.Question, addrs []netip.Addr) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, hdr)
+	_ = b.StartQuestions()
+	_ = b.Question(q)
+	_ = b.StartAnswers()
+	for _, a := range addrs {
+		h := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+		switch {
+		case a.Is4() && q.Type == dnsmessage.TypeA:
+			_ = b.AResource(h, dnsmessage.AResource{A: a.As4()})
+		case a.Is6() && q.Type == dnsmessage.TypeAAAA:
+			_ = b.AAAAResource(h, dnsmessage.AAAAResource{AAAA: a.As16()})
+		}
+	}
+	_ = b.StartAuthorities()
+	if hdr.RCode == dnsmessage.RCodeNameError {
+		for suffix, soa := range soaFor {
+			if strings.HasSuffix(q.Name.String(), suffix) {
+				h := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(soa), Class: dnsmessage.ClassINET, TTL: 60}
+				_ = b.SOAResource(h, dnsmessage.SOAResource{
+					NS:   dnsmessage.MustNewName("ns." + soa),
+					MBox: dnsmessage.MustNewName("hostmaster." + soa),
+				})
+			}
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Errorf("stand-in: build reply: %v", err)
+	}
+	return msg
+}
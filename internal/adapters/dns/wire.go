@@ -0,0 +1,279 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// exchangeFunc sends one wire-format query and returns the raw reply.
+type exchangeFunc func(ctx context.Context, query []byte) ([]byte, error)
+
+// rcodeError is a reply that came back with a non-success RCODE.
+type rcodeError struct {
+	rcode dnsmessage.RCode
+	name  string // queried name
+	soa   string // zone of the SOA in the authority section, if any
+}
+
+func (e *rcodeError) Error() string {
+	msg := "server answered " + rcodeString(e.rcode)
+	if e.rcode != dnsmessage.RCodeNameError {
+		return msg
+	}
+	// a negative answer names the zone that denies the name; anything else
+	// points at a lame delegation or a middlebox answering for the zone
+	switch {
+	case e.soa == "":
+		return msg + " without SOA"
+	case !inZone(e.name, e.soa):
+		return msg + " with SOA of unrelated zone " + e.soa
+	default:
+		return msg + " (SOA " + e.soa + ")"
+	}
+}
+
+// replyInfo holds the header facts of the last reply seen by resolveWire.
+type replyInfo struct {
+	rcode         string // empty if no reply came back
+	authoritative bool
+	soa           string
+}
+
+func rcodeString(rc dnsmessage.RCode) string {
+	switch rc {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	default:
+		return fmt.Sprintf("RCODE%d", rc)
+	}
+}
+
+// questionTypes maps a record type to the wire queries answering it; a host
+// lookup asks for both A and AAAA.
+func questionTypes(rtype domain.DNSRecordType) []dnsmessage.Type {
+	switch rtype {
+	case domain.DNSRecordA:
+		return []dnsmessage.Type{dnsmessage.TypeA}
+	case domain.DNSRecordAAAA:
+		return []dnsmessage.Type{dnsmessage.TypeAAAA}
+	case domain.DNSRecordCNAME:
+		return []dnsmessage.Type{dnsmessage.TypeCNAME}
+	case domain.DNSRecordMX:
+		return []dnsmessage.Type{dnsmessage.TypeMX}
+	case domain.DNSRecordTXT:
+		return []dnsmessage.Type{dnsmessage.TypeTXT}
+	case domain.DNSRecordSRV:
+		return []dnsmessage.Type{dnsmessage.TypeSRV}
+	case domain.DNSRecordPTR:
+		return []dnsmessage.Type{dnsmessage.TypePTR}
+	default:
+		return []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	}
+}
+
+// resolveWire looks name up through exchange and renders the answers the
+// same way the system resolver path does.
+func resolveWire(ctx context.Context, exchange exchangeFunc, name string, rtype domain.DNSRecordType) ([]string, replyInfo, error) {
+	qname := name
+	if rtype == domain.DNSRecordPTR {
+		rev, err := reverseName(name)
+		if err != nil {
+			return nil, replyInfo{}, err
+		}
+		qname = rev
+	}
+
+	var (
+		answers []string
+		info    replyInfo
+	)
+	for _, qtype := range questionTypes(rtype) {
+		query, err := buildQuery(qname, qtype, 0)
+		if err != nil {
+			return nil, info, err
+		}
+		reply, err := exchange(ctx, query)
+		if err != nil {
+			return nil, info, err
+		}
+		got, last, err := parseReply(reply, qtype)
+		if err != nil {
+			return nil, last, err
+		}
+		info = last
+		answers = append(answers, got...)
+	}
+	if len(answers) == 0 {
+		if info.soa != "" {
+			return nil, info, fmt.Errorf("no %s records for %s (SOA %s)", rtype, name, info.soa)
+		}
+		return nil, info, fmt.Errorf("no %s records for %s", rtype, name)
+	}
+	return answers, info, nil
+}
+
+func buildQuery(name string, qtype dnsmessage.Type, id uint16) ([]byte, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS name %q: %w", name, err)
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// parseReply returns the answers of type qtype in reply and its header
+// facts, or an *rcodeError if the server did not answer with success.
+func parseReply(reply []byte, qtype dnsmessage.Type) ([]string, replyInfo, error) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(reply)
+	if err != nil {
+		return nil, replyInfo{}, fmt.Errorf("malformed DNS reply: %w", err)
+	}
+	info := replyInfo{rcode: rcodeString(hdr.RCode), authoritative: hdr.Authoritative}
+	q, err := p.Question()
+	if err != nil {
+		return nil, info, fmt.Errorf("malformed DNS reply: %w", err)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, info, fmt.Errorf("malformed DNS reply: %w", err)
+	}
+
+	var out []string
+	for {
+		h, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, info, fmt.Errorf("malformed DNS reply: %w", err)
+		}
+		if h.Type != qtype {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, info, fmt.Errorf("malformed DNS reply: %w", err)
+			}
+			continue
+		}
+		ans, err := answerString(&p, qtype)
+		if err != nil {
+			return nil, info, fmt.Errorf("malformed DNS reply: %w", err)
+		}
+		out = append(out, ans)
+	}
+
+	if len(out) == 0 {
+		info.soa = authoritySOA(&p)
+	}
+	if hdr.RCode != dnsmessage.RCodeSuccess {
+		return nil, info, &rcodeError{rcode: hdr.RCode, name: trimDot(q.Name.String()), soa: info.soa}
+	}
+	return out, info, nil
+}
+
+// authoritySOA returns the owner of the first SOA record in the authority
+// section, the zone a negative answer comes from.
+func authoritySOA(p *dnsmessage.Parser) string {
+	for {
+		h, err := p.AuthorityHeader()
+		if err != nil {
+			return ""
+		}
+		if h.Type == dnsmessage.TypeSOA {
+			return trimDot(h.Name.String())
+		}
+		if err := p.SkipAuthority(); err != nil {
+			return ""
+		}
+	}
+}
+
+func answerString(p *dnsmessage.Parser, qtype dnsmessage.Type) (string, error) {
+	switch qtype {
+	case dnsmessage.TypeA:
+		r, err := p.AResource()
+		return netip.AddrFrom4(r.A).String(), err
+	case dnsmessage.TypeAAAA:
+		r, err := p.AAAAResource()
+		return netip.AddrFrom16(r.AAAA).String(), err
+	case dnsmessage.TypeCNAME:
+		r, err := p.CNAMEResource()
+		return trimDot(r.CNAME.String()), err
+	case dnsmessage.TypeMX:
+		r, err := p.MXResource()
+		return fmt.Sprintf("%d %s", r.Pref, trimDot(r.MX.String())), err
+	case dnsmessage.TypeTXT:
+		r, err := p.TXTResource()
+		return strings.Join(r.TXT, ""), err
+	case dnsmessage.TypeSRV:
+		r, err := p.SRVResource()
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, trimDot(r.Target.String())), err
+	case dnsmessage.TypePTR:
+		r, err := p.PTRResource()
+		return trimDot(r.PTR.String()), err
+	default:
+		return "", p.SkipAnswer()
+	}
+}
+
+// reverseName turns an IP address into its in-addr.arpa / ip6.arpa name.
+func reverseName(ip string) (string, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", fmt.Errorf("PTR lookups need an IP address: %w", err)
+	}
+	addr = addr.Unmap()
+	var b strings.Builder
+	if addr.Is4() {
+		v4 := addr.As4()
+		for i := len(v4) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "%d.", v4[i])
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String(), nil
+	}
+	v6 := addr.As16()
+	const hex = "0123456789abcdef"
+	for i := len(v6) - 1; i >= 0; i-- {
+		b.WriteByte(hex[v6[i]&0x0f])
+		b.WriteByte('.')
+		b.WriteByte(hex[v6[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String(), nil
+}
+
+// inZone reports whether name is zone or lies below it.
+func inZone(name, zone string) bool {
+	name, zone = strings.ToLower(trimDot(name)), strings.ToLower(trimDot(zone))
+	return zone == "" || name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+func trimDot(s string) string {
+	return strings.TrimSuffix(s, ".")
+}
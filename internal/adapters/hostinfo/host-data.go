@@ -2,6 +2,7 @@ package hostinfo
 
 import (
 	"context"
+	"github.com/azargarov/rsvpck/internal/adapters/sysproxy"
 	"github.com/azargarov/rsvpck/internal/domain"
 	"os"
 	"os/exec"
@@ -20,6 +21,7 @@ func GetCRMInfo(ctx context.Context) domain.HostInfo {
 	info.OS = runtime.GOOS
 	info.SID = getSID(ctx)
 	info.RT = string(getRoutingTable())
+	info.Proxy = sysproxy.FromEnvironment().String()
 
 	return info
 }
@@ -0,0 +1,282 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// bandwidthDialTimeout bounds connecting to the peer; the transfers
+// themselves run for the seconds the endpoint asks for.
+const bandwidthDialTimeout = 5 * time.Second
+
+// CheckBandwidthWithContext measures the path to a peer running rsvpck
+// serve: the round trip and jitter of echoes over one connection, then a
+// download and an upload of the endpoint's duration each, second by second.
+// Peers are reached directly, never through a proxy.
+func (c Checker) CheckBandwidthWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	if _, _, err := net.SplitHostPort(ep.Target); err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid,
+			errors.New("invalid target format, expected host:port"))
+	}
+	opts := ep.Bandwidth
+	ctx, cancel := context.WithTimeout(ctx, 2*opts.Duration()+throughputTimeout)
+	defer cancel()
+
+	t := &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: bandwidthDialTimeout}).DialContext,
+		DisableCompression:  true,
+		MaxIdleConnsPerHost: 1,
+	}
+	defer t.CloseIdleConnections()
+	client := &http.Client{Transport: t}
+	base := "http://" + ep.Target
+
+	details := &domain.BandwidthDetails{}
+	fail := func(status domain.Status, err error) domain.Probe {
+		p := domain.NewFailedProbe(ep, status, err)
+		p.Bandwidth = details
+		return p
+	}
+
+	server, rtts, err := echoes(ctx, client, base, opts.PingCount())
+	details.Server = server
+	details.RTT = domain.NewRTTStats(rtts)
+	if err != nil {
+		return fail(bandwidthFailure(ctx, err))
+	}
+
+	details.Download, err = bandwidthDownload(ctx, client, base, opts.Duration())
+	if err != nil {
+		return fail(bandwidthFailure(ctx, err))
+	}
+	if !opts.NoUpload {
+		up, err := bandwidthUpload(ctx, client, base, opts.Duration())
+		details.Upload = &up
+		if err != nil {
+			return fail(bandwidthFailure(ctx, err))
+		}
+	}
+
+	p := domain.NewSuccessfulProbe(ep, details.RTT.AvgMs)
+	p.Bandwidth = details
+	return p
+}
+
+// echoes times count echoes over one kept-alive connection, after one that
+// opens it and checks the peer. It returns the version the peer reported.
+func echoes(ctx context.Context, client *http.Client, base string, count int) (string, []float64, error) {
+	var server string
+	rtts := make([]float64, 0, count)
+	for i := 0; i <= count; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+bandwidthEchoPath, nil)
+		if err != nil {
+			return server, rtts, err
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return server, rtts, fmt.Errorf("echo: %w", err)
+		}
+		drain(resp)
+		rtt := time.Since(start).Seconds() * 1000
+		if err := checkPeer(resp); err != nil {
+			return server, rtts, err
+		}
+		server = resp.Header.Get(bandwidthServerHeader)
+		if i > 0 {
+			rtts = append(rtts, rtt)
+		}
+	}
+	return server, rtts, nil
+}
+
+// bandwidthDownload reads what the peer streams for d.
+func bandwidthDownload(ctx context.Context, client *http.Client, base string, d time.Duration) (domain.BandwidthTransfer, error) {
+	var firstByte time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	target := fmt.Sprintf("%s%s?seconds=%d", base, bandwidthDownPath, int(d.Seconds()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return domain.BandwidthTransfer{}, err
+	}
+	setTransferHeaders(req)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return domain.BandwidthTransfer{}, fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkPeer(resp); err != nil {
+		return domain.BandwidthTransfer{}, err
+	}
+
+	counter := newIntervalCounter()
+	buf := make([]byte, 32<<10)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			counter.add(n, time.Now())
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = fmt.Errorf("download stopped after %s: %w", domain.FormatBytes(counter.out.Bytes), rerr)
+			break
+		}
+	}
+	tr := counter.finish(time.Now())
+	if !firstByte.IsZero() {
+		tr.TTFBMs = firstByte.Sub(start).Seconds() * 1000
+	}
+	if err == nil && tr.Bytes == 0 {
+		err = domain.Errorf(domain.ErrorCodeThroughputFailed, "download: the peer sent nothing")
+	}
+	return tr, err
+}
+
+// bandwidthUpload sends data for d; the peer answers with how much arrived.
+func bandwidthUpload(ctx context.Context, client *http.Client, base string, d time.Duration) (domain.BandwidthTransfer, error) {
+	var firstByte time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	body := &timedBody{duration: d, counter: newIntervalCounter()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+bandwidthUpPath, body)
+	if err != nil {
+		return domain.BandwidthTransfer{}, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	setTransferHeaders(req)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	done := time.Now()
+	if !firstByte.IsZero() {
+		done = firstByte
+	}
+	tr := body.counter.finish(done)
+	tr.TTFBMs = done.Sub(start).Seconds() * 1000
+	if err != nil {
+		return tr, fmt.Errorf("upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkPeer(resp); err != nil {
+		return tr, err
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 32))
+	if err != nil {
+		return tr, fmt.Errorf("upload: reading the answer: %w", err)
+	}
+	// what arrived, rather than what left the socket buffers
+	if n, err := strconv.ParseInt(strings.TrimSpace(string(answer)), 10, 64); err == nil {
+		tr.Bytes = n
+	}
+	return tr, nil
+}
+
+// checkPeer fails a response that did not come from rsvpck serve or that
+// refused the request.
+func checkPeer(resp *http.Response) error {
+	if resp.Header.Get(bandwidthServerHeader) == "" {
+		return domain.Errorf(domain.ErrorCodeBandwidthPeer, "%s is not an rsvpck server: it answered %s without the %s header",
+			resp.Request.URL.Host, resp.Status, bandwidthServerHeader)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return domain.Errorf(statusErrorCode(resp.StatusCode), "%s %s returned %s",
+			resp.Request.Method, resp.Request.URL.Path, resp.Status)
+	}
+	return nil
+}
+
+func bandwidthFailure(ctx context.Context, err error) (domain.Status, error) {
+	switch {
+	case domain.IsErrorCode(err, domain.ErrorCodeBandwidthPeer), domain.IsErrorCode(err, domain.ErrorCodeThroughputFailed):
+		return domain.StatusFail, err
+	case domain.IsErrorCode(err, domain.ErrorCodeHTTPClientError), domain.IsErrorCode(err, domain.ErrorCodeHTTPBadStatus),
+		domain.IsErrorCode(err, domain.ErrorCodeHTTPUnexpectedStatus):
+		return domain.StatusHTTPError, err
+	}
+	info := classifyHTTPError(err, ctx.Err())
+	return info.Status, domain.Errorf(info.ErrorCode, "%w", err)
+}
+
+// intervalCounter splits a transfer into one-second intervals as its bytes
+// come and counts the stalls in it.
+type intervalCounter struct {
+	stallMs       float64
+	started       time.Time
+	last          time.Time
+	intervalStart time.Time
+	interval      domain.TransferStats // the one being counted
+	out           domain.BandwidthTransfer
+}
+
+func newIntervalCounter() *intervalCounter {
+	return &intervalCounter{stallMs: domain.DefaultThroughputStallMs}
+}
+
+func (c *intervalCounter) add(n int, now time.Time) {
+	if c.started.IsZero() {
+		c.started, c.last, c.intervalStart = now, now, now
+	} else {
+		recordGap(&c.out.TransferStats, now.Sub(c.last), c.stallMs)
+	}
+	for now.Sub(c.intervalStart) >= time.Second {
+		c.interval.DurationMs = 1000
+		c.out.Intervals = append(c.out.Intervals, c.interval)
+		c.interval = domain.TransferStats{}
+		c.intervalStart = c.intervalStart.Add(time.Second)
+	}
+	c.last = now
+	c.interval.Bytes += int64(n)
+	c.out.Bytes += int64(n)
+}
+
+// finish closes the last, partial interval at now.
+func (c *intervalCounter) finish(now time.Time) domain.BandwidthTransfer {
+	if c.started.IsZero() {
+		return c.out
+	}
+	if c.interval.Bytes > 0 {
+		c.interval.DurationMs = now.Sub(c.intervalStart).Seconds() * 1000
+		c.out.Intervals = append(c.out.Intervals, c.interval)
+		c.interval = domain.TransferStats{}
+	}
+	c.out.DurationMs = now.Sub(c.started).Seconds() * 1000
+	return c.out
+}
+
+// timedBody is an upload that lasts duration from its first read, counting
+// what the transport takes as it takes it.
+type timedBody struct {
+	duration time.Duration
+	counter  *intervalCounter
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	now := time.Now()
+	if !b.counter.started.IsZero() && now.Sub(b.counter.started) >= b.duration {
+		return 0, io.EOF
+	}
+	n := copy(p, uploadBlock)
+	b.counter.add(n, now)
+	return n, nil
+}
+
+func (b *timedBody) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/version"
+)
+
+// Paths and header of rsvpck serve, shared by the server and the bandwidth
+// probe.
+const (
+	bandwidthEchoPath     = "/rsvpck/echo"
+	bandwidthDownPath     = "/rsvpck/down"
+	bandwidthUpPath       = "/rsvpck/up"
+	bandwidthServerHeader = "X-Rsvpck-Server"
+)
+
+// maxBandwidthSeconds bounds how long the server streams or reads for one
+// request, whatever the client asks for.
+const maxBandwidthSeconds = 60
+
+// BandwidthServer is the peer of bandwidth probes, run by rsvpck serve. It
+// answers echoes, streams data for as many seconds as asked and reads
+// uploads, reporting how much arrived.
+type BandwidthServer struct {
+	mu  sync.Mutex
+	log io.Writer // one line per transfer; nil is silent
+}
+
+func NewBandwidthServer(log io.Writer) *BandwidthServer {
+	return &BandwidthServer{log: log}
+}
+
+// ListenAndServe serves on addr until ctx is done.
+func (s *BandwidthServer) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves on ln until ctx is done.
+func (s *BandwidthServer) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	s.logf("listening on %s", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *BandwidthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(bandwidthServerHeader, version.Short())
+	switch r.URL.Path {
+	case bandwidthEchoPath:
+		w.WriteHeader(http.StatusNoContent)
+	case bandwidthDownPath:
+		if r.Method != http.MethodGet {
+			http.Error(w, "GET only", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveDownload(w, r)
+	case bandwidthUpPath:
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		s.serveUpload(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveDownload streams random data for the seconds the client asks for.
+func (s *BandwidthServer) serveDownload(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+	if err != nil || seconds <= 0 {
+		seconds = domain.DefaultBandwidthSeconds
+	}
+	seconds = min(seconds, maxBandwidthSeconds)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+
+	var stats domain.TransferStats
+	start := time.Now()
+	deadline := start.Add(time.Duration(seconds) * time.Second)
+	for time.Now().Before(deadline) {
+		n, err := w.Write(uploadBlock)
+		stats.Bytes += int64(n)
+		if err != nil {
+			break
+		}
+	}
+	stats.DurationMs = time.Since(start).Seconds() * 1000
+	s.logf("download to %s: %s", r.RemoteAddr, transferSummary(stats))
+}
+
+// serveUpload reads the body to its end and answers with its length.
+func (s *BandwidthServer) serveUpload(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add((maxBandwidthSeconds + 10) * time.Second))
+
+	var stats domain.TransferStats
+	start := time.Now()
+	n, err := io.Copy(io.Discard, r.Body)
+	stats.Bytes = n
+	stats.DurationMs = time.Since(start).Seconds() * 1000
+	if err != nil {
+		s.logf("upload from %s failed after %s: %v", r.RemoteAddr, domain.FormatBytes(n), err)
+		return
+	}
+	s.logf("upload from %s: %s", r.RemoteAddr, transferSummary(stats))
+	fmt.Fprintf(w, "%d", n)
+}
+
+func (s *BandwidthServer) logf(format string, args ...any) {
+	if s.log == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.log, "%s %s\n", time.Now().Format(time.TimeOnly), fmt.Sprintf(format, args...))
+}
+
+func transferSummary(s domain.TransferStats) string {
+	return fmt.Sprintf("%s in %.0f ms, %.2f Mbps", domain.FormatBytes(s.Bytes), s.DurationMs, s.Mbps())
+}
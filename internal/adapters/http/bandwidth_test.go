@@ -0,0 +1,104 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/version"
+)
+
+// bandwidthPeer runs rsvpck serve on a free port until the test ends.
+func bandwidthPeer(t *testing.T) (string, *bytes.Buffer) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var log bytes.Buffer
+	srv := NewBandwidthServer(&log)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = srv.Serve(ctx, ln)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return ln.Addr().String(), &log
+}
+
+func TestCheckBandwidth(t *testing.T) {
+	addr, log := bandwidthPeer(t)
+	ep := domain.MustNewBandwidthEndpoint(addr, domain.EndpointTypePublic, "relay")
+	ep.SetBandwidthOptions(domain.BandwidthOptions{Seconds: 1, Pings: 3})
+
+	p := Checker{}.CheckBandwidthWithContext(context.Background(), ep)
+	if !p.IsSuccessful() || p.Bandwidth == nil {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	d := p.Bandwidth
+	if d.Server != version.Short() || d.RTT.Samples != 3 || d.RTT.AvgMs <= 0 || p.LatencyMs != d.RTT.AvgMs {
+		t.Fatalf("unexpected echoes %q %+v", d.Server, d.RTT)
+	}
+	if d.Download.Bytes == 0 || d.Download.DurationMs < 900 || len(d.Download.Intervals) == 0 {
+		t.Fatalf("unexpected download %+v", d.Download.TransferStats)
+	}
+	if d.Upload == nil || d.Upload.Bytes == 0 || len(d.Upload.Intervals) == 0 {
+		t.Fatalf("unexpected upload %+v", d.Upload)
+	}
+	if !strings.Contains(log.String(), "download to") || !strings.Contains(log.String(), "upload from") {
+		t.Fatalf("want both transfers logged, got %q", log.String())
+	}
+}
+
+func TestCheckBandwidth_NotAPeer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ep := domain.MustNewBandwidthEndpoint(strings.TrimPrefix(srv.URL, "http://"), domain.EndpointTypePublic, "web server")
+
+	p := Checker{}.CheckBandwidthWithContext(context.Background(), ep)
+	if p.Status != domain.StatusFail || !strings.Contains(p.Error, "not an rsvpck server") {
+		t.Fatalf("want a wrong-peer failure, got %v (%s)", p.Status, p.Error)
+	}
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := ln.Addr().String()
+	ln.Close()
+	ep = domain.MustNewBandwidthEndpoint(closed, domain.EndpointTypePublic, "nobody")
+	if p := (Checker{}).CheckBandwidthWithContext(context.Background(), ep); p.Status != domain.StatusConnectionRefused {
+		t.Fatalf("want connection refused, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestIntervalCounter(t *testing.T) {
+	c := newIntervalCounter()
+	t0 := time.Now()
+	at := func(ms int) time.Time { return t0.Add(time.Duration(ms) * time.Millisecond) }
+	c.add(100, at(0))
+	c.add(100, at(400))
+	c.add(100, at(1200)) // an 800 ms gap
+	c.add(100, at(2500)) // a 1300 ms gap
+	tr := c.finish(at(2800))
+
+	if tr.Bytes != 400 || tr.DurationMs != 2800 || tr.Stalls != 2 || tr.LongestStallMs != 1300 {
+		t.Fatalf("unexpected totals %+v", tr.TransferStats)
+	}
+	want := []domain.TransferStats{{Bytes: 200, DurationMs: 1000}, {Bytes: 100, DurationMs: 1000}, {Bytes: 100, DurationMs: 800}}
+	if len(tr.Intervals) != len(want) {
+		t.Fatalf("want %d intervals, got %+v", len(want), tr.Intervals)
+	}
+	for i := range want {
+		if tr.Intervals[i] != want[i] {
+			t.Errorf("interval %d = %+v, want %+v", i, tr.Intervals[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/version"
+)
+
+// CheckCaptivePortalWithContext fetches the endpoint's known plain-HTTP URL
+// directly and compares the answer with the expected one. A redirect, another
+// status or another body means something on the network answered instead;
+// private-range DNS answers for the host point the same way.
+func (c Checker) CheckCaptivePortalWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.Target, nil)
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid, err)
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("rsvpck/%s (network tester)", version.String()))
+	req.Header.Set("Cache-Control", "no-cache")
+
+	details := &domain.CaptivePortalDetails{}
+	if addrs, err := c.lookup(ctx, req.URL.Hostname()); err == nil {
+		for _, a := range privateAddrs(addrs) {
+			details.PrivateAddrs = append(details.PrivateAddrs, a.String())
+		}
+	}
+	if len(details.PrivateAddrs) > 0 {
+		details.Reasons = append(details.Reasons,
+			fmt.Sprintf("%s resolves to private address %s", req.URL.Hostname(), strings.Join(details.PrivateAddrs, ", ")))
+	}
+
+	// straight to the network: a proxy would hide the portal
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	defer t.CloseIdleConnections()
+	client := &http.Client{
+		Transport: t,
+		Timeout:   requestTimeOut,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latencyMs := time.Since(start).Seconds() * 1000
+	if err != nil {
+		info := classifyHTTPError(err, ctx.Err())
+		p := domain.NewFailedProbe(ep, info.Status,
+			domain.Errorf(info.ErrorCode, "captive portal check %q failed: %w", ep.Target, err))
+		if details.Detected() {
+			p.Captive = details
+		}
+		return p
+	}
+	defer resp.Body.Close()
+
+	opts := ep.Captive
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		details.LoginURL = resp.Header.Get("Location")
+		if loc, err := resp.Location(); err == nil {
+			details.LoginURL = loc.String()
+		}
+		details.Reasons = append(details.Reasons, fmt.Sprintf("redirected to %s", details.LoginURL))
+	case resp.StatusCode != opts.Status():
+		details.Reasons = append(details.Reasons,
+			fmt.Sprintf("got HTTP %d instead of %d", resp.StatusCode, opts.Status()))
+	default:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, domain.DefaultHTTPBodyLimit))
+		if err != nil {
+			details.Reasons = append(details.Reasons, fmt.Sprintf("reading body: %v", err))
+		} else if !opts.BodyMatches(string(body)) {
+			details.Reasons = append(details.Reasons, "response body replaced")
+		}
+	}
+
+	if !details.Detected() {
+		return domain.NewSuccessfulProbe(ep, latencyMs)
+	}
+	p := domain.NewFailedProbe(ep, domain.StatusCaptivePortal,
+		domain.Errorf(domain.ErrorCodeCaptivePortal, "captive portal: %s", strings.Join(details.Reasons, "; ")))
+	p.LatencyMs = latencyMs
+	p.Captive = details
+	return p
+}
+
+func (c Checker) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if c.lookupHost != nil {
+		return c.lookupHost(ctx, host)
+	}
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// privateAddrs keeps the RFC 1918 and unique-local answers, plus link-local
+// ones: no public name belongs there.
+func privateAddrs(addrs []netip.Addr) []netip.Addr {
+	var out []netip.Addr
+	for _, a := range addrs {
+		a = a.Unmap()
+		if a.IsPrivate() || a.IsLinkLocalUnicast() {
+			out = append(out, a)
+		}
+	}
+	return out
+}
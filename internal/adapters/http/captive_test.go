@@ -0,0 +1,61 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// cleanPage is what the stand-in portal checks serve when nothing intercepts.
+var cleanPage = domain.CaptivePortalOptions{ExpectBody: "success"}
+
+func TestCheckCaptivePortal(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clean", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("success\n")) })
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("<html>sign in</html>")) })
+	mux.Handle("/redirect", http.RedirectHandler("/login?continue=check", http.StatusFound))
+	mux.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := Checker{}.CheckCaptivePortalWithContext(context.Background(), testEndpoint(t, domain.NewCaptivePortalEndpoint, srv.URL+"/clean", cleanPage))
+	if !p.IsSuccessful() || p.Captive != nil {
+		t.Fatalf("want a clean pass, got %v (%s)", p.Status, p.Error)
+	}
+
+	cases := map[string]string{
+		"/login":    "response body replaced",
+		"/redirect": "redirected to " + srv.URL + "/login?continue=check",
+		"/teapot":   "got HTTP 418 instead of 200",
+	}
+	for path, reason := range cases {
+		p := Checker{}.CheckCaptivePortalWithContext(context.Background(), testEndpoint(t, domain.NewCaptivePortalEndpoint, srv.URL+path, cleanPage))
+		if p.Status != domain.StatusCaptivePortal || p.Captive == nil || !strings.Contains(p.Error, reason) {
+			t.Fatalf("%s: want captive portal %q, got %v (%s)", path, reason, p.Status, p.Error)
+		}
+	}
+	p = Checker{}.CheckCaptivePortalWithContext(context.Background(), testEndpoint(t, domain.NewCaptivePortalEndpoint, srv.URL+"/redirect", cleanPage))
+	if p.Captive.LoginURL != srv.URL+"/login?continue=check" {
+		t.Fatalf("want the login URL recorded, got %q", p.Captive.LoginURL)
+	}
+}
+
+func TestCheckCaptivePortal_PrivateDNS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("success")) }))
+	defer srv.Close()
+
+	// the portal's DNS answers with its own address; the check still reaches srv
+	c := Checker{lookupHost: func(context.Context, string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("203.0.113.7"), netip.MustParseAddr("10.10.0.1")}, nil
+	}}
+	p := c.CheckCaptivePortalWithContext(context.Background(), testEndpoint(t, domain.NewCaptivePortalEndpoint, srv.URL, cleanPage))
+	if p.Status != domain.StatusCaptivePortal || p.Captive == nil ||
+		len(p.Captive.PrivateAddrs) != 1 || p.Captive.PrivateAddrs[0] != "10.10.0.1" {
+		t.Fatalf("want a private-address finding, got %v (%s) %+v", p.Status, p.Error, p.Captive)
+	}
+}
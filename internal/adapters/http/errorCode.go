@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"errors"
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
 	"github.com/azargarov/rsvpck/internal/domain"
 	"net"
 	"strings"
@@ -25,6 +26,21 @@ func classifyHTTPError(err, contextErr error) httpErrorInfo {
 		}
 	}
 
+	if _, ok := httpx.AsCertError(err); ok {
+		return httpErrorInfo{
+			Status:    domain.StatusCertInvalid,
+			ErrorCode: domain.ErrorCodeCertInvalid,
+		}
+	}
+
+	var socksErr *httpx.SOCKSError
+	if errors.As(err, &socksErr) {
+		return httpErrorInfo{
+			Status:    domain.StatusConnectionRefused,
+			ErrorCode: domain.ErrorCodeConnectionRefused,
+		}
+	}
+
 	var netErr net.Error
 	if errors.As(err, &netErr) {
 		if netErr.Timeout() {
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// checkResponse turns resp into a probe, failing it on any unmet expectation.
+func checkResponse(ep domain.Endpoint, resp *http.Response, latencyMs float64) domain.Probe {
+	status, errs := verifyResponse(ep, resp, latencyMs)
+	details := &domain.HTTPDetails{StatusCode: resp.StatusCode}
+
+	var p domain.Probe
+	if len(errs) == 0 {
+		p = domain.NewSuccessfulProbe(ep, latencyMs)
+	} else {
+		for _, err := range errs {
+			details.Failures = append(details.Failures, err.Error())
+		}
+		p = domain.NewFailedProbe(ep, status, domain.JoinErrors(errs...))
+	}
+	p.HTTP = details
+	return p
+}
+
+// verifyResponse matches resp against the endpoint's expectations. Every
+// unmet expectation is reported, not only the first one; the status is the
+// one the probe fails with.
+func verifyResponse(ep domain.Endpoint, resp *http.Response, latencyMs float64) (domain.Status, []error) {
+	exp := ep.HTTP.Expect
+
+	var errs []error
+	status := domain.StatusHTTPMismatch
+	if !exp.StatusAllowed(resp.StatusCode) {
+		status = domain.StatusHTTPError
+		msg := fmt.Sprintf("HTTP request to %q returned %s", ep.Target, resp.Status)
+		if len(exp.Statuses) > 0 {
+			msg += fmt.Sprintf(" (expected %s)", exp.StatusString())
+		}
+		errs = append(errs, domain.Errorf(statusErrorCode(resp.StatusCode), "%s", msg))
+	}
+	if final := resp.Request.URL; !ep.HTTP.HostAllowed(final.Hostname()) {
+		errs = append(errs, domain.Errorf(domain.ErrorCodeHTTPRedirectNotAllowed,
+			"ended up at %s, host %q is not allowed", final, final.Hostname()))
+	}
+	for _, h := range exp.RequireHeaders {
+		if !h.Matches(resp.Header.Values(h.Name)) {
+			errs = append(errs, domain.Errorf(domain.ErrorCodeHTTPHeaderMismatch,
+				"required header %q missing", h.String()))
+		}
+	}
+	for _, h := range exp.ForbidHeaders {
+		if h.Matches(resp.Header.Values(h.Name)) {
+			errs = append(errs, domain.Errorf(domain.ErrorCodeHTTPHeaderMismatch,
+				"forbidden header %q present", h.String()))
+		}
+	}
+	if exp.ChecksBody() {
+		if err := checkBody(exp, resp.Body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if exp.MaxLatencyMs > 0 && latencyMs > exp.MaxLatencyMs {
+		errs = append(errs, domain.Errorf(domain.ErrorCodeHTTPTooSlow,
+			"response took %.0f ms, more than %.0f ms allowed", latencyMs, exp.MaxLatencyMs))
+	}
+	return status, errs
+}
+
+// checkBody reads up to the expectation's limit and looks for the pattern there.
+func checkBody(exp domain.HTTPExpect, body io.Reader) error {
+	limit := exp.Limit()
+	b, err := io.ReadAll(io.LimitReader(body, limit))
+	if err != nil {
+		return domain.Errorf(domain.ErrorCodeHTTPBodyMismatch, "reading body: %w", err)
+	}
+	if exp.BodyContains != "" && !strings.Contains(string(b), exp.BodyContains) {
+		return domain.Errorf(domain.ErrorCodeHTTPBodyMismatch,
+			"body does not contain %q (first %d bytes read)", exp.BodyContains, limit)
+	}
+	if exp.BodyRegex != nil && !exp.BodyRegex.Match(b) {
+		return domain.Errorf(domain.ErrorCodeHTTPBodyMismatch,
+			"body does not match /%s/ (first %d bytes read)", exp.BodyRegex, limit)
+	}
+	return nil
+}
+
+func statusErrorCode(code int) domain.ErrorCode {
+	switch {
+	case code == http.StatusProxyAuthRequired:
+		return domain.ErrorCodeProxyAuthRequired
+	case code >= 500:
+		return domain.ErrorCodeHTTPBadStatus
+	case code >= 400:
+		return domain.ErrorCodeHTTPClientError
+	default:
+		return domain.ErrorCodeHTTPUnexpectedStatus
+	}
+}
@@ -1,13 +1,20 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
 	"github.com/azargarov/rsvpck/internal/domain"
 	"github.com/azargarov/rsvpck/internal/version"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
-	//"net"
+	"strings"
 	"time"
 	"fmt"
 )
@@ -16,7 +23,10 @@ const (
 	requestTimeOut = 1 * time.Second
 )
 
-type Checker struct{}
+type Checker struct {
+	rootCAs    *x509.CertPool // nil means the system trust store
+	lookupHost func(ctx context.Context, host string) ([]netip.Addr, error) // nil means the system resolver
+}
 
 var _ domain.HTTPChecker = (*Checker)(nil)
 
@@ -41,14 +51,16 @@ func (c Checker) CheckViaProxyWithContext(ctx context.Context, ep domain.Endpoin
 func (c Checker) doRequest(ctx context.Context, ep domain.Endpoint, proxyURL *url.URL) domain.Probe {
 
 	//proxyURL = nil
-	var transport http.RoundTripper = http.DefaultTransport
+	timer := &phaseTimer{}
+	var proxy *domain.ProxyDetails
 	if proxyURL != nil {
-		t := http.DefaultTransport.(*http.Transport).Clone()
-		t.Proxy = func(*http.Request) (*url.URL, error) {
-			return proxyURL, nil
-		}
-		transport = t
+		proxy = &domain.ProxyDetails{URL: proxyURL.Redacted()}
 	}
+	t, transport, handshake, err := c.newTransport(ep, proxyURL, timer, proxy)
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid, err)
+	}
+	defer t.CloseIdleConnections()
 
 	//var dialer = &net.Dialer{Timeout: requestTimeOut}
 	//var fastResolver = &net.Resolver{
@@ -71,11 +83,11 @@ func (c Checker) doRequest(ctx context.Context, ep domain.Endpoint, proxyURL *ur
 		Transport: transport,
 		Timeout:   requestTimeOut, 
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse // don't follow redirects
+			return http.ErrUseLastResponse // send follows them itself, if asked to
 		},
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", ep.Target, nil)
+	req, err := newRequest(ctx, ep)
 	if err != nil {
 		info := classifyHTTPError(err, ctx.Err())
 		detailedErr := domain.Errorf(
@@ -90,51 +102,205 @@ func (c Checker) doRequest(ctx context.Context, ep domain.Endpoint, proxyURL *ur
 	}
 
 	// a user-agent to avoid 403s
-	req.Header.Set("User-Agent", fmt.Sprintf( "rsvpck/%s (network tester)", version.String()))
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", fmt.Sprintf( "rsvpck/%s (network tester)", version.String()))
+	}
 
 	start := time.Now()
-	resp, err := client.Do(req)
+	resp, hops, err := send(client, req, ep.HTTP, timer)
 	latencyMs := time.Since(start).Seconds() * 1000
 
+	tooManyRedirects := domain.IsErrorCode(err, domain.ErrorCodeHTTPTooManyRedirects)
+	if proxy != nil {
+		stageErr := err
+		if tooManyRedirects {
+			stageErr = nil // the proxy relayed every hop, the target kept redirecting
+		}
+		proxy.Stages = timer.proxyStages(proxyURL, resp, stageErr)
+	}
+	if tooManyRedirects {
+		p := domain.NewFailedProbe(ep, domain.StatusHTTPMismatch, err)
+		p.HTTP = &domain.HTTPDetails{Timing: timer.timing(), Hops: hops}
+		p.Proxy = proxy
+		return p
+	}
 	if err != nil {
 		info := classifyHTTPError(err, ctx.Err())
 		detailedErr := domain.Errorf(
 			info.ErrorCode,
 			"HTTP test failed for %q: %w", ep.Target, err,
 		)
-		return domain.NewFailedProbe(
+		status := info.Status
+		stage, failed := failedStage(proxy)
+		if failed {
+			status = stage.FailureStatus(status)
+			detailedErr = domain.Errorf(info.ErrorCode, "%s: %w", proxy.Verdict(), detailedErr)
+		}
+		p := domain.NewFailedProbe(
 			ep,
-			info.Status,
+			status,
 			detailedErr,
 		)
+		// the phases that did complete still tell where the time went
+		p.HTTP = &domain.HTTPDetails{Timing: timer.timing(), Hops: hops}
+		p.Proxy = proxy
+		if ce, ok := httpx.AsCertError(err); ok && !failed {
+			p.TLS = ce.Details(req.URL.Hostname())
+		}
+		return p
 	}
 	defer resp.Body.Close()
 
-	// TODO: Consider 2xx and 3xx (redirects) as success for connectivity
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		return domain.NewSuccessfulProbe(
-			ep,
-			latencyMs,
-		)
+	p := checkResponse(ep, resp, latencyMs)
+	p.HTTP.Timing = timer.timing()
+	p.HTTP.Hops = hops
+	p.Proxy = proxy
+	if stage, failed := failedStage(proxy); failed && !p.IsSuccessful() {
+		p.Status = stage.FailureStatus(p.Status)
+	}
+	if resp.TLS != nil {
+		p.TLS = domain.NewTLSDetails(resp.TLS.ServerName, resp.TLS.PeerCertificates)
+		handshake.Describe(p.TLS)
+		httpx.DescribeSession(p.TLS, *resp.TLS)
+		if err := handshake.VerifyError(); err != nil && p.IsSuccessful() {
+			p.MarkWarning(domain.Errorf(domain.ErrorCodeTLSFailed, "insecure mode, certificate not trusted: %w", err))
+		}
+		p.CheckTLSPolicy(ep.TLS, time.Now())
+	}
+	if proxy != nil && proxy.TLS != nil && proxy.TLS.VerifyError != "" && p.IsSuccessful() {
+		p.MarkWarning(domain.Errorf(domain.ErrorCodeTLSFailed, "insecure mode, proxy certificate not trusted: %s", proxy.TLS.VerifyError))
 	}
-	var errorCode domain.ErrorCode
+	return p
+}
+
+// newTransport returns a fresh transport for one probe of ep, so every phase
+// is measured on a new connection, and the RoundTripper to send through.
+// Through a proxy, the dialing is recorded into timer and proxy.
+func (c Checker) newTransport(ep domain.Endpoint, proxyURL *url.URL, timer *phaseTimer, proxy *domain.ProxyDetails) (*http.Transport, http.RoundTripper, *httpx.Handshake, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.OnProxyConnectResponse = timer.proxyConnected
+	trust, err := httpx.LoadTrustWithRoots(ep.TLS, c.rootCAs)
+	if err != nil {
+		return nil, nil, nil, domain.Errorf(domain.ErrorCodeInvalidConfig, "TLS settings: %w", err)
+	}
+	handshake := &httpx.Handshake{}
+	t.TLSClientConfig = trust.ClientConfig("", handshake)
+	var transport http.RoundTripper = t
 	switch {
-	case resp.StatusCode == 407:
-		errorCode = domain.ErrorCodeProxyAuthRequired
-	case resp.StatusCode >= 500:
-		errorCode = domain.ErrorCodeHTTPBadStatus
-	case resp.StatusCode >= 400:
-		errorCode = domain.ErrorCodeHTTPClientError
-	default:
-		errorCode = domain.ErrorCodeHTTPBadStatus
-	}
-	detailedErr := domain.Errorf(
-		errorCode,
-		"HTTP request to %q returned %s", ep.Target, resp.Status,
-	)
-	return domain.NewFailedProbe(
-		ep,
-		domain.StatusHTTPError,
-		detailedErr,
-	)
+	case proxyURL != nil && (httpx.IsSOCKSProxy(proxyURL.String()) || targetScheme(ep) == "https"):
+		// tunnels are dialed by httpx, which reports each stage; the transport
+		// sees a plain connection to the target
+		opts, err := proxyOptions(ep, proxyURL, timer, proxy)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		raw := proxyURL.String()
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			conn, err := httpx.DialViaProxyWithOptions(ctx, raw, addr, opts)
+			if err == nil {
+				timer.mark(&timer.proxyDone)
+			}
+			return conn, err
+		}
+	case proxyURL != nil:
+		// a plain-http target is forwarded, not tunneled; proxyAuthTransport
+		// authorizes it, and a redirect to https gets Basic for its CONNECT
+		bare := *proxyURL
+		bare.User = nil
+		t.Proxy = func(*http.Request) (*url.URL, error) {
+			return &bare, nil
+		}
+		if authz, _ := httpx.ProxyAuthorization(proxyURL, nil, http.MethodConnect, ""); authz != "" {
+			t.ProxyConnectHeader = http.Header{"Proxy-Authorization": {authz}}
+		}
+		transport = proxyAuthTransport{base: t, proxyURL: proxyURL}
+		opts, err := proxyOptions(ep, proxyURL, timer, proxy)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		raw := proxyURL.String()
+		dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, err := httpx.DialProxy(ctx, raw, opts)
+			if err != nil {
+				return nil, err
+			}
+			// hide a *tls.Conn, or the transport takes the proxy's handshake for the target's
+			return struct{ net.Conn }{conn}, nil
+		}
+		if proxyURL.Scheme == "https" {
+			t.DialTLSContext = dial
+		} else {
+			t.DialContext = dial
+		}
+	}
+	return t, transport, handshake, nil
+}
+
+// proxyOptions sets up the dialing of proxyURL: an https:// proxy is verified
+// by the endpoint's proxy trust, and its handshake and every stage of getting
+// through it are recorded into details.
+func proxyOptions(ep domain.Endpoint, proxyURL *url.URL, timer *phaseTimer, details *domain.ProxyDetails) (httpx.ProxyOptions, error) {
+	trust, err := httpx.LoadTrust(ep.ProxyTLS())
+	if err != nil {
+		return httpx.ProxyOptions{}, fmt.Errorf("proxy TLS settings: %w", err)
+	}
+	handshake := &httpx.Handshake{}
+	return httpx.ProxyOptions{
+		Trust:     trust,
+		Handshake: handshake,
+		OnTLS: func(state tls.ConnectionState) {
+			timer.mark(&timer.proxyTLSDone)
+			details.TLS = domain.NewTLSDetails(proxyURL.Hostname(), state.PeerCertificates)
+			handshake.Describe(details.TLS)
+		},
+		OnStage: timer.addStage,
+	}, nil
+}
+
+func failedStage(proxy *domain.ProxyDetails) (domain.ProxyStage, bool) {
+	if proxy == nil {
+		return domain.ProxyStage{}, false
+	}
+	return domain.FailedProxyStage(proxy.Stages)
+}
+
+// targetScheme is the scheme of the first request; a proxy tunnels https
+// and forwards plain http.
+func targetScheme(ep domain.Endpoint) string {
+	target := ep.Target
+	if ep.HTTP.Request.URL != "" {
+		target = ep.HTTP.Request.URL
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme
+}
+
+// newRequest builds the request from the endpoint's template. Host is not a
+// regular header in net/http and goes to req.Host instead.
+func newRequest(ctx context.Context, ep domain.Endpoint) (*http.Request, error) {
+	tmpl := ep.HTTP.Request
+	target := ep.Target
+	if tmpl.URL != "" {
+		target = tmpl.URL
+	}
+	var body io.Reader
+	if len(tmpl.Body) > 0 {
+		body = bytes.NewReader(tmpl.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, tmpl.MethodOrGet(), target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range tmpl.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
 }
@@ -0,0 +1,416 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/testutil"
+)
+
+func portalServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Portal", "guest-wifi")
+		_, _ = w.Write([]byte("<html>Please log in</html>"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testEndpoint builds a public endpoint with newEndpoint and sets opts on
+// it: an HTTPExpect, CaptivePortalOptions or ThroughputOptions.
+func testEndpoint(t *testing.T, newEndpoint func(string, domain.EndpointType, string) (domain.Endpoint, error), url string, opts any) domain.Endpoint {
+	t.Helper()
+	ep, err := newEndpoint(url, domain.EndpointTypePublic, "test")
+	if err != nil {
+		t.Fatalf("endpoint: %v", err)
+	}
+	switch o := opts.(type) {
+	case domain.HTTPExpect:
+		ep.SetHTTPOptions(domain.HTTPOptions{Expect: o})
+	case domain.CaptivePortalOptions:
+		ep.SetCaptivePortalOptions(o)
+	case domain.ThroughputOptions:
+		ep.SetThroughputOptions(o)
+	default:
+		t.Fatalf("endpoint: unexpected options %T", opts)
+	}
+	return ep
+}
+
+func TestCheck_DefaultAcceptsAny2xx(t *testing.T) {
+	srv := portalServer(t)
+	p := Checker{}.CheckWithContext(context.Background(), testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{}))
+	if !p.IsSuccessful() || p.HTTP == nil || p.HTTP.StatusCode != http.StatusOK {
+		t.Fatalf("want success with status 200, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheck_Expectations(t *testing.T) {
+	srv := portalServer(t)
+	cases := []struct {
+		name   string
+		exp    domain.HTTPExpect
+		status domain.Status
+		code   domain.ErrorCode
+	}{
+		{"status", domain.HTTPExpect{Statuses: []domain.HTTPStatusRange{{Min: 204, Max: 204}}},
+			domain.StatusHTTPError, domain.ErrorCodeHTTPUnexpectedStatus},
+		{"body substring", domain.HTTPExpect{BodyContains: "Microsoft NCSI"},
+			domain.StatusHTTPMismatch, domain.ErrorCodeHTTPBodyMismatch},
+		{"body regex", domain.HTTPExpect{BodyRegex: regexp.MustCompile(`^success$`)},
+			domain.StatusHTTPMismatch, domain.ErrorCodeHTTPBodyMismatch},
+		{"body beyond limit", domain.HTTPExpect{BodyContains: "log in", BodyLimit: 8},
+			domain.StatusHTTPMismatch, domain.ErrorCodeHTTPBodyMismatch},
+		{"required header", domain.HTTPExpect{RequireHeaders: []domain.HTTPHeaderMatch{{Name: "Server"}}},
+			domain.StatusHTTPMismatch, domain.ErrorCodeHTTPHeaderMismatch},
+		{"forbidden header", domain.HTTPExpect{ForbidHeaders: []domain.HTTPHeaderMatch{{Name: "X-Portal", Value: "guest"}}},
+			domain.StatusHTTPMismatch, domain.ErrorCodeHTTPHeaderMismatch},
+		{"too slow", domain.HTTPExpect{MaxLatencyMs: 0.000001},
+			domain.StatusHTTPMismatch, domain.ErrorCodeHTTPTooSlow},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Checker{}.CheckWithContext(context.Background(), testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, tc.exp))
+			if p.Status != tc.status {
+				t.Fatalf("want %v, got %v (%s)", tc.status, p.Status, p.Error)
+			}
+			if p.HTTP == nil || len(p.HTTP.Failures) != 1 {
+				t.Fatalf("want one recorded failure, got %+v", p.HTTP)
+			}
+			if !domain.IsErrorCode(checkErr(t, srv, tc.exp), tc.code) {
+				t.Fatalf("want error code %v for %q", tc.code, p.Error)
+			}
+		})
+	}
+}
+
+func TestCheck_ReportsEveryFailure(t *testing.T) {
+	srv := portalServer(t)
+	exp := domain.HTTPExpect{
+		BodyContains:  "success",
+		ForbidHeaders: []domain.HTTPHeaderMatch{{Name: "X-Portal"}},
+	}
+	p := Checker{}.CheckWithContext(context.Background(), testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, exp))
+	if p.HTTP == nil || len(p.HTTP.Failures) != 2 {
+		t.Fatalf("want two failures, got %+v", p.HTTP)
+	}
+	err := checkErr(t, srv, exp)
+	if !domain.IsErrorCode(err, domain.ErrorCodeHTTPBodyMismatch) || !domain.IsErrorCode(err, domain.ErrorCodeHTTPHeaderMismatch) {
+		t.Fatalf("want both error codes in %v", err)
+	}
+}
+
+// checkErr verifies a fresh response directly to get at the error values,
+// which the probe only keeps as strings.
+func checkErr(t *testing.T, srv *httptest.Server, exp domain.HTTPExpect) error {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	_, errs := verifyResponse(testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, exp), resp, 1)
+	return domain.JoinErrors(errs...)
+}
+
+func TestCheck_Timing(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+	c := Checker{rootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+
+	p := c.CheckWithContext(context.Background(), testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{}))
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	tm := p.HTTP.Timing
+	if tm.ConnectMs <= 0 || tm.TLSMs <= 0 || tm.TTFBMs < 20 || tm.ProxyConnectMs != 0 {
+		t.Fatalf("unexpected direct timing %+v", tm)
+	}
+
+	proxy := testutil.NewConnectProxy(t)
+	p = c.CheckViaProxyWithContext(context.Background(), testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{}), proxy.URL)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success via proxy, got %v (%s)", p.Status, p.Error)
+	}
+	if tm := p.HTTP.Timing; tm.ProxyConnectMs <= 0 || tm.TLSMs <= 0 {
+		t.Fatalf("want CONNECT and TLS phases via proxy, got %+v", tm)
+	}
+}
+
+func TestCheck_FollowRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusMovedPermanently))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "ok") })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL+"/a", domain.HTTPExpect{BodyContains: "ok"})
+	ep.HTTP.FollowRedirects = true
+	p := Checker{}.CheckWithContext(context.Background(), ep)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	hops := p.HTTP.Hops
+	if len(hops) != 3 || hops[0].StatusCode != http.StatusFound || hops[1].StatusCode != http.StatusMovedPermanently ||
+		hops[2].StatusCode != http.StatusOK || hops[2].URL != srv.URL+"/c" {
+		t.Fatalf("unexpected chain %+v", hops)
+	}
+
+	ep.HTTP.MaxRedirects = 1
+	p = Checker{}.CheckWithContext(context.Background(), ep)
+	if p.Status != domain.StatusHTTPMismatch || len(p.HTTP.Hops) != 2 {
+		t.Fatalf("want hop limit failure after two responses, got %v (%s) %+v", p.Status, p.Error, p.HTTP.Hops)
+	}
+	// through a proxy the stages still show it relayed every hop
+	proxy := testutil.NewPolicyProxy(t, func(*http.Request) int { return 0 })
+	p = Checker{}.CheckViaProxyWithContext(context.Background(), ep, proxy.URL)
+	if p.Status != domain.StatusHTTPMismatch || p.Proxy == nil || len(p.Proxy.Stages) == 0 || p.Proxy.Verdict() != "" {
+		t.Fatalf("want hop limit failure with passing proxy stages, got %v (%s) %+v", p.Status, p.Error, p.Proxy)
+	}
+
+	// without following, the redirect itself is the answer
+	ep = testEndpoint(t, domain.NewHTTPEndpoint, srv.URL+"/a", domain.HTTPExpect{})
+	p = Checker{}.CheckWithContext(context.Background(), ep)
+	if !p.IsSuccessful() || p.HTTP.StatusCode != http.StatusFound || len(p.HTTP.Hops) != 0 {
+		t.Fatalf("want the 302 accepted as is, got %v %+v", p.Status, p.HTTP)
+	}
+}
+
+func TestCheck_RedirectToDisallowedHost(t *testing.T) {
+	block := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "Access denied by policy")
+	}))
+	defer block.Close()
+	blockURL := strings.Replace(block.URL, "127.0.0.1", "localhost", 1)
+	srv := httptest.NewServer(http.RedirectHandler(blockURL+"/blocked", http.StatusFound))
+	defer srv.Close()
+
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{})
+	ep.HTTP.FollowRedirects = true
+	ep.HTTP.AllowedHosts = []string{"127.0.0.1"}
+	p := Checker{}.CheckWithContext(context.Background(), ep)
+	if p.Status != domain.StatusHTTPMismatch || !strings.Contains(p.Error, `host "localhost" is not allowed`) {
+		t.Fatalf("want disallowed host failure, got %v (%s)", p.Status, p.Error)
+	}
+	if len(p.HTTP.Hops) != 2 {
+		t.Fatalf("want both hops recorded, got %+v", p.HTTP.Hops)
+	}
+}
+
+func TestCheck_RequestTemplate(t *testing.T) {
+	type seen struct{ method, host, auth, body string }
+	got := make(chan seen, 2)
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/health", http.StatusTemporaryRedirect))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got <- seen{r.Method, r.Host, r.Header.Get("Authorization"), string(b)}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL+"/old", domain.HTTPExpect{})
+	ep.HTTP.FollowRedirects = true
+	ep.HTTP.Request = domain.Request{
+		Method:  http.MethodPost,
+		Headers: map[string]string{"Authorization": "Bearer t0ken", "Host": "backend.internal"},
+		Body:    []byte(`{"ping":true}`),
+	}
+	p := Checker{}.CheckWithContext(context.Background(), ep)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	// the 307 must repeat the request, body included
+	want := seen{http.MethodPost, "backend.internal", "Bearer t0ken", `{"ping":true}`}
+	if s := <-got; s != want {
+		t.Fatalf("server saw %+v, want %+v", s, want)
+	}
+}
+
+func TestCheckViaProxy_SOCKS5(t *testing.T) {
+	srv := portalServer(t)
+	proxy := testutil.NewSOCKS5Server(t, "alice", "s3cret")
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{BodyContains: "log in"})
+
+	p := Checker{}.CheckViaProxyWithContext(context.Background(), ep, proxy.URL("socks5h"))
+	if !p.IsSuccessful() {
+		t.Fatalf("want success via SOCKS, got %v (%s)", p.Status, p.Error)
+	}
+	if len(proxy.Requests()) != 1 || p.HTTP.Timing.ProxyConnectMs <= 0 {
+		t.Fatalf("want one tunnel with its handshake timed, got %v %+v", proxy.Requests(), p.HTTP.Timing)
+	}
+
+	p = Checker{}.CheckViaProxyWithContext(context.Background(), ep, "socks5://alice:wrong@"+proxy.Addr)
+	if p.Status != domain.StatusProxyAuth {
+		t.Fatalf("want proxy auth failure, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheck_HTTPSProxy(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	c := Checker{rootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	proxy, caFile := testutil.NewTLSConnectProxy(t)
+
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{BodyContains: "ok"})
+	ep.SetProxy(proxy.URL)
+	ep.Proxy.SetCAFile(caFile)
+	p := c.CheckViaProxyWithContext(context.Background(), ep, proxy.URL)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success via https proxy, got %v (%s)", p.Status, p.Error)
+	}
+	if p.Proxy == nil || p.Proxy.TLS == nil || len(p.Proxy.TLS.Certificates) == 0 {
+		t.Fatalf("want the proxy's certificates, got %+v", p.Proxy)
+	}
+	if tm := p.HTTP.Timing; tm.ProxyTLSMs <= 0 || tm.ProxyConnectMs <= 0 || tm.TLSMs <= 0 {
+		t.Fatalf("want proxy TLS, CONNECT and target TLS phases, got %+v", tm)
+	}
+
+	// plain http targets go through the TLS connection as absolute-URI requests
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer plain.Close()
+	ep = testEndpoint(t, domain.NewHTTPEndpoint, plain.URL, domain.HTTPExpect{BodyContains: "ok"})
+	ep.Proxy.SetCAFile(caFile)
+	if p := c.CheckViaProxyWithContext(context.Background(), ep, proxy.URL); !p.IsSuccessful() || p.Proxy == nil {
+		t.Fatalf("want http target via https proxy, got %v (%s)", p.Status, p.Error)
+	}
+
+	// without the CA file the proxy cannot be verified
+	ep = testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{})
+	p = c.CheckViaProxyWithContext(context.Background(), ep, proxy.URL)
+	if p.IsSuccessful() || !strings.Contains(p.Error, "proxy TLS handshake failed") {
+		t.Fatalf("want proxy verification failure, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckViaProxy_Stages(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer plain.Close()
+	c := Checker{rootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+
+	cases := []struct {
+		name    string
+		target  string
+		code    int
+		status  domain.Status
+		verdict string
+	}{
+		{"tunnel", srv.URL, 0, domain.StatusPass, ""},
+		{"tunnel auth", srv.URL, http.StatusProxyAuthRequired, domain.StatusProxyAuth, "proxy needs auth"},
+		{"tunnel blocked", srv.URL, http.StatusForbidden, domain.StatusProxyBlocked, "proxy blocks the target"},
+		{"forwarded", plain.URL, 0, domain.StatusPass, ""},
+		{"forwarded auth", plain.URL, http.StatusProxyAuthRequired, domain.StatusProxyAuth, "proxy needs auth"},
+		{"forwarded upstream", plain.URL, http.StatusBadGateway, domain.StatusHTTPError, "target unreachable through the proxy"},
+	}
+	for _, tc := range cases {
+		proxy := testutil.NewPolicyProxy(t, func(*http.Request) int { return tc.code })
+		p := c.CheckViaProxyWithContext(context.Background(), testEndpoint(t, domain.NewHTTPEndpoint, tc.target, domain.HTTPExpect{}), proxy.URL)
+		if p.Status != tc.status {
+			t.Errorf("%s: status %v, want %v (%s)", tc.name, p.Status, tc.status, p.Error)
+		}
+		if p.Proxy == nil || len(p.Proxy.Stages) == 0 {
+			t.Fatalf("%s: want proxy stages, got %+v", tc.name, p.Proxy)
+		}
+		if got := p.Proxy.Verdict(); got != tc.verdict {
+			t.Errorf("%s: verdict %q, want %q (%v)", tc.name, got, tc.verdict, p.Proxy.Stages)
+		}
+		if last := p.Proxy.Stages[len(p.Proxy.Stages)-1]; tc.verdict == "" && (last.Name != domain.ProxyStageTarget || last.Detail != "HTTP 200 OK") {
+			t.Errorf("%s: want the target stage last, got %v", tc.name, p.Proxy.Stages)
+		}
+	}
+}
+
+func TestCheckViaProxy_Digest(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer plain.Close()
+	c := Checker{rootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	proxy := testutil.NewDigestProxy(t, "alice", "s3cret")
+	host := strings.TrimPrefix(proxy.URL, "http://")
+
+	// tunnelled and forwarded requests both answer the Digest challenge
+	for _, target := range []string{srv.URL, plain.URL} {
+		ep := testEndpoint(t, domain.NewHTTPEndpoint, target, domain.HTTPExpect{BodyContains: "ok"})
+		if p := c.CheckViaProxyWithContext(context.Background(), ep, "http://alice:s3cret@"+host); !p.IsSuccessful() {
+			t.Fatalf("%s: want success with Digest credentials, got %v (%s)", target, p.Status, p.Error)
+		}
+		p := c.CheckViaProxyWithContext(context.Background(), ep, proxy.URL)
+		if p.Status != domain.StatusProxyAuth {
+			t.Fatalf("%s: want proxy auth failure, got %v (%s)", target, p.Status, p.Error)
+		}
+		if s, _ := domain.FailedProxyStage(p.Proxy.Stages); !strings.Contains(s.Detail, `Digest realm="corp"`) {
+			t.Fatalf("%s: want the offered schemes, got %v", target, p.Proxy.Stages)
+		}
+	}
+}
+
+func TestCheck_TLSTrust(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	// the test server's certificate is its own root
+	caFile := testutil.WriteCertPEM(t, "ca.pem", srv.Certificate())
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{})
+	ep.SetTLSOptions(domain.TLSOptions{CAFile: caFile})
+	p := Checker{}.CheckWithContext(context.Background(), ep)
+	if !p.IsSuccessful() || p.TLS == nil || !strings.HasSuffix(p.TLS.TrustAnchor, "("+caFile+")") {
+		t.Fatalf("want a pass naming %s, got %v (%s) %+v", caFile, p.Status, p.Error, p.TLS)
+	}
+
+	ep.SetTLSOptions(domain.TLSOptions{Insecure: true})
+	p = Checker{}.CheckWithContext(context.Background(), ep)
+	if !p.IsWarning() || p.TLS == nil || p.TLS.VerifyError == "" || !strings.Contains(p.Error, "insecure mode") {
+		t.Fatalf("want a warning for the untrusted chain, got %v (%s) %+v", p.Status, p.Error, p.TLS)
+	}
+
+	ep.SetTLSOptions(domain.TLSOptions{})
+	p = Checker{}.CheckWithContext(context.Background(), ep)
+	if p.Status != domain.StatusCertInvalid || p.TLS == nil || p.TLS.Problem != domain.CertUnknownAuthority || len(p.TLS.Certificates) == 0 {
+		t.Fatalf("want an unknown authority against the system store, got %v (%s) %+v", p.Status, p.Error, p.TLS)
+	}
+}
+
+func TestCheck_Pins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	caFile := testutil.WriteCertPEM(t, "ca.pem", srv.Certificate())
+	spki := domain.SPKIFingerprint(srv.Certificate())
+
+	ep := testEndpoint(t, domain.NewHTTPEndpoint, srv.URL, domain.HTTPExpect{})
+	ep.SetTLSOptions(domain.TLSOptions{CAFile: caFile, Pins: domain.CertPins{SPKI: []string{strings.Repeat("0", 64), spki}}})
+	if p := (Checker{}).CheckWithContext(context.Background(), ep); !p.IsSuccessful() {
+		t.Fatalf("want the rotated-in pin to match, got %v (%s)", p.Status, p.Error)
+	}
+
+	ep.SetTLSOptions(domain.TLSOptions{CAFile: caFile, Pins: domain.CertPins{SPKI: []string{strings.Repeat("0", 64)}}})
+	p := Checker{}.CheckWithContext(context.Background(), ep)
+	if p.Status != domain.StatusPinMismatch || !strings.Contains(p.Error, domain.SPKIPin(spki)) {
+		t.Fatalf("want a pin mismatch naming the presented SPKI, got %v (%s)", p.Status, p.Error)
+	}
+}
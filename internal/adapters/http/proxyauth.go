@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// proxyAuthTransport answers the proxy for the requests it forwards, to
+// plain-http targets: Basic up front, and Digest once the proxy asks for it,
+// which net/http does not do. Tunnels are authorized by httpx.
+type proxyAuthTransport struct {
+	base     http.RoundTripper
+	proxyURL *url.URL // with the credentials
+}
+
+func (t proxyAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" {
+		return t.base.RoundTrip(req)
+	}
+	// the request target as net/http writes it to a proxy, in absolute form
+	uri := req.URL.Scheme + "://" + req.URL.Host + req.URL.RequestURI()
+	authz, _ := httpx.ProxyAuthorization(t.proxyURL, nil, req.Method, uri)
+	resp, err := t.base.RoundTrip(withProxyAuth(req, authz))
+	if err != nil || resp.StatusCode != http.StatusProxyAuthRequired {
+		return resp, err
+	}
+
+	challenges := httpx.ParseChallenges(resp.Header.Values("Proxy-Authenticate"))
+	if !offersDigest(challenges) || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	authz, err = httpx.ProxyAuthorization(t.proxyURL, challenges, req.Method, uri)
+	if err != nil {
+		return resp, nil // the 407 says it better
+	}
+	retry := withProxyAuth(req, authz)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	_ = resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
+
+func offersDigest(challenges []domain.AuthChallenge) bool {
+	for _, c := range challenges {
+		if c.Is("Digest") {
+			return true
+		}
+	}
+	return false
+}
+
+// withProxyAuth is a copy of req carrying authz, as a RoundTripper must not
+// change the request it is given.
+func withProxyAuth(req *http.Request, authz string) *http.Request {
+	r := req.Clone(req.Context())
+	if authz != "" {
+		r.Header.Set("Proxy-Authorization", authz)
+	}
+	return r
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// send issues req and, if the endpoint asks for it, follows redirects by
+// hand so that every hop is timed. The timer describes the last request.
+// Past the redirect limit the last, drained response comes back with the
+// error, so the caller can still tell how the request got there.
+func send(client *http.Client, req *http.Request, opts domain.HTTPOptions, timer *phaseTimer) (*http.Response, []domain.HTTPHop, error) {
+	var hops []domain.HTTPHop
+	for {
+		timer.reset()
+		traced := req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+
+		start := time.Now()
+		resp, err := client.Do(traced)
+		if err != nil {
+			return nil, hops, err
+		}
+		if !opts.FollowRedirects {
+			return resp, nil, nil
+		}
+		hops = append(hops, domain.HTTPHop{
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			LatencyMs:  time.Since(start).Seconds() * 1000,
+		})
+
+		next := redirectTarget(resp)
+		if next == nil {
+			return resp, hops, nil
+		}
+		drain(resp)
+		if len(hops) > opts.RedirectLimit() {
+			return resp, hops, domain.Errorf(domain.ErrorCodeHTTPTooManyRedirects,
+				"stopped after %d redirects, last one to %s", opts.RedirectLimit(), next)
+		}
+		if req, err = nextRequest(req, resp.StatusCode, next); err != nil {
+			return nil, hops, err
+		}
+	}
+}
+
+// redirectTarget returns where resp redirects to, or nil if it does not.
+func redirectTarget(resp *http.Response) *url.URL {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// nextRequest builds the request for the next hop the way browsers do:
+// 307 and 308 repeat the request, the others turn it into a GET. Credentials
+// and a Host override are not sent on to another host.
+func nextRequest(prev *http.Request, status int, target *url.URL) (*http.Request, error) {
+	method := prev.Method
+	var body io.ReadCloser
+	if status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect {
+		if prev.GetBody != nil {
+			b, err := prev.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			body = b
+		}
+	} else if method != http.MethodHead {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(prev.Context(), method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.GetBody = prev.GetBody
+	req.Header = prev.Header.Clone()
+	if body == nil {
+		req.GetBody = nil
+		req.Header.Del("Content-Type")
+	}
+	if target.Host == prev.URL.Host {
+		req.Host = prev.Host
+	} else {
+		req.Header.Del("Authorization")
+		req.Header.Del("Cookie")
+	}
+	return req, nil
+}
+
+// drain reads a little of the body so the connection can be reused, then closes it.
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	_ = resp.Body.Close()
+}
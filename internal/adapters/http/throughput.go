@@ -0,0 +1,294 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/version"
+)
+
+// throughputTimeout bounds a whole throughput probe; transfers take longer
+// than the requestTimeOut of a check.
+const throughputTimeout = 60 * time.Second
+
+// CheckThroughputWithContext downloads the endpoint's byte count from its URL
+// and, if asked to, uploads one, directly or through proxyURL ("" for
+// direct). The probe passes when the transfers complete; it warns when the
+// server sent less than was asked for.
+func (c Checker) CheckThroughputWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe {
+	var proxyParsed *url.URL
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("invalid proxy URL: %w", err))
+		}
+		proxyParsed = u
+	}
+	ctx, cancel := context.WithTimeout(ctx, throughputTimeout)
+	defer cancel()
+
+	timer := &phaseTimer{}
+	var proxy *domain.ProxyDetails
+	if proxyParsed != nil {
+		proxy = &domain.ProxyDetails{URL: proxyParsed.Redacted()}
+	}
+	t, transport, _, err := c.newTransport(ep, proxyParsed, timer, proxy)
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid, err)
+	}
+	defer t.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	down := download(ctx, client, ep, timer)
+	details := &domain.ThroughputDetails{Download: down.stats}
+	if proxy != nil {
+		proxy.Stages = timer.proxyStages(proxyParsed, down.resp, down.transportErr)
+	}
+	last := down
+	if down.err == nil && ep.Throughput.UploadBytes > 0 {
+		up := upload(ctx, client, ep)
+		details.Upload = &up.stats
+		last = up
+	}
+	latencyMs := time.Since(start).Seconds() * 1000
+
+	var p domain.Probe
+	if last.err != nil {
+		status := last.status
+		if stage, failed := failedStage(proxy); failed {
+			status = stage.FailureStatus(status)
+		}
+		p = domain.NewFailedProbe(ep, status, last.err)
+	} else {
+		p = domain.NewSuccessfulProbe(ep, latencyMs)
+		if want := ep.Throughput.Download(); down.stats.Bytes < want {
+			p.MarkWarning(domain.Errorf(domain.ErrorCodeThroughputFailed,
+				"server sent %s of the %s asked for", domain.FormatBytes(down.stats.Bytes), domain.FormatBytes(want)))
+		}
+	}
+	p.Throughput = details
+	p.HTTP = &domain.HTTPDetails{Timing: timer.timing()}
+	if down.resp != nil {
+		p.HTTP.StatusCode = down.resp.StatusCode
+	}
+	p.Proxy = proxy
+	return p
+}
+
+// transfer is the outcome of one direction of a throughput probe.
+type transfer struct {
+	stats        domain.TransferStats
+	resp         *http.Response // headers only, the body is closed; nil if none came
+	status       domain.Status  // the probe fails with, if err is set
+	err          error
+	transportErr error // err, when no response came
+}
+
+func (tr *transfer) failed(status domain.Status, err error) transfer {
+	tr.status, tr.err = status, err
+	return *tr
+}
+
+// download reads up to the endpoint's byte count from its URL, stopping
+// early when the server ends the body.
+func download(ctx context.Context, client *http.Client, ep domain.Endpoint, timer *phaseTimer) transfer {
+	var tr transfer
+	var firstByte time.Time
+	ctx = httptrace.WithClientTrace(ctx, timer.trace())
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.Target, nil)
+	if err != nil {
+		return tr.failed(domain.StatusInvalid, err)
+	}
+	setTransferHeaders(req)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		tr.transportErr = err
+		return tr.failed(transferFailure(ctx, "download from", ep.Target, err))
+	}
+	defer resp.Body.Close()
+	tr.resp = resp
+	if !firstByte.IsZero() {
+		tr.stats.TTFBMs = firstByte.Sub(start).Seconds() * 1000
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return tr.failed(domain.StatusHTTPError, domain.Errorf(statusErrorCode(resp.StatusCode),
+			"download from %q returned %s", ep.Target, resp.Status))
+	}
+
+	bodyStart := time.Now()
+	err = readCounting(resp.Body, ep.Throughput.Download(), ep.Throughput.StallThresholdMs(), &tr.stats)
+	tr.stats.DurationMs = time.Since(bodyStart).Seconds() * 1000
+	if err != nil {
+		status, cerr := transferFailure(ctx, "download from", ep.Target, err)
+		return tr.failed(status, domain.Errorf(domain.ErrorCodeThroughputFailed,
+			"stopped after %s: %w", domain.FormatBytes(tr.stats.Bytes), cerr))
+	}
+	return tr
+}
+
+// upload POSTs the endpoint's upload byte count to its upload URL. The
+// transfer lasts until the server answers, which it does once it has
+// read the body.
+func upload(ctx context.Context, client *http.Client, ep domain.Endpoint) transfer {
+	var tr transfer
+	target := ep.Throughput.UploadURL
+	if target == "" {
+		target = ep.Target
+	}
+	var firstByte time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	stallMs := ep.Throughput.StallThresholdMs()
+	// the transport reads the body on its own goroutine, and may be handed
+	// a fresh one when a proxy asking for Digest has it sent again
+	var body atomic.Pointer[uploadBody]
+	body.Store(newUploadBody(ep.Throughput.UploadBytes, stallMs))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body.Load())
+	if err != nil {
+		return tr.failed(domain.StatusInvalid, err)
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		b := newUploadBody(ep.Throughput.UploadBytes, stallMs)
+		body.Store(b)
+		return b, nil
+	}
+	req.ContentLength = ep.Throughput.UploadBytes
+	req.Header.Set("Content-Type", "application/octet-stream")
+	setTransferHeaders(req)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	stats, started := body.Load().snapshot()
+	tr.stats = stats
+	if err != nil {
+		tr.transportErr = err
+		return tr.failed(transferFailure(ctx, "upload to", target, err))
+	}
+	drain(resp)
+	tr.resp = resp
+	if !firstByte.IsZero() {
+		tr.stats.TTFBMs = firstByte.Sub(start).Seconds() * 1000
+		if !started.IsZero() {
+			tr.stats.DurationMs = firstByte.Sub(started).Seconds() * 1000
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return tr.failed(domain.StatusHTTPError, domain.Errorf(statusErrorCode(resp.StatusCode),
+			"upload to %q returned %s", target, resp.Status))
+	}
+	return tr
+}
+
+func setTransferHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", fmt.Sprintf("rsvpck/%s (network tester)", version.String()))
+	req.Header.Set("Cache-Control", "no-cache")
+	// compressed bodies would overstate the rate
+	req.Header.Set("Accept-Encoding", "identity")
+}
+
+func transferFailure(ctx context.Context, what, target string, err error) (domain.Status, error) {
+	info := classifyHTTPError(err, ctx.Err())
+	return info.Status, domain.Errorf(info.ErrorCode, "%s %q failed: %w", what, target, err)
+}
+
+// readCounting reads r up to limit bytes into stats, counting each gap
+// between reads of at least stallMs as a stall.
+func readCounting(r io.Reader, limit int64, stallMs float64, stats *domain.TransferStats) error {
+	buf := make([]byte, 32<<10)
+	last := time.Now()
+	for stats.Bytes < limit {
+		n, err := r.Read(buf[:min(int64(len(buf)), limit-stats.Bytes)])
+		if n > 0 {
+			now := time.Now()
+			recordGap(stats, now.Sub(last), stallMs)
+			last = now
+			stats.Bytes += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordGap(stats *domain.TransferStats, gap time.Duration, stallMs float64) {
+	ms := gap.Seconds() * 1000
+	if ms < stallMs {
+		return
+	}
+	stats.Stalls++
+	stats.LongestStallMs = max(stats.LongestStallMs, ms)
+}
+
+// uploadBlock is what an upload sends over and over: random, so nothing on
+// the way can compress it.
+var uploadBlock = func() []byte {
+	b := make([]byte, 64<<10)
+	_, _ = rand.Read(b)
+	return b
+}()
+
+// uploadBody is an upload of n bytes that times the transport's reads: a
+// gap means the connection did not take more data.
+type uploadBody struct {
+	mu        sync.Mutex
+	remaining int64
+	stallMs   float64
+	started   time.Time
+	last      time.Time
+	stats     domain.TransferStats
+}
+
+func newUploadBody(n int64, stallMs float64) *uploadBody {
+	return &uploadBody{remaining: n, stallMs: stallMs}
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	now := time.Now()
+	if b.started.IsZero() {
+		b.started = now
+	} else {
+		recordGap(&b.stats, now.Sub(b.last), b.stallMs)
+	}
+	b.last = now
+	n := copy(p[:min(int64(len(p)), b.remaining)], uploadBlock)
+	b.remaining -= int64(n)
+	b.stats.Bytes += int64(n)
+	return n, nil
+}
+
+func (b *uploadBody) Close() error {
+	return nil
+}
+
+// snapshot returns what was sent so far and when sending began; the
+// transport may still be reading when the response arrives.
+func (b *uploadBody) snapshot() (domain.TransferStats, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats, b.started
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/testutil"
+)
+
+// speedServer serves /down?bytes=N&pause=ms, pausing halfway, and counts
+// what is POSTed to /up.
+func speedServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var uploaded atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+		pause, _ := strconv.Atoi(r.URL.Query().Get("pause"))
+		chunk := make([]byte, n/2)
+		_, _ = w.Write(chunk)
+		w.(http.Flusher).Flush()
+		time.Sleep(time.Duration(pause) * time.Millisecond)
+		_, _ = w.Write(make([]byte, n-len(chunk)))
+	})
+	mux.HandleFunc("/up", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		uploaded.Add(n)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &uploaded
+}
+
+func TestCheckThroughput(t *testing.T) {
+	srv, uploaded := speedServer(t)
+	ep := testEndpoint(t, domain.NewThroughputEndpoint, srv.URL+"/down?bytes=1048576", domain.ThroughputOptions{
+		DownloadBytes: 1 << 20,
+		UploadBytes:   256 << 10,
+		UploadURL:     srv.URL + "/up",
+	})
+
+	p := Checker{}.CheckThroughputWithContext(context.Background(), ep, "")
+	if !p.IsSuccessful() || p.Throughput == nil {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	down := p.Throughput.Download
+	if down.Bytes != 1<<20 || down.Mbps() <= 0 || down.TTFBMs <= 0 || down.Stalls != 0 {
+		t.Fatalf("unexpected download %+v", down)
+	}
+	if up := p.Throughput.Upload; up == nil || up.Bytes != 256<<10 || uploaded.Load() != 256<<10 || up.Mbps() <= 0 {
+		t.Fatalf("unexpected upload %+v, server got %d bytes", up, uploaded.Load())
+	}
+}
+
+func TestCheckThroughput_StallsAndShortBody(t *testing.T) {
+	srv, _ := speedServer(t)
+
+	ep := testEndpoint(t, domain.NewThroughputEndpoint, srv.URL+"/down?bytes=65536&pause=300", domain.ThroughputOptions{DownloadBytes: 65536, StallMs: 150})
+	p := Checker{}.CheckThroughputWithContext(context.Background(), ep, "")
+	if !p.IsSuccessful() || p.Throughput.Download.Stalls != 1 || p.Throughput.Download.LongestStallMs < 250 {
+		t.Fatalf("want one stall of about 300 ms, got %v %+v", p.Status, p.Throughput.Download)
+	}
+
+	// the server decides how much it sends; less than asked for is a warning
+	ep = testEndpoint(t, domain.NewThroughputEndpoint, srv.URL+"/down?bytes=1000", domain.ThroughputOptions{DownloadBytes: 1 << 20})
+	p = Checker{}.CheckThroughputWithContext(context.Background(), ep, "")
+	if !p.IsWarning() || p.Throughput.Download.Bytes != 1000 || !strings.Contains(p.Error, "1000 B of the 1.0 MiB") {
+		t.Fatalf("want a short-body warning, got %v (%s)", p.Status, p.Error)
+	}
+	if p.Throughput.Upload != nil {
+		t.Fatal("want no upload unless asked for")
+	}
+
+	ep = testEndpoint(t, domain.NewThroughputEndpoint, srv.URL+"/missing", domain.ThroughputOptions{})
+	if p = (Checker{}).CheckThroughputWithContext(context.Background(), ep, ""); p.Status != domain.StatusHTTPError {
+		t.Fatalf("want an HTTP error, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckThroughput_ViaProxy(t *testing.T) {
+	srv, uploaded := speedServer(t)
+	proxy := testutil.NewConnectProxy(t)
+	ep := testEndpoint(t, domain.NewThroughputEndpoint, srv.URL+"/down?bytes=131072", domain.ThroughputOptions{
+		DownloadBytes: 131072,
+		UploadBytes:   65536,
+		UploadURL:     srv.URL + "/up",
+	})
+
+	p := Checker{}.CheckThroughputWithContext(context.Background(), ep, proxy.URL)
+	if !p.IsSuccessful() || p.Throughput.Download.Bytes != 131072 || uploaded.Load() != 65536 {
+		t.Fatalf("want both transfers through the proxy, got %v (%s)", p.Status, p.Error)
+	}
+	if p.Proxy == nil || len(p.Proxy.Stages) == 0 || p.Proxy.Verdict() != "" {
+		t.Fatalf("want passed proxy stages, got %+v", p.Proxy)
+	}
+
+	blocked := testutil.NewPolicyProxy(t, func(*http.Request) int { return http.StatusProxyAuthRequired })
+	if p := (Checker{}).CheckThroughputWithContext(context.Background(), ep, blocked.URL); p.Status != domain.StatusProxyAuth {
+		t.Fatalf("want a proxy auth failure, got %v (%s)", p.Status, p.Error)
+	}
+}
@@ -0,0 +1,165 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// phaseTimer records when each phase of a request starts and ends. Through a
+// proxy, DNS and connect refer to the proxy, and TLS to the tunnelled
+// handshake with the target; an https:// proxy's own handshake is timed
+// separately.
+type phaseTimer struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	proxyTLSDone, proxyDone   time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+
+	stages []domain.ProxyStage // as reported by the proxy dialers
+}
+
+func (t *phaseTimer) mark(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// keep the first occurrence: dual-stack dialing may connect more than once
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+// reset forgets the previous request, before the next hop of a redirect chain.
+func (t *phaseTimer) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+	t.connectStart, t.connectDone = time.Time{}, time.Time{}
+	t.proxyTLSDone, t.proxyDone = time.Time{}, time.Time{}
+	t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+	t.wroteRequest, t.firstByte = time.Time{}, time.Time{}
+	// stages stay: a reused connection reports none for the next hop
+}
+
+// addStage is the OnStage hook of the proxy dialers.
+func (t *phaseTimer) addStage(s domain.ProxyStage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages = append(t.stages, s)
+}
+
+// proxyStages completes the dialers' stages with what only the outcome of
+// the request tells: how a forwarded plain-HTTP request fared at the proxy,
+// and the target's answer. resp and err are those of the last hop.
+func (t *phaseTimer) proxyStages(proxyURL *url.URL, resp *http.Response, err error) []domain.ProxyStage {
+	t.mu.Lock()
+	stages := append([]domain.ProxyStage(nil), t.stages...)
+	sent := t.proxyDone
+	if sent.IsZero() {
+		sent = t.wroteRequest
+	}
+	t.mu.Unlock()
+
+	if _, failed := domain.FailedProxyStage(stages); failed {
+		return stages
+	}
+	stage := func(name domain.ProxyStageName, status domain.Status, detail string) {
+		ms := 0.0
+		if !sent.IsZero() {
+			ms = time.Since(sent).Seconds() * 1000
+		}
+		stages = append(stages, domain.ProxyStage{Name: name, Status: status, LatencyMs: ms, Detail: detail})
+	}
+
+	if !hasStage(stages, domain.ProxyStageConnect) {
+		// no tunnel: the proxy forwarded the request, and its answer says how far it got
+		switch {
+		case err != nil:
+			stage(domain.ProxyStageConnect, domain.StatusFail, err.Error())
+			return stages
+		case resp.StatusCode == http.StatusProxyAuthRequired:
+			perr := &httpx.ProxyError{StatusCode: resp.StatusCode, Status: resp.Status, Challenges: resp.Header.Values("Proxy-Authenticate")}
+			stage(domain.ProxyStageConnect, domain.StatusPass, "request accepted")
+			stage(domain.ProxyStageAuth, domain.StatusFail, httpx.ProxyAuthDetail(proxyURL, perr))
+			return stages
+		}
+		stage(domain.ProxyStageConnect, domain.StatusPass, "request accepted")
+		stage(domain.ProxyStageAuth, domain.StatusPass, httpx.ProxyAuthDetail(proxyURL, nil))
+		if perr := (&httpx.ProxyError{StatusCode: resp.StatusCode}); perr.IsUpstream() {
+			// the proxy answering for a target it could not reach
+			stage(domain.ProxyStageTarget, domain.StatusFail, "HTTP "+resp.Status)
+			return stages
+		}
+	}
+
+	if err != nil {
+		stage(domain.ProxyStageTarget, domain.StatusFail, err.Error())
+	} else {
+		stage(domain.ProxyStageTarget, domain.StatusPass, "HTTP "+resp.Status)
+	}
+	return stages
+}
+
+func hasStage(stages []domain.ProxyStage, name domain.ProxyStageName) bool {
+	for _, s := range stages {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *phaseTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// proxyConnected is the transport's OnProxyConnectResponse hook; it fires
+// when the proxy answers the CONNECT request. For SOCKS proxies the dialer
+// marks the end of the handshake instead.
+func (t *phaseTimer) proxyConnected(context.Context, *url.URL, *http.Request, *http.Response) error {
+	t.mark(&t.proxyDone)
+	return nil
+}
+
+func (t *phaseTimer) timing() domain.HTTPTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tunnelStart := t.connectDone
+	if !t.proxyTLSDone.IsZero() {
+		tunnelStart = t.proxyTLSDone
+	}
+	return domain.HTTPTiming{
+		DNSMs:          elapsedMs(t.dnsStart, t.dnsDone),
+		ConnectMs:      elapsedMs(t.connectStart, t.connectDone),
+		ProxyTLSMs:     elapsedMs(t.connectDone, t.proxyTLSDone),
+		ProxyConnectMs: elapsedMs(tunnelStart, t.proxyDone),
+		TLSMs:          elapsedMs(t.tlsStart, t.tlsDone),
+		TTFBMs:         elapsedMs(t.wroteRequest, t.firstByte),
+	}
+}
+
+// elapsedMs is zero unless the phase both started and finished.
+func elapsedMs(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start).Seconds() * 1000
+}
@@ -0,0 +1,126 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// CertError is a chain that failed verification, named by what was wrong
+// with it and kept as the server presented it.
+type CertError struct {
+	Problem domain.CertProblem
+	Chain   []*x509.Certificate // leaf first
+	Err     error               // as x509 reported it
+
+	handshake error // the handshake's own error, when it verified the chain
+}
+
+func (e *CertError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Problem, e.Err)
+}
+
+func (e *CertError) Unwrap() error {
+	if e.handshake != nil {
+		return e.handshake
+	}
+	return e.Err
+}
+
+// Details describes the presented chain and why it failed.
+func (e *CertError) Details(serverName string) *domain.TLSDetails {
+	d := domain.NewTLSDetails(serverName, e.Chain)
+	d.VerifyError = e.Err.Error()
+	d.Problem = e.Problem
+	return d
+}
+
+// AsCertError finds a failed chain verification in the error of a
+// handshake, whether the handshake verified the chain itself or left it to
+// a ClientConfig.
+func AsCertError(err error) (*CertError, bool) {
+	var ce *CertError
+	if errors.As(err, &ce) {
+		return ce, true
+	}
+	var ve *tls.CertificateVerificationError
+	if errors.As(err, &ve) {
+		ce = newCertError(ve.UnverifiedCertificates, ve.Err)
+		ce.handshake = err
+		return ce, true
+	}
+	return nil, false
+}
+
+func newCertError(chain []*x509.Certificate, err error) *CertError {
+	return &CertError{Problem: certProblem(chain, err, time.Now()), Chain: chain, Err: err}
+}
+
+// certProblem names the x509 error. x509 reports a weak signature and a
+// missing intermediate both as an unknown authority, so those are told
+// apart by looking at the chain.
+func certProblem(chain []*x509.Certificate, err error, now time.Time) domain.CertProblem {
+	var (
+		hostErr  x509.HostnameError
+		invalid  x509.CertificateInvalidError
+		unknown  x509.UnknownAuthorityError
+		insecure x509.InsecureAlgorithmError
+	)
+	switch {
+	case errors.As(err, &hostErr):
+		return domain.CertHostnameMismatch
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		if invalid.Cert != nil && now.Before(invalid.Cert.NotBefore) {
+			return domain.CertNotYetValid
+		}
+		return domain.CertExpired
+	case errors.As(err, &insecure):
+		return domain.CertWeakSignature
+	case errors.As(err, &unknown):
+		if strings.Contains(err.Error(), "insecure algorithm") || weakSignature(chain) {
+			return domain.CertWeakSignature
+		}
+		if incompleteChain(chain) {
+			return domain.CertIncompleteChain
+		}
+		return domain.CertUnknownAuthority
+	default:
+		return domain.CertInvalid
+	}
+}
+
+// weakSignature reports a certificate below a self-signed root signed with
+// MD5 or SHA-1.
+func weakSignature(chain []*x509.Certificate) bool {
+	for _, cert := range chain {
+		if selfSigned(cert) {
+			continue
+		}
+		switch cert.SignatureAlgorithm {
+		case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			return true
+		}
+	}
+	return false
+}
+
+// incompleteChain reports a chain that stops below any CA: the server sent
+// its leaf without the intermediate that signed it. A chain ending in an
+// intermediate is complete and its root merely unknown.
+func incompleteChain(chain []*x509.Certificate) bool {
+	if len(chain) == 0 {
+		return false
+	}
+	top := chain[len(chain)-1]
+	return !selfSigned(top) && !top.IsCA
+}
+
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
@@ -0,0 +1,85 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/testutil"
+)
+
+func TestCertProblem(t *testing.T) {
+	root := testutil.NewCA(t, "Test Root")
+	inter := root.Intermediate(t, "Test Intermediate")
+	stranger := testutil.NewCA(t, "Stranger Root")
+	now := time.Now()
+
+	leafOnly := func(c tls.Certificate) tls.Certificate {
+		c.Certificate = c.Certificate[:1]
+		return c
+	}
+	cases := []struct {
+		name       string
+		cert       tls.Certificate
+		serverName string
+		want       domain.CertProblem
+	}{
+		{"trusted", root.Issue(t, "insite.test", false), "insite.test", ""},
+		{"hostname", root.Issue(t, "insite.test", false), "other.test", domain.CertHostnameMismatch},
+		{"expired", root.IssueBetween(t, "insite.test", now.Add(-48*time.Hour), now.Add(-24*time.Hour)), "insite.test", domain.CertExpired},
+		{"not yet valid", root.IssueBetween(t, "insite.test", now.Add(24*time.Hour), now.Add(48*time.Hour)), "insite.test", domain.CertNotYetValid},
+		{"unknown authority", stranger.Issue(t, "insite.test", false), "insite.test", domain.CertUnknownAuthority},
+		{"incomplete chain", leafOnly(inter.Issue(t, "insite.test", false)), "insite.test", domain.CertIncompleteChain},
+		{"intermediate sent", inter.Issue(t, "insite.test", false), "insite.test", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var chain []*x509.Certificate
+			for _, der := range tc.cert.Certificate {
+				c, _ := x509.ParseCertificate(der)
+				chain = append(chain, c)
+			}
+			intermediates := x509.NewCertPool()
+			for _, c := range chain[1:] {
+				intermediates.AddCert(c)
+			}
+			_, err := chain[0].Verify(x509.VerifyOptions{DNSName: tc.serverName, Roots: root.Pool(), Intermediates: intermediates})
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("want the chain verified, got %v", err)
+				}
+				return
+			}
+			if got := certProblem(chain, err, now); got != tc.want {
+				t.Fatalf("certProblem(%v) = %q, want %q", err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFetchCerts_FailedChainCaptured(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{ca.Issue(t, "insite.test", false)}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	trust, _ := LoadTrust(domain.TLSOptions{})
+	d, err := getTLSDetails(context.Background(), srv.Listener.Addr().String(), "insite.test", "", trust)
+	ce, ok := AsCertError(err)
+	if !ok || ce.Problem != domain.CertUnknownAuthority {
+		t.Fatalf("want an unknown authority, got %v", err)
+	}
+	if d == nil || len(d.Certificates) != 2 || d.Problem != domain.CertUnknownAuthority || d.VerifyError == "" {
+		t.Fatalf("want the presented chain described, got %+v", d)
+	}
+	leaf := d.Certificates[0]
+	if len(leaf.SANs) != 3 || leaf.Serial == "" || leaf.KeyType != "ECDSA P-256" || len(leaf.Fingerprint) != 64 {
+		t.Fatalf("want the leaf identified, got %+v", leaf)
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"bufio"
 	"context"
 	"crypto/tls"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -15,33 +15,15 @@ import (
 	"github.com/azargarov/rsvpck/internal/domain"
 )
 
-const singleProxyTimeout = 1 *time.Second
-
-func GetCertificatesSmart(ctx context.Context, addr, serverName string, vpnProxy []string) ([]domain.TLSCertificate, error) {
-
-	totalTimeout := singleProxyTimeout * time.Duration(len(vpnProxy) + 1)
-    parentCtx, parentCancel := context.WithTimeout(ctx, totalTimeout)
-    defer parentCancel()
-
-    directCtx, cancel := context.WithTimeout(parentCtx, singleProxyTimeout)
-    certs, err := GetCertificatesViaProxy(directCtx, addr, serverName, "")
-    cancel()
-    //err = errors.New("debug: force proxy fallback")
-    if err != nil {
-        for _, proxy := range vpnProxy {
-            attemptCtx, cancel := context.WithTimeout(parentCtx, singleProxyTimeout)
-            certs, proxyErr := GetCertificatesViaProxy(attemptCtx, addr, serverName, proxy)
-            cancel()
-            if proxyErr == nil {
-                return certs, nil
-            }
-            //fmt.Printf("[DEBUG] proxy %s failed: %v\n", proxy, proxyErr)
-        }
-    }
-    return certs, err  // TODO: add custom error 
+func GetCertificatesViaProxy(ctx context.Context, targetAddr, serverName, proxyAddr string) ([]domain.TLSCertificate, error) {
+	d, err := getTLSDetails(ctx, targetAddr, serverName, proxyAddr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return d.Certificates, nil
 }
 
-func GetCertificatesViaProxy(ctx context.Context, targetAddr, serverName, proxyAddr string) ([]domain.TLSCertificate, error) {
+func getTLSDetails(ctx context.Context, targetAddr, serverName, proxyAddr string, trust *Trust) (*domain.TLSDetails, error) {
 	if targetAddr == "" {
 		return nil, errors.New("targetAddr is required (host:port)")
 	}
@@ -59,14 +41,14 @@ func GetCertificatesViaProxy(ctx context.Context, targetAddr, serverName, proxyA
 		if err != nil {
 			return nil, err
 		}
-		return fetchCertsOverConn(ctx, conn, serverName)
+		return fetchCertsOverConn(ctx, conn, serverName, trust, HandshakeOptions{})
 	}
 
-	conn, err = dialThroughHTTPProxy(ctx, proxyAddr, targetAddr)
+	conn, err = DialViaProxy(ctx, proxyAddr, targetAddr)
 	if err != nil {
 		return nil, err
 	}
-	return fetchCertsOverConn(ctx, conn, serverName)
+	return fetchCertsOverConn(ctx, conn, serverName, trust, HandshakeOptions{})
 }
 
 func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
@@ -79,20 +61,164 @@ func dialContext(ctx context.Context, network, address string) (net.Conn, error)
 	return d.DialContext(ctx, network, address)
 }
 
-func dialThroughHTTPProxy(ctx context.Context, proxyAddr, targetAddr string) (net.Conn, error) {
+// ProxyOptions tune the connection to the proxy itself.
+type ProxyOptions struct {
+	Trust *Trust // for https:// proxies; nil means the system store
+	// OnTLS, if set, receives the handshake state of an https:// proxy, and
+	// Handshake what its verification found.
+	OnTLS     func(tls.ConnectionState)
+	Handshake *Handshake
+	// OnStage, if set, receives each stage of reaching the target as it ends.
+	OnStage func(domain.ProxyStage)
+}
+
+func (o ProxyOptions) stage(name domain.ProxyStageName, start time.Time, err error, detail string) {
+	if o.OnStage == nil {
+		return
+	}
+	s := domain.ProxyStage{Name: name, Status: domain.StatusPass, LatencyMs: time.Since(start).Seconds() * 1000, Detail: detail}
+	if err != nil {
+		s.Status = domain.StatusFail
+		if detail == "" {
+			s.Detail = err.Error()
+		}
+	}
+	o.OnStage(s)
+}
+
+// ProxyError is a CONNECT request the proxy answered with other than 200.
+type ProxyError struct {
+	StatusCode int
+	Status     string   // e.g. "407 Proxy Authentication Required"
+	Challenges []string // Proxy-Authenticate values
+}
+
+func (e *ProxyError) Error() string {
+	msg := "proxy CONNECT failed: " + e.Status
+	if offers := e.Offers(); len(offers) > 0 {
+		msg += " (proxy offers " + domain.AuthOffer(offers) + ")"
+	}
+	return msg
+}
+
+// Offers parses the challenges the proxy sent.
+func (e *ProxyError) Offers() []domain.AuthChallenge {
+	return ParseChallenges(e.Challenges)
+}
+
+// IsAuth reports a 407, the proxy asking for credentials or rejecting them.
+func (e *ProxyError) IsAuth() bool {
+	return e.StatusCode == http.StatusProxyAuthRequired
+}
+
+// IsUpstream reports the proxy failing to reach the target: 502, 503, 504.
+func (e *ProxyError) IsUpstream() bool {
+	switch e.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// DialViaProxy opens a tunnel to targetAddr (host:port) through the proxy at
+// proxyAddr: CONNECT for http:// and https:// proxies, SOCKS5 for socks5://
+// and socks5h://.
+func DialViaProxy(ctx context.Context, proxyAddr, targetAddr string) (net.Conn, error) {
+	return DialViaProxyWithOptions(ctx, proxyAddr, targetAddr, ProxyOptions{})
+}
+
+// DialViaProxyWithOptions is DialViaProxy with control over the connection
+// to the proxy itself.
+func DialViaProxyWithOptions(ctx context.Context, proxyAddr, targetAddr string, opts ProxyOptions) (net.Conn, error) {
 	u, err := parseProxyURL(proxyAddr)
 	if err != nil {
 		return nil, err
 	}
-	hostPort := u.Host
-	if !strings.Contains(hostPort, ":") {
-		hostPort = net.JoinHostPort(hostPort, "8080") //TODO: change default port
+	if isSOCKS(u) {
+		return dialThroughSOCKS5(ctx, u, targetAddr, opts)
+	}
+	return dialThroughHTTPProxy(ctx, u, targetAddr, opts)
+}
+
+// DialProxy connects to the proxy itself, completing a verified TLS
+// handshake first for https:// proxies.
+func DialProxy(ctx context.Context, proxyAddr string, opts ProxyOptions) (net.Conn, error) {
+	u, err := parseProxyURL(proxyAddr)
+	if err != nil {
+		return nil, err
 	}
+	return dialProxy(ctx, u, opts)
+}
 
-	conn, err := dialContext(ctx, "tcp", hostPort)
+func dialProxy(ctx context.Context, u *url.URL, opts ProxyOptions) (net.Conn, error) {
+	start := time.Now()
+	conn, err := dialContext(ctx, "tcp", proxyHostPort(u))
+	opts.stage(domain.ProxyStageTCP, start, err, "")
 	if err != nil {
 		return nil, fmt.Errorf("proxy dial failed: %w", err)
 	}
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+
+	trust := opts.Trust
+	if trust == nil {
+		trust = &Trust{roots: systemRoots()}
+	}
+	tlsConn := tls.Client(conn, trust.ClientConfig(u.Hostname(), opts.Handshake))
+	start = time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	opts.stage(domain.ProxyStageTLS, start, err, "")
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy TLS handshake failed: %w", err)
+	}
+	if opts.OnTLS != nil {
+		opts.OnTLS(tlsConn.ConnectionState())
+	}
+	return tlsConn, nil
+}
+
+func dialThroughHTTPProxy(ctx context.Context, u *url.URL, targetAddr string, opts ProxyOptions) (net.Conn, error) {
+	// Basic goes up front; a proxy that wants Digest says so in its 407, and
+	// only the stages of the answered attempt are reported
+	authz, _ := ProxyAuthorization(u, nil, http.MethodConnect, targetAddr)
+	first := opts
+	var held []domain.ProxyStage
+	if u.User != nil && opts.OnStage != nil {
+		first.OnStage = func(s domain.ProxyStage) { held = append(held, s) }
+	}
+	conn, err := connectOnce(ctx, u, targetAddr, first, authz)
+	var perr *ProxyError
+	if errors.As(err, &perr) && perr.IsAuth() && u.User != nil {
+		if digest := digestOffered(perr.Offers()); digest != nil {
+			if authz, aerr := ProxyAuthorization(u, digest, http.MethodConnect, targetAddr); aerr == nil {
+				return connectOnce(ctx, u, targetAddr, opts, authz)
+			}
+		}
+	}
+	for _, s := range held {
+		opts.OnStage(s)
+	}
+	return conn, err
+}
+
+func digestOffered(challenges []domain.AuthChallenge) []domain.AuthChallenge {
+	for _, c := range challenges {
+		if c.Is("Digest") {
+			return []domain.AuthChallenge{c}
+		}
+	}
+	return nil
+}
+
+// connectOnce opens a tunnel with one CONNECT, sending authz as the
+// Proxy-Authorization if set.
+func connectOnce(ctx context.Context, u *url.URL, targetAddr string, opts ProxyOptions, authz string) (net.Conn, error) {
+	conn, err := dialProxy(ctx, u, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	if deadline, ok := ctx.Deadline(); ok {
 		_ = conn.SetDeadline(deadline)
@@ -105,83 +231,120 @@ func dialThroughHTTPProxy(ctx context.Context, proxyAddr, targetAddr string) (ne
 	b.WriteString("Host: ")
 	b.WriteString(targetAddr)
 	b.WriteString("\r\n")
-
-	if u.User != nil {
-		if pw, ok := u.User.Password(); ok {
-			auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pw))
-			b.WriteString("Proxy-Authorization: Basic ")
-			b.WriteString(auth)
-			b.WriteString("\r\n")
-		}
+	if authz != "" {
+		b.WriteString("Proxy-Authorization: ")
+		b.WriteString(authz)
+		b.WriteString("\r\n")
 	}
 	b.WriteString("\r\n")
 
+	start := time.Now()
 	if _, err = conn.Write([]byte(b.String())); err != nil {
+		opts.stage(domain.ProxyStageConnect, start, err, "")
 		_ = conn.Close()
 		return nil, fmt.Errorf("proxy write failed: %w", err)
 	}
 
 	br := bufio.NewReader(conn)
-	statusLine, err := br.ReadString('\n')
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
 	if err != nil {
+		opts.stage(domain.ProxyStageConnect, start, err, "")
 		_ = conn.Close()
 		return nil, fmt.Errorf("proxy read failed: %w", err)
 	}
-	// Expect HTTP/1.1 200
-	if !strings.Contains(statusLine, " 200 ") {
-		var hdrs []string
-		for {
-			line, e := br.ReadString('\n')
-			if e != nil {
-				break
-			}
-			line = strings.TrimRight(line, "\r\n")
-			if line == "" {
-				break
-			}
-			hdrs = append(hdrs, line)
-		}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
 		_ = conn.Close()
-		return nil, fmt.Errorf("proxy CONNECT failed: %s (headers: %v)", strings.TrimSpace(statusLine), hdrs)
-	}
-	for {
-		line, e := br.ReadString('\n')
-		if e != nil {
-			_ = conn.Close()
-			return nil, fmt.Errorf("proxy header read failed: %w", e)
-		}
-		if strings.TrimRight(line, "\r\n") == "" {
-			break
+		perr := &ProxyError{StatusCode: resp.StatusCode, Status: resp.Status, Challenges: resp.Header.Values("Proxy-Authenticate")}
+		switch {
+		case perr.IsAuth():
+			opts.stage(domain.ProxyStageConnect, start, nil, "")
+			opts.stage(domain.ProxyStageAuth, start, perr, ProxyAuthDetail(u, perr))
+		case perr.IsUpstream():
+			opts.stage(domain.ProxyStageConnect, start, nil, "")
+			opts.stage(domain.ProxyStageAuth, start, nil, ProxyAuthDetail(u, nil))
+			opts.stage(domain.ProxyStageTarget, start, perr, resp.Status)
+		default:
+			opts.stage(domain.ProxyStageConnect, start, perr, resp.Status)
 		}
+		return nil, perr
 	}
+	// the target stage is the caller's: what answers through the tunnel
+	opts.stage(domain.ProxyStageConnect, start, nil, "")
+	opts.stage(domain.ProxyStageAuth, start, nil, ProxyAuthDetail(u, nil))
 
 	return conn, nil
 }
 
-func fetchCertsOverConn(ctx context.Context, rawConn net.Conn, serverName string) ([]domain.TLSCertificate, error) {
-	cfg := &tls.Config{ServerName: serverName}
+// ProxyAuthDetail describes the auth stage: the schemes the proxy offers, and
+// whether it let the request through with or without credentials.
+func ProxyAuthDetail(u *url.URL, perr *ProxyError) string {
+	sent := u.User != nil
+	if perr == nil {
+		if sent {
+			return "credentials accepted"
+		}
+		return "not required"
+	}
+	offers := perr.Offers()
+	switch {
+	case len(offers) == 0:
+		return "407 without a challenge"
+	case sent && !domain.OffersSupportedAuth(offers):
+		_, err := ProxyAuthorization(u, offers, "", "")
+		return err.Error()
+	case sent:
+		return "credentials rejected; proxy offers " + domain.AuthOffer(offers)
+	default:
+		return "proxy offers " + domain.AuthOffer(offers)
+	}
+}
+
+// HandshakeOptions are what a handshake offers beyond its trust.
+type HandshakeOptions struct {
+	ALPN     []string               // protocols to offer, most wanted first
+	Sessions tls.ClientSessionCache // keeps the session for a later handshake, and offers a kept one
+}
+
+// HandshakeOverConn completes a TLS handshake for serverName over rawConn,
+// trusting by trust (nil means the system store), and describes the
+// session. A chain that fails verification is still described, with a
+// *CertError naming the problem. rawConn is closed either way.
+func HandshakeOverConn(ctx context.Context, rawConn net.Conn, serverName string, trust *Trust, opts HandshakeOptions) (*domain.TLSDetails, error) {
+	return fetchCertsOverConn(ctx, rawConn, serverName, trust, opts)
+}
+
+func fetchCertsOverConn(ctx context.Context, rawConn net.Conn, serverName string, trust *Trust, opts HandshakeOptions) (*domain.TLSDetails, error) {
+	if trust == nil {
+		trust = &Trust{roots: systemRoots()}
+	}
+	var h Handshake
+	cfg := trust.ClientConfig(serverName, &h)
+	cfg.NextProtos = opts.ALPN
+	cfg.ClientSessionCache = opts.Sessions
 	tlsConn := tls.Client(rawConn, cfg)
 
 	defer func() { _ = tlsConn.Close() }()
 
 	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		// the chain is worth showing precisely when it did not verify
+		if ce, ok := AsCertError(err); ok {
+			d := ce.Details(serverName)
+			h.Describe(d)
+			d.VerifyError, d.Problem = ce.Err.Error(), ce.Problem
+			return d, ce
+		}
 		return nil, err
 	}
 
 	state := tlsConn.ConnectionState()
-	now := time.Now()
-
-	out := make([]domain.TLSCertificate, 0, len(state.PeerCertificates))
-	for _, cert := range state.PeerCertificates {
-		out = append(out, domain.TLSCertificate{
-			Subject:   cert.Subject.String(),
-			Issuer:    cert.Issuer.String(),
-			NotBefore: cert.NotBefore,
-			NotAfter:  cert.NotAfter,
-			Valid:     !now.Before(cert.NotBefore) && !now.After(cert.NotAfter),
-		})
+	if opts.Sessions != nil && state.Version == tls.VersionTLS13 && !state.DidResume {
+		awaitTicket(tlsConn)
 	}
-	return out, nil
+	d := domain.NewTLSDetails(serverName, state.PeerCertificates)
+	h.Describe(d)
+	DescribeSession(d, state)
+	return d, nil
 }
 
 func parseProxyURL(s string) (*url.URL, error) {
@@ -192,12 +355,35 @@ func parseProxyURL(s string) (*url.URL, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid proxy address: %w", err)
 	}
-	if u.Scheme != "http" && u.Scheme != "https" {
-		return nil, fmt.Errorf("unsupported proxy scheme %q (expected http/https)", u.Scheme)
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected http, https, socks5 or socks5h)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy address %q: missing host", s)
 	}
 	return u, nil
 }
 
+// IsSOCKSProxy reports whether proxyAddr names a SOCKS5 proxy.
+func IsSOCKSProxy(proxyAddr string) bool {
+	u, err := parseProxyURL(proxyAddr)
+	return err == nil && isSOCKS(u)
+}
+
+func isSOCKS(u *url.URL) bool {
+	return u.Scheme == "socks5" || u.Scheme == "socks5h"
+}
+
+// proxyHostPort returns the proxy address, adding the default port for its scheme.
+func proxyHostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), domain.DefaultProxyPort(u.Scheme))
+}
+
 func hostPart(addr string) string {
 	if h, _, err := net.SplitHostPort(addr); err == nil {
 		return h
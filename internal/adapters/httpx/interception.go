@@ -0,0 +1,76 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+const chainFetchTimeout = 5 * time.Second
+
+// CheckInterception fetches the chain of targetAddr directly and through each
+// proxy, in parallel, and compares them with domain.CompareChains.
+func CheckInterception(ctx context.Context, targetAddr, serverName string, proxies, expectedIssuers []string) domain.InterceptionReport {
+	if serverName == "" {
+		serverName = hostPart(targetAddr)
+	}
+	paths := append([]string{""}, proxies...)
+	obs := make([]domain.ChainObservation, len(paths))
+
+	var wg sync.WaitGroup
+	for i, proxy := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attemptCtx, cancel := context.WithTimeout(ctx, chainFetchTimeout)
+			defer cancel()
+			certs, err := GetChainViaProxy(attemptCtx, targetAddr, serverName, proxy)
+			obs[i] = domain.ChainObservation{Path: proxy, Certificates: certs, Err: err}
+			if proxy == "" {
+				obs[i].Path = "direct"
+			}
+		}()
+	}
+	wg.Wait()
+
+	return domain.CompareChains(serverName, obs, expectedIssuers)
+}
+
+// GetChainViaProxy returns the chain as presented, without verifying it, so a
+// chain signed by an untrusted inspection CA can still be examined.
+func GetChainViaProxy(ctx context.Context, targetAddr, serverName, proxyAddr string) ([]domain.TLSCertificate, error) {
+	if targetAddr == "" {
+		return nil, errors.New("targetAddr is required (host:port)")
+	}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if proxyAddr == "" {
+		conn, err = dialContext(ctx, "tcp", targetAddr)
+	} else {
+		conn, err = DialViaProxy(ctx, proxyAddr, targetAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	defer func() { _ = tlsConn.Close() }()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	peers := tlsConn.ConnectionState().PeerCertificates
+	out := make([]domain.TLSCertificate, 0, len(peers))
+	for _, cert := range peers {
+		out = append(out, domain.NewTLSCertificateFromX509(cert, now))
+	}
+	return out, nil
+}
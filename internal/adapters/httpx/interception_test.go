@@ -0,0 +1,40 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/testutil"
+)
+
+func TestCheckInterception(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer target.Close()
+	addr := target.Listener.Addr().String()
+
+	clean := testutil.NewConnectProxy(t)
+	inspecting := testutil.NewInspectingProxy(t)
+
+	r := CheckInterception(context.Background(), addr, "example.com", []string{clean.URL, inspecting.URL}, nil)
+	if len(r.Paths) != 3 {
+		t.Fatalf("want 3 paths, got %+v", r.Paths)
+	}
+	for _, o := range r.Paths {
+		if o.Err != nil {
+			t.Fatalf("%s: %v", o.Path, o.Err)
+		}
+	}
+	if len(r.Findings) != 1 || !strings.Contains(r.Findings[0], "TLS inspected by "+testutil.InspectionCAName) ||
+		!strings.Contains(r.Findings[0], inspecting.URL) {
+		t.Fatalf("want the inspecting proxy flagged, got %q", r.Findings)
+	}
+
+	// the test server's issuer is "Acme Co"; an expected-issuer list judges each path alone
+	r = CheckInterception(context.Background(), addr, "example.com", []string{clean.URL}, []string{"acme co"})
+	if r.Inspected() {
+		t.Fatalf("want no findings, got %q", r.Findings)
+	}
+}
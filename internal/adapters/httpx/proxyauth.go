@@ -0,0 +1,203 @@
+package httpx
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// ParseChallenges parses Proxy-Authenticate values (RFC 7235). A value may
+// hold several comma-separated challenges, and a challenge several
+// parameters; token68 credentials are dropped.
+func ParseChallenges(values []string) []domain.AuthChallenge {
+	var challenges []domain.AuthChallenge
+	for _, v := range values {
+		for _, item := range splitOutsideQuotes(v) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			word, rest, _ := strings.Cut(item, " ")
+			if strings.Contains(word, "=") && len(challenges) > 0 {
+				// another parameter of the challenge before
+				addAuthParam(challenges[len(challenges)-1], item)
+				continue
+			}
+			c := domain.AuthChallenge{Scheme: word, Params: map[string]string{}}
+			if rest = strings.TrimSpace(rest); strings.Contains(rest, "=") && !strings.HasSuffix(rest, "=") {
+				addAuthParam(c, rest)
+			}
+			challenges = append(challenges, c)
+		}
+	}
+	return challenges
+}
+
+func addAuthParam(c domain.AuthChallenge, param string) {
+	key, value, ok := strings.Cut(param, "=")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = unquote(value[1 : len(value)-1])
+	}
+	c.Params[strings.ToLower(strings.TrimSpace(key))] = value
+}
+
+// quote renders s as an RFC 7230 quoted-string, escaping only the double
+// quote and the backslash. Unlike %q it leaves UTF-8 as is, so the proxy
+// hashes the very user name that was hashed here (RFC 7616).
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func unquote(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitOutsideQuotes splits s at the commas that are not inside a quoted string.
+func splitOutsideQuotes(s string) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\' && quoted:
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == ',' && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ProxyAuthorization answers the challenges with the credentials in u, for a
+// request of method to uri (host:port for CONNECT). Without challenges it is
+// Basic, sent up front; Digest is preferred when offered. It is "" when u
+// carries no credentials.
+func ProxyAuthorization(u *url.URL, challenges []domain.AuthChallenge, method, uri string) (string, error) {
+	if u.User == nil {
+		return "", nil
+	}
+	user := u.User.Username()
+	password, _ := u.User.Password()
+	if len(challenges) == 0 {
+		return basicAuthorization(user, password), nil
+	}
+	for _, c := range challenges {
+		if c.Is("Digest") {
+			return digestAuthorization(c, user, password, method, uri)
+		}
+	}
+	for _, c := range challenges {
+		if c.Is("Basic") {
+			return basicAuthorization(user, password), nil
+		}
+	}
+	return "", fmt.Errorf("proxy offers %s; only %s are supported",
+		domain.AuthOffer(challenges), strings.Join(domain.SupportedProxyAuth, " and "))
+}
+
+func basicAuthorization(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// digestAuthorization answers a Digest challenge (RFC 7616) with qop=auth
+// when the proxy offers it, and the RFC 2069 form otherwise.
+func digestAuthorization(c domain.AuthChallenge, user, password, method, uri string) (string, error) {
+	algorithm := c.Params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	base, session := strings.CutSuffix(strings.ToUpper(algorithm), "-SESS")
+	var newHash func() hash.Hash
+	switch base {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported Digest algorithm %q", algorithm)
+	}
+	h := func(parts ...string) string {
+		d := newHash()
+		d.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	nonce := c.Params["nonce"]
+	if nonce == "" {
+		return "", fmt.Errorf("Digest challenge without a nonce")
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(buf)
+	const nc = "00000001" // a fresh challenge per connection
+
+	ha1 := h(user, c.Realm(), password)
+	if session {
+		ha1 = h(ha1, nonce, cnonce)
+	}
+	ha2 := h(method, uri)
+
+	var qop string
+	for _, q := range strings.Split(c.Params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop != "" {
+		response = h(ha1, nonce, nc, cnonce, qop, ha2)
+	} else {
+		response = h(ha1, nonce, ha2)
+	}
+
+	fields := []string{
+		"username=" + quote(user),
+		"realm=" + quote(c.Realm()),
+		"nonce=" + quote(nonce),
+		"uri=" + quote(uri),
+		"response=" + quote(response),
+		"algorithm=" + algorithm,
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+nc, "cnonce="+quote(cnonce))
+	}
+	if opaque, ok := c.Params["opaque"]; ok {
+		fields = append(fields, "opaque="+quote(opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
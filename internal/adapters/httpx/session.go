@@ -0,0 +1,62 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ticketWait bounds the read that lets a TLS 1.3 session ticket arrive; the
+// server sends it right after the handshake, unasked.
+const ticketWait = 300 * time.Millisecond
+
+// DescribeSession copies what cs negotiated into d: version, cipher suite,
+// ALPN protocol, the stapled OCSP response and whether it resumed a session.
+func DescribeSession(d *domain.TLSDetails, cs tls.ConnectionState) {
+	d.Version = cs.Version
+	d.CipherSuite = tls.CipherSuiteName(cs.CipherSuite)
+	d.ALPN = cs.NegotiatedProtocol
+	d.Resumed = cs.DidResume
+	if len(cs.OCSPResponse) > 0 {
+		d.OCSPStapled = true
+		d.OCSPStatus = ocspStatus(cs.OCSPResponse, cs.PeerCertificates)
+	}
+}
+
+// ocspStatus reads a stapled response for the leaf of chain, checking its
+// signature when the issuer was sent along.
+func ocspStatus(raw []byte, chain []*x509.Certificate) string {
+	if len(chain) == 0 {
+		return "unreadable: no certificate to match it to"
+	}
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, chain[0], issuer)
+	if err != nil {
+		return "unreadable: " + err.Error()
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return domain.OCSPGood
+	case ocsp.Revoked:
+		return domain.OCSPRevoked
+	case ocsp.Unknown:
+		return domain.OCSPUnknown
+	}
+	return fmt.Sprintf("unreadable: status %d", resp.Status)
+}
+
+// awaitTicket reads briefly from a TLS 1.3 connection, which processes the
+// session tickets the server sent after the handshake. Whatever the read
+// returns is of no interest.
+func awaitTicket(conn *tls.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(ticketWait))
+	var b [1]byte
+	_, _ = conn.Read(b[:])
+}
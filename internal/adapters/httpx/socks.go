@@ -0,0 +1,254 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// SOCKS5 protocol constants (RFC 1928, RFC 1929).
+const (
+	socksVersion      = 0x05
+	socksNoAuth       = 0x00
+	socksUserPass     = 0x02
+	socksNoAcceptable = 0xff
+	socksCmdConnect   = 0x01
+	socksAtypIPv4     = 0x01
+	socksAtypDomain   = 0x03
+	socksAtypIPv6     = 0x04
+	userPassVersion   = 0x01
+)
+
+var socksReplies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// SOCKSError is a connect request the SOCKS server turned down.
+type SOCKSError struct {
+	Reply byte
+}
+
+func (e *SOCKSError) Error() string {
+	if msg, ok := socksReplies[e.Reply]; ok {
+		return "SOCKS proxy: " + msg
+	}
+	return fmt.Sprintf("SOCKS proxy: reply code %d", e.Reply)
+}
+
+// dialThroughSOCKS5 connects to targetAddr through the SOCKS5 proxy u. With
+// socks5:// the target is resolved locally, with socks5h:// by the proxy.
+func dialThroughSOCKS5(ctx context.Context, u *url.URL, targetAddr string, opts ProxyOptions) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target %q: %w", targetAddr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target port %q", portStr)
+	}
+
+	if u.Scheme == "socks5" {
+		if _, perr := netip.ParseAddr(host); perr != nil {
+			addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+			if err != nil {
+				return nil, err
+			}
+			if len(addrs) == 0 {
+				return nil, fmt.Errorf("no addresses for %s", host)
+			}
+			host = preferIPv4(addrs).String()
+		}
+	}
+
+	start := time.Now()
+	conn, err := dialContext(ctx, "tcp", proxyHostPort(u))
+	opts.stage(domain.ProxyStageTCP, start, err, "")
+	if err != nil {
+		return nil, fmt.Errorf("proxy dial failed: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// SOCKS authenticates before the connect request, unlike CONNECT
+	start = time.Now()
+	err = socksNegotiate(conn, u.User)
+	switch {
+	case err == nil:
+		opts.stage(domain.ProxyStageAuth, start, nil, socksAuthDetail(u.User))
+	case errors.Is(err, errSOCKSAuth):
+		opts.stage(domain.ProxyStageAuth, start, err, "")
+	default:
+		opts.stage(domain.ProxyStageConnect, start, err, "")
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	start = time.Now()
+	err = socksConnect(conn, host, uint16(port))
+	var socksErr *SOCKSError
+	switch {
+	case errors.As(err, &socksErr) && socksErr.Reply >= 0x03 && socksErr.Reply <= 0x06:
+		// the proxy tried and could not reach the target
+		opts.stage(domain.ProxyStageConnect, start, nil, "")
+		opts.stage(domain.ProxyStageTarget, start, err, "")
+	default:
+		// 0x02, "not allowed by ruleset", is the proxy blocking the target
+		opts.stage(domain.ProxyStageConnect, start, err, "")
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func socksAuthDetail(user *url.Userinfo) string {
+	if user != nil {
+		return "credentials accepted"
+	}
+	return "not required"
+}
+
+// errSOCKSAuth marks the authentication failures of the greeting.
+var errSOCKSAuth = errors.New("SOCKS proxy authentication failed")
+
+// preferIPv4 picks the first IPv4 address, since not every SOCKS server
+// can reach IPv6 targets.
+func preferIPv4(addrs []netip.Addr) netip.Addr {
+	for _, a := range addrs {
+		if a.Unmap().Is4() {
+			return a.Unmap()
+		}
+	}
+	return addrs[0]
+}
+
+// socksNegotiate agrees on an authentication method and authenticates.
+func socksNegotiate(rw io.ReadWriter, user *url.Userinfo) error {
+	methods := []byte{socksNoAuth}
+	if user != nil {
+		methods = []byte{socksUserPass, socksNoAuth}
+	}
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := rw.Write(greeting); err != nil {
+		return fmt.Errorf("proxy write failed: %w", err)
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(rw, choice[:]); err != nil {
+		return fmt.Errorf("proxy read failed: %w", err)
+	}
+	if choice[0] != socksVersion {
+		return fmt.Errorf("not a SOCKS5 proxy (version %d)", choice[0])
+	}
+	switch choice[1] {
+	case socksNoAuth:
+	case socksUserPass:
+		if user == nil {
+			return fmt.Errorf("%w: the proxy requires credentials, none configured", errSOCKSAuth)
+		}
+		if err := socksAuth(rw, user); err != nil {
+			return err
+		}
+	case socksNoAcceptable:
+		return errors.New("SOCKS proxy accepted none of the offered authentication methods")
+	default:
+		return fmt.Errorf("SOCKS proxy chose unsupported authentication method %d", choice[1])
+	}
+	return nil
+}
+
+// socksConnect asks for a tunnel to host:port.
+func socksConnect(rw io.ReadWriter, host string, port uint16) error {
+
+	req := []byte{socksVersion, socksCmdConnect, 0x00}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.Unmap()
+		if addr.Is4() {
+			b := addr.As4()
+			req = append(append(req, socksAtypIPv4), b[:]...)
+		} else {
+			b := addr.As16()
+			req = append(append(req, socksAtypIPv6), b[:]...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long for SOCKS: %q", host)
+		}
+		req = append(append(req, socksAtypDomain, byte(len(host))), host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := rw.Write(req); err != nil {
+		return fmt.Errorf("proxy write failed: %w", err)
+	}
+
+	// VER REP RSV ATYP, then the bound address, which is not needed
+	var hdr [4]byte
+	if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+		return fmt.Errorf("proxy read failed: %w", err)
+	}
+	if hdr[1] != 0x00 {
+		return &SOCKSError{Reply: hdr[1]}
+	}
+	var skip int
+	switch hdr[3] {
+	case socksAtypIPv4:
+		skip = 4
+	case socksAtypIPv6:
+		skip = 16
+	case socksAtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(rw, n[:]); err != nil {
+			return fmt.Errorf("proxy read failed: %w", err)
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("SOCKS proxy replied with unknown address type %d", hdr[3])
+	}
+	if _, err := io.ReadFull(rw, make([]byte, skip+2)); err != nil {
+		return fmt.Errorf("proxy read failed: %w", err)
+	}
+	return nil
+}
+
+// socksAuth runs the username/password subnegotiation of RFC 1929.
+func socksAuth(rw io.ReadWriter, user *url.Userinfo) error {
+	name := user.Username()
+	pass, _ := user.Password()
+	if len(name) > 255 || len(pass) > 255 {
+		return errors.New("SOCKS credentials too long")
+	}
+	msg := []byte{userPassVersion, byte(len(name))}
+	msg = append(msg, name...)
+	msg = append(msg, byte(len(pass)))
+	msg = append(msg, pass...)
+	if _, err := rw.Write(msg); err != nil {
+		return fmt.Errorf("proxy write failed: %w", err)
+	}
+	var status [2]byte
+	if _, err := io.ReadFull(rw, status[:]); err != nil {
+		return fmt.Errorf("proxy read failed: %w", err)
+	}
+	if status[1] != 0x00 {
+		return fmt.Errorf("%w: credentials rejected", errSOCKSAuth)
+	}
+	return nil
+}
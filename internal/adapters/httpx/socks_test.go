@@ -0,0 +1,113 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/testutil"
+)
+
+func helloServer(t *testing.T) (host, port string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	t.Cleanup(srv.Close)
+	host, port, _ = net.SplitHostPort(srv.Listener.Addr().String())
+	return host, port
+}
+
+func getOver(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, "GET / HTTP/1.0\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, _ := io.ReadAll(conn)
+	return string(b)
+}
+
+func TestDialViaProxy_SOCKS5(t *testing.T) {
+	_, port := helloServer(t)
+	target := net.JoinHostPort("localhost", port)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// socks5h hands the name to the proxy, socks5 resolves it first
+	for scheme, want := range map[string]string{"socks5h": target, "socks5": net.JoinHostPort("127.0.0.1", port)} {
+		proxy := testutil.NewSOCKS5Server(t, "", "")
+		conn, err := DialViaProxy(ctx, proxy.URL(scheme), target)
+		if err != nil {
+			t.Fatalf("%s: dial: %v", scheme, err)
+		}
+		if resp := getOver(t, conn); !strings.HasSuffix(resp, "hello") {
+			t.Fatalf("%s: unexpected response %q", scheme, resp)
+		}
+		if got := proxy.Requests(); len(got) != 1 || got[0] != want {
+			t.Fatalf("%s: proxy saw %v, want %s", scheme, got, want)
+		}
+	}
+}
+
+func TestDialViaProxy_SOCKS5Auth(t *testing.T) {
+	host, port := helloServer(t)
+	target := net.JoinHostPort(host, port)
+	proxy := testutil.NewSOCKS5Server(t, "alice", "s3cret")
+	ctx := context.Background()
+
+	conn, err := DialViaProxy(ctx, proxy.URL("socks5h"), target)
+	if err != nil {
+		t.Fatalf("dial with credentials: %v", err)
+	}
+	if resp := getOver(t, conn); !strings.HasSuffix(resp, "hello") {
+		t.Fatalf("unexpected response %q", resp)
+	}
+
+	if _, err := DialViaProxy(ctx, "socks5h://alice:wrong@"+proxy.Addr, target); err == nil ||
+		!strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("want rejected credentials, got %v", err)
+	}
+	if _, err := DialViaProxy(ctx, "socks5h://"+proxy.Addr, target); err == nil {
+		t.Fatalf("want an error without credentials")
+	}
+}
+
+func TestDialViaProxy_SOCKS5Refused(t *testing.T) {
+	host, port := helloServer(t)
+	target := net.JoinHostPort(host, port)
+	proxy := testutil.NewSOCKS5Server(t, "", "")
+	proxy.Block[target] = true
+
+	_, err := DialViaProxy(context.Background(), proxy.URL("socks5h"), target)
+	var serr *SOCKSError
+	if !errors.As(err, &serr) || serr.Reply != 0x02 {
+		t.Fatalf("want ruleset refusal, got %v", err)
+	}
+}
+
+func TestGetCertificatesViaProxy_SOCKS5(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	proxy := testutil.NewSOCKS5Server(t, "", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	// the test CA is not trusted, so reaching the verification step proves the tunnel works
+	_, err := GetCertificatesViaProxy(ctx, srv.Listener.Addr().String(), "example.com", proxy.URL("socks5"))
+	var verr *tls.CertificateVerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("want a certificate verification error through the tunnel, got %v", err)
+	}
+	if len(proxy.Requests()) != 1 {
+		t.Fatalf("handshake did not go through the proxy")
+	}
+}
@@ -0,0 +1,274 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Trust is a loaded domain.TLSOptions: the roots a chain is verified
+// against, where each extra root came from, and the client certificate.
+type Trust struct {
+	roots    *x509.CertPool
+	origins  map[string]string // raw root -> the file it was loaded from
+	client   *tls.Certificate
+	insecure bool
+	// a minimum version is checked after the handshake, so older ones are
+	// offered too and a downgrade is named rather than refused
+	checksVersion bool
+}
+
+var systemRoots = sync.OnceValue(func() *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		return x509.NewCertPool()
+	}
+	return pool
+})
+
+// LoadTrust reads the CA bundle and client certificate named in opts. The
+// zero options give the system store and no client certificate.
+func LoadTrust(opts domain.TLSOptions) (*Trust, error) {
+	return LoadTrustWithRoots(opts, nil)
+}
+
+// LoadTrustWithRoots is LoadTrust on top of roots instead of the system store.
+func LoadTrustWithRoots(opts domain.TLSOptions, roots *x509.CertPool) (*Trust, error) {
+	if roots == nil {
+		roots = systemRoots()
+	}
+	t := &Trust{roots: roots, origins: map[string]string{}, insecure: opts.Insecure, checksVersion: opts.MinVersion != 0}
+
+	var files []string
+	if opts.CAFile != "" {
+		files = append(files, opts.CAFile)
+	}
+	if opts.CADir != "" {
+		entries, err := os.ReadDir(opts.CADir)
+		if err != nil {
+			return nil, fmt.Errorf("caDir: %w", err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(opts.CADir, e.Name()))
+			}
+		}
+	}
+	if len(files) > 0 {
+		t.roots = t.roots.Clone()
+	}
+	for _, file := range files {
+		certs, err := readPEMCertificates(file)
+		if err != nil {
+			if file == opts.CAFile {
+				return nil, fmt.Errorf("caFile: %w", err)
+			}
+			continue // caDir may hold other files, as /etc/ssl/certs does
+		}
+		for _, cert := range certs {
+			t.roots.AddCert(cert)
+			t.origins[string(cert.Raw)] = file
+		}
+	}
+
+	if opts.ClientCert != "" {
+		cert, err := loadClientCert(opts)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		t.client = &cert
+	}
+	return t, nil
+}
+
+// LoadCertPool returns the system trust store extended with the PEM
+// certificates in file.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	t, err := LoadTrust(domain.TLSOptions{CAFile: file})
+	if err != nil {
+		return nil, err
+	}
+	return t.roots, nil
+}
+
+func readPEMCertificates(file string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificates in %s", file)
+	}
+	return certs, nil
+}
+
+func loadClientCert(opts domain.TLSOptions) (tls.Certificate, error) {
+	data, err := os.ReadFile(opts.ClientCert)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		// not PEM, so a PKCS#12 bundle with the key and maybe the chain
+		key, leaf, chain, err := pkcs12.DecodeChain(data, opts.ClientPassword)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("%s: %w", opts.ClientCert, err)
+		}
+		cert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+		for _, c := range chain {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+		return cert, nil
+	}
+	if opts.ClientKey == "" {
+		return tls.X509KeyPair(data, data) // the key may follow the certificate
+	}
+	return tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+}
+
+// Handshake collects what a handshake with a ClientConfig found out.
+type Handshake struct {
+	mu         sync.Mutex
+	anchor     string
+	verifyErr  error
+	clientCert string
+}
+
+// Describe copies the findings into d.
+func (h *Handshake) Describe(d *domain.TLSDetails) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	d.TrustAnchor = h.anchor
+	d.ClientCert = h.clientCert
+	if ce, ok := AsCertError(h.verifyErr); ok {
+		d.VerifyError = ce.Err.Error()
+		d.Problem = ce.Problem
+	} else if h.verifyErr != nil {
+		d.VerifyError = h.verifyErr.Error()
+	}
+}
+
+// VerifyError is the verification failure an insecure handshake went past.
+func (h *Handshake) VerifyError() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.verifyErr
+}
+
+// ClientConfig returns a config for serverName ("" lets net/http fill it in)
+// that records into h, which may be nil, the root that validated the chain.
+// In insecure mode the chain is verified after the handshake instead, and a
+// failure is recorded rather than returned.
+func (t *Trust) ClientConfig(serverName string, h *Handshake) *tls.Config {
+	if h == nil {
+		h = &Handshake{}
+	}
+	cfg := &tls.Config{
+		ServerName: serverName,
+		RootCAs:    t.roots,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			var err error
+			chains := cs.VerifiedChains
+			if t.insecure {
+				chains, err = t.verify(cs)
+			}
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.verifyErr = err
+			if len(chains) > 0 {
+				h.anchor = t.anchorName(chains[0][len(chains[0])-1])
+			}
+			return nil
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if t.client == nil {
+				h.clientCert = "requested, none configured"
+				return &tls.Certificate{}, nil
+			}
+			h.clientCert = clientSubject(t.client)
+			return t.client, nil
+		},
+	}
+	if t.insecure {
+		cfg.InsecureSkipVerify = true
+	}
+	if t.checksVersion {
+		cfg.MinVersion = tls.VersionTLS10
+	}
+	return cfg
+}
+
+// verify checks the chain as the handshake would have, returning a
+// CertError; the host name is only known to it when the connection sent SNI.
+func (t *Trust) verify(cs tls.ConnectionState) ([][]*x509.Certificate, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("server sent no certificates")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         t.roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return nil, newCertError(cs.PeerCertificates, err)
+	}
+	return chains, nil
+}
+
+// anchorName names a root and where it was loaded from.
+func (t *Trust) anchorName(root *x509.Certificate) string {
+	origin := "system store"
+	if file, ok := t.origins[string(root.Raw)]; ok {
+		origin = file
+	}
+	return fmt.Sprintf("%s (%s)", certName(root), origin)
+}
+
+func certName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+func clientSubject(cert *tls.Certificate) string {
+	leaf := cert.Leaf
+	if leaf == nil && len(cert.Certificate) > 0 {
+		leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if leaf == nil {
+		return "unparsable"
+	}
+	return strings.TrimSpace(leaf.Subject.String())
+}
@@ -0,0 +1,116 @@
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/testutil"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func mTLSServer(t *testing.T, serverCA, clientCA *testutil.CA) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCA.Issue(t, "backend.test", false)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCA.Pool(),
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.Listener.Addr().String()
+}
+
+func TestFetchCerts_CAFileAndClientCert(t *testing.T) {
+	serverCA, clientCA := testutil.NewCA(t, "Test Server CA"), testutil.NewCA(t, "Test Client CA")
+	addr := mTLSServer(t, serverCA, clientCA)
+	caFile := testutil.WriteCertPEM(t, "server-ca.pem", serverCA.Cert)
+	client := clientCA.Issue(t, "rsvpck-agent", true)
+	certFile, keyFile := testutil.WriteKeyPairPEM(t, client)
+
+	p12, err := pkcs12.Modern.Encode(client.PrivateKey, client.Leaf, []*x509.Certificate{clientCA.Cert}, "secret")
+	if err != nil {
+		t.Fatalf("pkcs12: %v", err)
+	}
+	p12File := filepath.Join(t.TempDir(), "client.p12")
+	if err := os.WriteFile(p12File, p12, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, opts := range map[string]domain.TLSOptions{
+		"pem":    {CAFile: caFile, ClientCert: certFile, ClientKey: keyFile},
+		"pkcs12": {CAFile: caFile, ClientCert: p12File, ClientPassword: "secret"},
+	} {
+		trust, err := LoadTrust(opts)
+		if err != nil {
+			t.Fatalf("%s: load: %v", name, err)
+		}
+		d, err := getTLSDetails(context.Background(), addr, "backend.test", "", trust)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if d.TrustAnchor != "Test Server CA ("+caFile+")" {
+			t.Errorf("%s: trust anchor %q", name, d.TrustAnchor)
+		}
+		if d.ClientCert != "CN=rsvpck-agent" {
+			t.Errorf("%s: client certificate %q", name, d.ClientCert)
+		}
+	}
+
+	if _, err := LoadTrust(domain.TLSOptions{ClientCert: p12File, ClientPassword: "wrong"}); err == nil {
+		t.Error("want an error for a wrong PKCS#12 password")
+	}
+}
+
+func TestFetchCerts_Insecure(t *testing.T) {
+	serverCA, clientCA := testutil.NewCA(t, "Test Server CA"), testutil.NewCA(t, "Test Client CA")
+	addr := mTLSServer(t, serverCA, clientCA)
+	certFile, keyFile := testutil.WriteKeyPairPEM(t, clientCA.Issue(t, "rsvpck-agent", true))
+
+	strict, _ := LoadTrust(domain.TLSOptions{ClientCert: certFile, ClientKey: keyFile})
+	if _, err := getTLSDetails(context.Background(), addr, "backend.test", "", strict); err == nil {
+		t.Fatal("want a verification error without the server CA")
+	}
+
+	insecure, _ := LoadTrust(domain.TLSOptions{ClientCert: certFile, ClientKey: keyFile, Insecure: true})
+	d, err := getTLSDetails(context.Background(), addr, "backend.test", "", insecure)
+	if err != nil {
+		t.Fatalf("insecure: %v", err)
+	}
+	if !strings.Contains(d.VerifyError, "unknown authority") || d.Problem != domain.CertUnknownAuthority || d.TrustAnchor != "" {
+		t.Fatalf("want the failure reported, got %+v", d)
+	}
+}
+
+func TestLoadTrust_CADir(t *testing.T) {
+	serverCA := testutil.NewCA(t, "Test Server CA")
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "corp.pem")
+	data, _ := os.ReadFile(testutil.WriteCertPEM(t, "ca.pem", serverCA.Cert))
+	if err := os.WriteFile(caFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// not a certificate; skipped, as in /etc/ssl/certs
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	trust, err := LoadTrust(domain.TLSOptions{CADir: dir})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := trust.anchorName(serverCA.Cert); got != "Test Server CA ("+caFile+")" {
+		t.Fatalf("anchor %q", got)
+	}
+	if _, err := LoadTrust(domain.TLSOptions{CAFile: filepath.Join(dir, "README")}); err == nil {
+		t.Fatal("want an error for a caFile without certificates")
+	}
+}
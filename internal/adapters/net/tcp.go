@@ -34,6 +34,18 @@ func (d *TCPDialer) CheckWithContext(ctx context.Context, ep domain.Endpoint) do
 	return domain.NewSuccessfulProbe(ep, latencyMs)
 }
 
+func (d *TCPDialer) CheckViaProxyWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe {
+	return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("not implemented"))
+}
+
+func (d *TCPDialer) CheckTLSWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe {
+	return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("not implemented"))
+}
+
+func (d *TCPDialer) CheckInterceptionWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("not implemented"))
+}
+
 func (d *TCPDialer) HTTPDo(ctx context.Context, req *domain.Request) (*domain.Response, time.Duration, error) {
 	return nil, 0, fmt.Errorf("not implemented")
 }
@@ -0,0 +1,138 @@
+// Standard PAC helper functions (Netscape proxy auto-config). dnsResolve and
+// myIpAddress are provided by the host.
+
+var MONTHS = ["JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"];
+var WEEKDAYS = ["SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"];
+
+function isPlainHostName(host) {
+	return host.indexOf(".") < 0;
+}
+
+function dnsDomainIs(host, domain) {
+	return host.length >= domain.length && host.substring(host.length - domain.length) == domain;
+}
+
+function localHostOrDomainIs(host, hostdom) {
+	return host == hostdom || hostdom.lastIndexOf(host + ".", 0) == 0;
+}
+
+function isResolvable(host) {
+	return !!dnsResolve(host);
+}
+
+function dnsDomainLevels(host) {
+	return host.split(".").length - 1;
+}
+
+function convert_addr(ipchars) {
+	var b = ipchars.split(".");
+	return (((b[0] & 0xff) << 24) | ((b[1] & 0xff) << 16) | ((b[2] & 0xff) << 8) | (b[3] & 0xff)) >>> 0;
+}
+
+function isInNet(ipaddr, pattern, maskstr) {
+	if (!/^\d+\.\d+\.\d+\.\d+$/.test(ipaddr)) {
+		ipaddr = dnsResolve(ipaddr);
+		if (!ipaddr) {
+			return false;
+		}
+	}
+	var mask = convert_addr(maskstr);
+	return ((convert_addr(ipaddr) & mask) >>> 0) == ((convert_addr(pattern) & mask) >>> 0);
+}
+
+function shExpMatch(str, shexp) {
+	var re = shexp.replace(/[.+^${}()|[\]\\]/g, "\\$&").replace(/\*/g, ".*").replace(/\?/g, ".");
+	return new RegExp("^" + re + "$").test(str);
+}
+
+// splitGMT drops a trailing "GMT" argument and reports whether it was there.
+function splitGMT(args) {
+	args = Array.prototype.slice.call(args);
+	var gmt = args.length > 0 && args[args.length - 1] === "GMT";
+	if (gmt) {
+		args.pop();
+	}
+	return { args: args, gmt: gmt };
+}
+
+// inRange compares with wrap-around, so that "FRI".."MON" or "DEC".."JAN" work.
+function inRange(value, lo, hi) {
+	return lo <= hi ? value >= lo && value <= hi : value >= lo || value <= hi;
+}
+
+function weekdayRange() {
+	var a = splitGMT(arguments);
+	var now = new Date();
+	var day = a.gmt ? now.getUTCDay() : now.getDay();
+	var lo = WEEKDAYS.indexOf(String(a.args[0]).toUpperCase());
+	var hi = a.args.length > 1 ? WEEKDAYS.indexOf(String(a.args[1]).toUpperCase()) : lo;
+	if (lo < 0 || hi < 0) {
+		return false;
+	}
+	return inRange(day, lo, hi);
+}
+
+// dateRange accepts days (1-31), month names and years, alone or as ranges.
+function dateRange() {
+	var a = splitGMT(arguments);
+	var now = new Date();
+	var current = {
+		day: a.gmt ? now.getUTCDate() : now.getDate(),
+		month: a.gmt ? now.getUTCMonth() : now.getMonth(),
+		year: a.gmt ? now.getUTCFullYear() : now.getFullYear()
+	};
+	function parse(list) {
+		var p = {};
+		for (var i = 0; i < list.length; i++) {
+			var m = MONTHS.indexOf(String(list[i]).toUpperCase());
+			if (m >= 0) {
+				p.month = m;
+			} else if (list[i] > 31) {
+				p.year = +list[i];
+			} else {
+				p.day = +list[i];
+			}
+		}
+		return p;
+	}
+	function key(p, fields) {
+		return (fields.year !== undefined ? p.year * 10000 : 0) +
+			(fields.month !== undefined ? p.month * 100 : 0) +
+			(fields.day !== undefined ? p.day : 0);
+	}
+	if (a.args.length == 0 || a.args.length % 2 == 1 && a.args.length > 1) {
+		return false;
+	}
+	if (a.args.length == 1) {
+		var only = parse(a.args);
+		return key(current, only) == key(only, only);
+	}
+	var half = a.args.length / 2;
+	var lo = parse(a.args.slice(0, half));
+	var hi = parse(a.args.slice(half));
+	return inRange(key(current, lo), key(lo, lo), key(hi, lo));
+}
+
+// timeRange accepts hours, hours and minutes, or hours, minutes and seconds.
+function timeRange() {
+	var a = splitGMT(arguments);
+	var now = new Date();
+	var h = a.gmt ? now.getUTCHours() : now.getHours();
+	var m = a.gmt ? now.getUTCMinutes() : now.getMinutes();
+	var s = a.gmt ? now.getUTCSeconds() : now.getSeconds();
+	var n = a.args.map(Number);
+	switch (n.length) {
+	case 1:
+		return h == n[0];
+	case 2:
+		return inRange(h, n[0], n[1] - 1);
+	case 4:
+		return inRange(h * 60 + m, n[0] * 60 + n[1], n[2] * 60 + n[3]);
+	case 6:
+		return inRange(h * 3600 + m * 60 + s, n[0] * 3600 + n[1] * 60 + n[2], n[3] * 3600 + n[4] * 60 + n[5]);
+	default:
+		return false;
+	}
+}
+
+function alert(msg) {}
@@ -0,0 +1,182 @@
+// Package pac evaluates proxy auto-config scripts to pick a route per target.
+package pac
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/dop251/goja"
+)
+
+const (
+	fetchTimeout  = 5 * time.Second
+	maxScriptSize = 1 << 20
+)
+
+//go:embed helpers.js
+var helpers string
+
+// Resolver loads each PAC script once and evaluates FindProxyForURL for it.
+type Resolver struct {
+	mu      sync.Mutex
+	scripts map[domain.PACSource]*script
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{scripts: make(map[domain.PACSource]*script)}
+}
+
+// FindProxyWithContext returns the routes the script at src chooses for
+// target, in order of preference.
+func (r *Resolver) FindProxyWithContext(ctx context.Context, src domain.PACSource, target string) ([]domain.ProxyRoute, error) {
+	s, err := r.load(ctx, src)
+	if err != nil {
+		return nil, domain.Errorf(domain.ErrorCodePACFailed, "PAC %s: %w", src, err)
+	}
+	result, err := s.findProxy(ctx, target)
+	if err != nil {
+		return nil, domain.Errorf(domain.ErrorCodePACFailed, "PAC %s: %w", src, err)
+	}
+	routes, err := domain.ParsePACResult(result)
+	if err != nil {
+		return nil, domain.Errorf(domain.ErrorCodePACFailed, "PAC %s: %w", src, err)
+	}
+	return routes, nil
+}
+
+// load fetches and compiles the script on first use; failures are not cached,
+// so a later probe may still succeed.
+func (r *Resolver) load(ctx context.Context, src domain.PACSource) (*script, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.scripts[src]; ok {
+		return s, nil
+	}
+	code, err := fetch(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	s, err := compile(code)
+	if err != nil {
+		return nil, err
+	}
+	r.scripts[src] = s
+	return s, nil
+}
+
+func fetch(ctx context.Context, src domain.PACSource) (string, error) {
+	if src.File != "" {
+		b, err := os.ReadFile(src.File)
+		return string(b), err
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	// the script says which proxy to use, so it is fetched without one
+	client := &http.Client{Transport: &http.Transport{Proxy: nil}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch failed: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxScriptSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(b) > maxScriptSize {
+		return "", fmt.Errorf("script larger than %d bytes", maxScriptSize)
+	}
+	return string(b), nil
+}
+
+// script is a compiled PAC script. A goja runtime is not safe for concurrent
+// use, so evaluations are serialized.
+type script struct {
+	mu         sync.Mutex
+	vm         *goja.Runtime
+	findProxyF goja.Callable
+	ctx        context.Context // of the evaluation in progress, for dnsResolve
+}
+
+func compile(code string) (*script, error) {
+	s := &script{vm: goja.New(), ctx: context.Background()}
+	_ = s.vm.Set("dnsResolve", s.dnsResolve)
+	_ = s.vm.Set("myIpAddress", myIPAddress)
+	if _, err := s.vm.RunString(helpers); err != nil {
+		return nil, fmt.Errorf("helpers: %w", err)
+	}
+	if _, err := s.vm.RunString(code); err != nil {
+		return nil, err
+	}
+	fn, ok := goja.AssertFunction(s.vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, fmt.Errorf("script does not define FindProxyForURL")
+	}
+	s.findProxyF = fn
+	return s, nil
+}
+
+func (s *script) findProxy(ctx context.Context, target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	// as browsers do, https URLs are reduced to scheme and host
+	if u.Scheme == "https" {
+		u = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx = ctx
+	defer func() { s.ctx = context.Background() }()
+	stop := context.AfterFunc(ctx, func() { s.vm.Interrupt(ctx.Err()) })
+	defer func() {
+		stop()
+		s.vm.ClearInterrupt()
+	}()
+
+	v, err := s.findProxyF(goja.Undefined(), s.vm.ToValue(u.String()), s.vm.ToValue(u.Hostname()))
+	if err != nil {
+		return "", err
+	}
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return "", nil
+	}
+	return v.String(), nil
+}
+
+// dnsResolve returns the first IPv4 address of host, or null.
+func (s *script) dnsResolve(host string) goja.Value {
+	addrs, err := net.DefaultResolver.LookupIP(s.ctx, "ip4", host)
+	if err != nil || len(addrs) == 0 {
+		return goja.Null()
+	}
+	return s.vm.ToValue(addrs[0].String())
+}
+
+// myIPAddress returns the address outgoing traffic leaves from. Dialing UDP
+// sends nothing; it only selects a route.
+func myIPAddress() string {
+	conn, err := net.Dial("udp4", "192.0.2.1:9")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
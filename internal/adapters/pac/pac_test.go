@@ -0,0 +1,148 @@
+package pac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+const corpPAC = `
+function FindProxyForURL(url, host) {
+	if (isPlainHostName(host) || dnsDomainIs(host, ".intranet.test"))
+		return "DIRECT";
+	if (isInNet(host, "10.0.0.0", "255.0.0.0"))
+		return "DIRECT";
+	if (shExpMatch(url, "https://*.socks.test/*"))
+		return "SOCKS5 socks.corp.test:1080";
+	if (localHostOrDomainIs(host, "www.secure.test"))
+		return "HTTPS tls-proxy.corp.test:443; DIRECT";
+	if (dnsDomainLevels(host) > 3)
+		return "SOCKS4 old.corp.test:1080; PROXY proxy.corp.test:3128";
+	return "PROXY proxy.corp.test:3128; DIRECT";
+}
+`
+
+func pacServer(t *testing.T, script string) (*httptest.Server, *int) {
+	t.Helper()
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		_, _ = w.Write([]byte(script))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+func TestResolver_Routes(t *testing.T) {
+	srv, fetches := pacServer(t, corpPAC)
+	src := domain.PACSource{URL: srv.URL + "/proxy.pac"}
+	r := NewResolver()
+
+	cases := map[string][]string{
+		"http://wiki/":                       {"DIRECT"},
+		"https://portal.intranet.test/login": {"DIRECT"},
+		"http://10.1.2.3/status":             {"DIRECT"},
+		"https://files.socks.test/a/b?c=d":   {"SOCKS5 socks.corp.test:1080"},
+		"https://www.secure.test/":           {"HTTPS tls-proxy.corp.test:443", "DIRECT"},
+		"http://a.b.c.d.example.test/":       {"PROXY proxy.corp.test:3128"},
+		"https://example.com/some/path?q=1":  {"PROXY proxy.corp.test:3128", "DIRECT"},
+	}
+	for target, want := range cases {
+		routes, err := r.FindProxyWithContext(context.Background(), src, target)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		got := make([]string, 0, len(routes))
+		for _, rt := range routes {
+			got = append(got, rt.String())
+		}
+		if strings.Join(got, "; ") != strings.Join(want, "; ") {
+			t.Errorf("%s: got %v, want %v", target, got, want)
+		}
+	}
+	if *fetches != 1 {
+		t.Fatalf("want the script fetched once, got %d", *fetches)
+	}
+}
+
+func TestResolver_HTTPSURLsAreStripped(t *testing.T) {
+	srv, _ := pacServer(t, `function FindProxyForURL(url, host) {
+		return url == "https://example.com/" ? "DIRECT" : "PROXY leaked.test:80";
+	}`)
+	routes, err := NewResolver().FindProxyWithContext(context.Background(), domain.PACSource{URL: srv.URL}, "https://example.com/secret/token?x=1")
+	if err != nil || !routes[0].IsDirect() {
+		t.Fatalf("want the path hidden from the script, got %v, %v", routes, err)
+	}
+}
+
+func TestResolver_Errors(t *testing.T) {
+	cases := map[string]string{
+		"syntax":      `function FindProxyForURL(url, host) {`,
+		"no function": `var x = 1;`,
+		"throws":      `function FindProxyForURL(url, host) { throw new Error("boom"); }`,
+		"bad result":  `function FindProxyForURL(url, host) { return "PROXY"; }`,
+	}
+	for name, script := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := pacServer(t, script)
+			_, err := NewResolver().FindProxyWithContext(context.Background(), domain.PACSource{URL: srv.URL}, "http://example.com/")
+			if !domain.IsErrorCode(err, domain.ErrorCodePACFailed) {
+				t.Fatalf("want a PAC error, got %v", err)
+			}
+		})
+	}
+
+	_, err := NewResolver().FindProxyWithContext(context.Background(), domain.PACSource{File: "/nonexistent/proxy.pac"}, "http://example.com/")
+	if !domain.IsErrorCode(err, domain.ErrorCodePACFailed) {
+		t.Fatalf("want a PAC error for a missing file, got %v", err)
+	}
+}
+
+func TestResolver_InterruptsOnCancel(t *testing.T) {
+	srv, _ := pacServer(t, `function FindProxyForURL(url, host) { for (;;) {} }`)
+	r := NewResolver()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.FindProxyWithContext(ctx, domain.PACSource{URL: srv.URL}, "http://example.com/"); err == nil {
+		t.Fatal("want an error from a script that never returns")
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	s, err := compile(`function FindProxyForURL(url, host) { return ""; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		`shExpMatch("http://a.test/x.html", "*.test/*.html")`:   true,
+		`shExpMatch("http://a.test/x.html", "*.test/?.htm")`:    false,
+		`shExpMatch("a+b", "a+b")`:                              true,
+		`isInNet("192.168.1.20", "192.168.0.0", "255.255.0.0")`: true,
+		`isInNet("192.169.1.20", "192.168.0.0", "255.255.0.0")`: false,
+		`dnsDomainIs("www.example.test", ".example.test")`:      true,
+		`dnsDomainIs("www.example.test", ".other.test")`:        false,
+		`localHostOrDomainIs("www", "www.example.test")`:        true,
+		`dnsDomainLevels("a.b.c") == 2`:                         true,
+		`isPlainHostName("www")`:                                true,
+		`weekdayRange("SUN", "SAT")`:                            true,
+		`dateRange("JAN", "DEC")`:                               true,
+		`dateRange(1, 31)`:                                      true,
+		`timeRange(0, 24)`:                                      true,
+		`/^\d+\.\d+\.\d+\.\d+$/.test(myIpAddress())`:            true,
+	}
+	for expr, want := range cases {
+		v, err := s.vm.RunString(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if v.ToBoolean() != want {
+			t.Errorf("%s: got %v, want %v", expr, v, want)
+		}
+	}
+}
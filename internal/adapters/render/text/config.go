@@ -13,12 +13,13 @@ import (
 type RenderConfig struct {
 
 	ForceASCII bool
+	Verbose    bool
 	ForceUnicode *bool // nil = auto, true/false = force
 	Unicode bool
 	Color   bool
-	OkSym, FailSym string
+	OkSym, FailSym, WarnSym string
 	Divider1, Divider2 string
-	Green, Red colorFunc
+	Green, Red, Yellow colorFunc
 	TableSymbols *tw.SymbolCustom
 }
 
@@ -28,6 +29,7 @@ type Option func(*RenderConfig)
 
 func WithForceASCII(v bool) Option        { return func(c *RenderConfig) { c.ForceASCII = v } }
 func WithForceUnicode(v bool) Option      { return func(c *RenderConfig) { c.ForceUnicode = &v } }
+func WithVerbose(v bool) Option           { return func(c *RenderConfig) { c.Verbose = v } }
 
 func NewRenderConfig(opts ...Option) *RenderConfig {
 	c := &RenderConfig{}
@@ -62,7 +64,8 @@ func (c *RenderConfig) initTheme() {
 		color.NoColor = false // enable ANSI
 		c.Green = color.New(color.FgGreen).SprintFunc()
 		c.Red   = color.New(color.FgRed).SprintFunc()
-		c.OkSym, c.FailSym = c.Green("✓"), c.Red("✗")
+		c.Yellow = color.New(color.FgYellow).SprintFunc()
+		c.OkSym, c.FailSym, c.WarnSym = c.Green("✓"), c.Red("✗"), c.Yellow("!")
 		c.Divider1, c.Divider2 = "═", "─"
 		c.TableSymbols = tw.NewSymbolCustom("Box").
 			WithRow("─").WithColumn("│").
@@ -71,10 +74,11 @@ func (c *RenderConfig) initTheme() {
 			WithBottomLeft("└").WithBottomMid("┴").WithBottomRight("┘")
 	} else {
 		color.NoColor = true // disable ANSI
-		c.OkSym, c.FailSym = "OK", "X"
+		c.OkSym, c.FailSym, c.WarnSym = "OK", "X", "!"
 		c.Divider1, c.Divider2 = "=", "-"
 		c.Green = func(a ...any) string { return fmt.Sprint(a...) }
 		c.Red   = func(a ...any) string { return fmt.Sprint(a...) }
+		c.Yellow = func(a ...any) string { return fmt.Sprint(a...) }
 		c.TableSymbols = tw.NewSymbolCustom("ASCII").
 			WithRow("-").WithColumn("|").
 			WithTopLeft("+").WithTopMid("+").WithTopRight("+").
@@ -0,0 +1,341 @@
+package text
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// probeDetails returns the extra lines shown under a probe, beyond its status and error.
+func probeDetails(p domain.Probe, conf *RenderConfig) []string {
+	var lines []string
+	if p.DNS != nil {
+		lines = append(lines, dnsDetails(*p.DNS, conf)...)
+	}
+	if p.HTTP != nil {
+		lines = append(lines, httpDetails(*p.HTTP, conf)...)
+	}
+	if p.TLS != nil {
+		lines = append(lines, tlsVerification(*p.TLS)...)
+		// whole, since the error line is cut short and these get copied
+		if p.Status == domain.StatusPinMismatch {
+			lines = append(lines, presentedPins(*p.TLS)...)
+		}
+		if p.TLS.HandshakeMs > 0 {
+			lines = append(lines, fmt.Sprintf("handshake: connect %.2f ms, TLS %.2f ms", p.TLS.ConnectMs, p.TLS.HandshakeMs))
+		}
+		// a TLS probe is there for its session and chain
+		if conf.Verbose || p.Endpoint.TargetType == domain.TargetTypeTLS {
+			if session := tlsSession(*p.TLS); session != "" {
+				lines = append(lines, "session: "+session)
+			}
+			lines = append(lines, tlsDetails(*p.TLS, conf.Verbose)...)
+		}
+	}
+	if p.Proxy != nil {
+		lines = append(lines, proxyDetails(*p.Proxy, conf)...)
+	}
+	if p.Interception != nil {
+		lines = append(lines, interceptionDetails(*p.Interception, conf)...)
+	}
+	if p.Captive != nil && p.Captive.LoginURL != "" {
+		lines = append(lines, "login page: "+p.Captive.LoginURL)
+	}
+	if p.Throughput != nil {
+		lines = append(lines, throughputDetails(*p.Throughput)...)
+	}
+	if p.Bandwidth != nil {
+		lines = append(lines, bandwidthDetails(*p.Bandwidth)...)
+	}
+	return lines
+}
+
+// bandwidthDetails shows the round trips and each direction with its
+// per-second rates.
+func bandwidthDetails(d domain.BandwidthDetails) []string {
+	var lines []string
+	if d.Server != "" {
+		lines = append(lines, "peer: rsvpck "+d.Server)
+	}
+	if d.RTT.Samples > 0 {
+		lines = append(lines, "rtt: "+d.RTT.String())
+	}
+	transfer := func(name string, tr domain.BandwidthTransfer) {
+		if tr.Bytes == 0 && len(tr.Intervals) == 0 {
+			return
+		}
+		lines = append(lines, name+": "+tr.String())
+		var from float64
+		for _, iv := range tr.Intervals {
+			to := from + iv.DurationMs/1000
+			lines = append(lines, fmt.Sprintf("  %4.1f-%4.1f s  %10s  %8.2f Mbps", from, to, domain.FormatBytes(iv.Bytes), iv.Mbps()))
+			from = to
+		}
+	}
+	transfer("download", d.Download)
+	if d.Upload != nil {
+		transfer("upload", *d.Upload)
+	}
+	return lines
+}
+
+func throughputDetails(d domain.ThroughputDetails) []string {
+	lines := []string{"download: " + d.Download.String()}
+	if d.Upload != nil {
+		lines = append(lines, "upload: "+d.Upload.String())
+	}
+	return lines
+}
+
+// interceptionDetails lists the leaf each path was served; the findings
+// are the probe's error.
+func interceptionDetails(r domain.InterceptionReport, conf *RenderConfig) []string {
+	var lines []string
+	for _, o := range r.Paths {
+		leaf, ok := o.Leaf()
+		switch {
+		case o.Err != nil:
+			lines = append(lines, fmt.Sprintf("%s: %s", o.PathName(), o.Err))
+		case !ok:
+			lines = append(lines, fmt.Sprintf("%s: no certificates", o.PathName()))
+		default:
+			spki := leaf.SPKI
+			if !conf.Verbose && len(spki) > 16 {
+				spki = spki[:16]
+			}
+			lines = append(lines, fmt.Sprintf("%s: issuer %s, spki %s", o.PathName(), leaf.Issuer, spki))
+		}
+	}
+	return lines
+}
+
+// proxyDetails shows the route a PAC script or the environment chose and, in verbose mode, the
+// proxy's own certificates apart from the target's.
+func proxyDetails(d domain.ProxyDetails, conf *RenderConfig) []string {
+	var lines []string
+	if d.Route != "" {
+		route := d.Route
+		if len(d.FailedRoutes) > 0 {
+			route += fmt.Sprintf(", after %s did not connect", strings.Join(d.FailedRoutes, ", "))
+		}
+		lines = append(lines, fmt.Sprintf("route (%s): %s", d.RouteSource, route))
+	}
+	lines = append(lines, proxyStages(d, conf)...)
+	if d.TLS == nil {
+		return lines
+	}
+	if !conf.Verbose {
+		// an unverified proxy is shown regardless
+		if d.TLS.VerifyError != "" {
+			lines = append(lines, "proxy "+tlsVerification(*d.TLS)[0])
+		}
+		return lines
+	}
+	lines = append(lines, "proxy "+d.URL)
+	for _, l := range append(tlsVerification(*d.TLS), tlsDetails(*d.TLS, true)...) {
+		lines = append(lines, "proxy "+l)
+	}
+	return lines
+}
+
+// proxyStages shows how far the proxy got, when it failed or in verbose mode.
+func proxyStages(d domain.ProxyDetails, conf *RenderConfig) []string {
+	verdict := d.Verdict()
+	if verdict == "" && !conf.Verbose {
+		return nil
+	}
+	lines := make([]string, 0, len(d.Stages)+1)
+	for _, s := range d.Stages {
+		sym := conf.OkSym
+		if !s.Status.IsSuccess() {
+			sym = conf.FailSym
+		}
+		lines = append(lines, sym+" "+s.String())
+	}
+	if verdict != "" {
+		lines = append(lines, "verdict: "+verdict)
+	}
+	return lines
+}
+
+func dnsDetails(d domain.DNSDetails, conf *RenderConfig) []string {
+	// a lone answer says nothing the status doesn't
+	if len(d.Results) == 1 && !conf.Verbose {
+		return nil
+	}
+	lines := make([]string, 0, len(d.Results))
+	for _, r := range d.Results {
+		var line string
+		if r.IsSuccessful() {
+			line = fmt.Sprintf("%s %s %.2f ms", conf.OkSym, r.Name(), r.LatencyMs)
+		} else if r.RCode != "" && r.RCode != "NOERROR" {
+			line = fmt.Sprintf("%s %s %s", conf.FailSym, r.Name(), r.RCode)
+		} else {
+			line = fmt.Sprintf("%s %s %s", conf.FailSym, r.Name(), r.Status.String())
+		}
+		if conf.Verbose && len(r.Answers) > 0 {
+			line += fmt.Sprintf("  %s %s", d.RecordType, strings.Join(r.Answers, ", "))
+		}
+		if conf.Verbose {
+			if flags := wireFlags(r); flags != "" {
+				line += "  [" + flags + "]"
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// wireFlags summarizes how a directly queried server answered.
+func wireFlags(r domain.DNSServerResult) string {
+	var flags []string
+	if r.Authoritative {
+		flags = append(flags, "aa")
+	}
+	if r.TCPFallback {
+		flags = append(flags, "tc, retried over tcp")
+	} else if r.Truncated {
+		flags = append(flags, "tc")
+	}
+	if r.NegativeSOA != "" {
+		flags = append(flags, "soa "+r.NegativeSOA)
+	}
+	if r.Responder != "" && !strings.HasPrefix(r.Server, r.Responder) {
+		flags = append(flags, "answered by "+r.Responder)
+	}
+	return strings.Join(flags, ", ")
+}
+
+func httpDetails(d domain.HTTPDetails, conf *RenderConfig) []string {
+	var lines []string
+	// a chain is worth showing whenever there was a redirect
+	if len(d.Hops) > 1 {
+		for i, h := range d.Hops {
+			arrow := "  "
+			if i > 0 {
+				arrow = "->"
+			}
+			lines = append(lines, fmt.Sprintf("%s %d %s %.2f ms", arrow, h.StatusCode, h.URL, h.LatencyMs))
+		}
+	}
+	if !conf.Verbose {
+		return lines
+	}
+	if !d.Timing.IsZero() {
+		lines = append(lines, timingLine(d.Timing))
+	}
+	// the error line is truncated; spell out each failure when there are several
+	if len(d.Failures) > 1 {
+		lines = append(lines, d.Failures...)
+	}
+	return lines
+}
+
+// timingLine lists the phases that took place, in order.
+func timingLine(t domain.HTTPTiming) string {
+	phases := []struct {
+		name string
+		ms   float64
+	}{
+		{"dns", t.DNSMs},
+		{"connect", t.ConnectMs},
+		{"proxy tls", t.ProxyTLSMs},
+		{"proxy CONNECT", t.ProxyConnectMs},
+		{"tls", t.TLSMs},
+		{"ttfb", t.TTFBMs},
+	}
+	parts := make([]string, 0, len(phases))
+	for _, ph := range phases {
+		if ph.ms > 0 {
+			parts = append(parts, fmt.Sprintf("%s %.1f ms", ph.name, ph.ms))
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// presentedPins lists the values a pin could name: the SPKI of every
+// certificate the server sent, and the leaf and issuer fingerprints.
+func presentedPins(d domain.TLSDetails) []string {
+	if len(d.Certificates) == 0 {
+		return nil
+	}
+	var lines []string
+	for i, c := range d.Certificates {
+		lines = append(lines, fmt.Sprintf("presented %s SPKI: %s (hex %s)", domain.ChainRole(d.Certificates, i), domain.SPKIPin(c.SPKI), c.SPKI))
+	}
+	lines = append(lines, "presented leaf fingerprint: "+d.Certificates[0].Fingerprint)
+	if len(d.Certificates) > 1 {
+		lines = append(lines, "presented issuer fingerprint: "+d.Certificates[1].Fingerprint)
+	}
+	return lines
+}
+
+// tlsSession sums up what the handshake negotiated, "" when unknown.
+func tlsSession(d domain.TLSDetails) string {
+	if d.Version == 0 {
+		return ""
+	}
+	parts := []string{d.VersionName(), d.CipherSuite}
+	if d.ALPN != "" {
+		parts = append(parts, "ALPN "+d.ALPN)
+	} else {
+		parts = append(parts, "no ALPN")
+	}
+	if d.OCSPStapled {
+		parts = append(parts, "OCSP stapled: "+d.OCSPStatus)
+	} else {
+		parts = append(parts, "no OCSP stapling")
+	}
+	switch {
+	case d.Resumed:
+		parts = append(parts, "resumed")
+	case d.ResumptionChecked:
+		parts = append(parts, "resumption refused")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tlsDetails lists the chain, with what identifies each certificate when full.
+func tlsDetails(d domain.TLSDetails, full bool) []string {
+	lines := make([]string, 0, len(d.Certificates))
+	for i, c := range d.Certificates {
+		validity := "valid"
+		if !c.Valid {
+			validity = "NOT valid"
+		}
+		lines = append(lines, fmt.Sprintf("cert[%d] %s, %s until %s", i, c.Subject, validity, c.NotAfter.Format("2006-01-02")))
+		if !full {
+			continue
+		}
+		if len(c.SANs) > 0 {
+			lines = append(lines, fmt.Sprintf("  SANs: %s", strings.Join(c.SANs, ", ")))
+		}
+		key := c.KeyType
+		if c.KeyType == "RSA" { // the others name their size
+			key = fmt.Sprintf("RSA %d bits", c.KeyBits)
+		}
+		lines = append(lines,
+			fmt.Sprintf("  serial %s, key %s, signed %s", c.Serial, key, c.SignatureAlgorithm),
+			"  sha256 "+c.Fingerprint)
+	}
+	return lines
+}
+
+// tlsVerification names what the chain was trusted by, or why it was not,
+// and the client certificate sent.
+func tlsVerification(d domain.TLSDetails) []string {
+	var lines []string
+	switch {
+	case d.Problem != "":
+		lines = append(lines, fmt.Sprintf("not verified, %s: %s", d.Problem, d.VerifyError))
+	case d.VerifyError != "":
+		lines = append(lines, "not verified: "+d.VerifyError)
+	case d.TrustAnchor != "":
+		lines = append(lines, "trust anchor: "+d.TrustAnchor)
+	}
+	if d.ClientCert != "" {
+		lines = append(lines, "client certificate: "+d.ClientCert)
+	}
+	return lines
+}
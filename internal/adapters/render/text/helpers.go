@@ -17,9 +17,39 @@ func printSummary(w io.Writer, result domain.ConnectivityResult, conf *RenderCon
 	mode := modeString(result.Mode)
 	fmt.Fprintln(w, "")
 	fmt.Fprintf(w, "%s > Mode: %s\n", status, mode)
+	fmt.Fprintln(w, probeCounts(result, conf))
+	for _, d := range result.Diagnoses {
+		fmt.Fprintf(w, "%s %s\n", conf.WarnSym, d)
+	}
 	fmt.Fprintln(w, "")
 }
 
+// probeCounts tells passed, warned and failed probes apart, as the exit
+// code does.
+func probeCounts(result domain.ConnectivityResult, conf *RenderConfig) string {
+	warned, failed := len(result.WarningProbes()), len(result.FailedProbes())
+	parts := []string{fmt.Sprintf("%d passed", len(result.SuccessfulProbes()))}
+	if warned > 0 {
+		parts = append(parts, conf.Yellow(fmt.Sprintf("%d with warnings", warned)))
+	}
+	if failed > 0 {
+		parts = append(parts, conf.Red(fmt.Sprintf("%d failed", failed)))
+	}
+	return "Probes: " + strings.Join(parts, ", ")
+}
+
+// statusSymbol picks the icon for a probe: pass, warning or fail.
+func statusSymbol(p domain.Probe, conf *RenderConfig) string {
+	switch {
+	case p.IsSuccessful():
+		return conf.OkSym
+	case p.IsWarning():
+		return conf.WarnSym
+	default:
+		return conf.FailSym
+	}
+}
+
 func modeString(mode domain.ConnectivityMode) string {
 	switch mode {
 	case domain.ModeDirect:
@@ -28,6 +58,8 @@ func modeString(mode domain.ConnectivityMode) string {
 		return "Via Proxy"
 	case domain.ModeViaVPN:
 		return "Via VPN"
+	case domain.ModeCaptivePortal:
+		return "Captive portal (sign-in required)"
 	default:
 		return "None"
 	}
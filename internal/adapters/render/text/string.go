@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"github.com/azargarov/rsvpck/internal/domain"
 )
 
 type colorFunc = func(a ...any) string
@@ -43,3 +45,30 @@ func PrintList[T fmt.Stringer](w io.Writer, name string, data []T, conf *RenderC
 	return nil
 }
 
+
+// SpeedtestText shows each throughput probe with its transfers; for
+// PrintBlock.
+func SpeedtestText(probes []domain.Probe, conf *RenderConfig) string {
+	var lines []string
+	for _, p := range probes {
+		sym := conf.OkSym
+		switch {
+		case p.IsWarning():
+			sym = conf.WarnSym
+		case !p.IsSuccessful():
+			sym = conf.FailSym
+		}
+		line := fmt.Sprintf("%s %s", sym, p.Endpoint.Description)
+		if p.Error != "" {
+			line += ": " + p.Error
+		}
+		lines = append(lines, line)
+		for _, l := range probeDetails(p, conf) {
+			lines = append(lines, "  "+l)
+		}
+	}
+	if len(lines) == 0 {
+		return "no speedtest endpoints configured"
+	}
+	return strings.Join(lines, "\n")
+}
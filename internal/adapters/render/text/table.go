@@ -3,6 +3,7 @@ package text
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/azargarov/rsvpck/internal/domain"
 	"github.com/olekukonko/tablewriter"
@@ -75,19 +76,24 @@ func (tr *TableRenderer) renderProbeTable(w io.Writer, probes []domain.Probe, na
 		}
 
 		statusStr := tr.conf.FailSym + " Fail"
-		if p.IsSuccessful() {
+		switch {
+		case p.IsSuccessful():
 			statusStr = tr.conf.OkSym + " Pass"
+		case p.IsWarning():
+			statusStr = tr.conf.WarnSym + " Warn"
 		}
 
 		latencyStr := "-"
-		if p.IsSuccessful() {
+		if p.Status.IsSuccess() {
 			latencyStr = fmt.Sprintf("%.2f ms", p.LatencyMs)
 		}
 
-		details := ""
+		var lines []string
 		if !p.IsSuccessful() && p.Error != "" {
-			details = truncateError(p.Error, maxCharPerError)
+			lines = append(lines, truncateError(p.Error, maxCharPerError))
 		}
+		lines = append(lines, probeDetails(p, tr.conf)...)
+		details := strings.Join(lines, "\n")
 
 		table.Append([]string{desc, statusStr, latencyStr, details})
 	}
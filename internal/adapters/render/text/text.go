@@ -64,21 +64,24 @@ func (r *TextRenderer) renderProbeList(w io.Writer, probes []domain.Probe) {
 	})
 
 	for _, p := range probes {
-		statusIcon := r.conf.FailSym
-		if p.IsSuccessful() {
-			statusIcon = r.conf.OkSym
-		}
+		statusIcon := statusSymbol(p, r.conf)
 
 		desc := p.Endpoint.Description
 		if desc == "" {
 			desc = p.Endpoint.Target
 		}
 
-		if p.IsSuccessful() {
+		if p.IsWarning() {
+			errorMsg := truncateError(p.Error, maxCharPerError)
+			fmt.Fprintf(w, "\t%s %-40s [%.2f ms] %s\n", statusIcon, desc, p.LatencyMs, errorMsg)
+		} else if p.IsSuccessful() {
 			fmt.Fprintf(w, "\t%s %-40s [%.2f ms]\n", statusIcon, desc, p.LatencyMs)
 		} else {
 			errorMsg := truncateError(p.Error, maxCharPerError)
 			fmt.Fprintf(w, "\t%s %-40s %s\n", statusIcon, desc, errorMsg)
 		}
+		for _, line := range probeDetails(p, r.conf) {
+			fmt.Fprintf(w, "\t    %s\n", line)
+		}
 	}
 }
@@ -0,0 +1,46 @@
+// Package sysproxy routes endpoints by the proxy settings of the environment:
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY, as most other software does.
+package sysproxy
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// FromEnvironment reads the proxy variables, upper or lower case.
+func FromEnvironment() domain.EnvProxy {
+	cfg := httpproxy.FromEnvironment()
+	return domain.EnvProxy{HTTPProxy: cfg.HTTPProxy, HTTPSProxy: cfg.HTTPSProxy, NoProxy: cfg.NoProxy}
+}
+
+// Resolver picks the proxy for a target from a set of environment settings.
+type Resolver struct {
+	proxyFor func(*url.URL) (*url.URL, error)
+}
+
+func NewResolver(env domain.EnvProxy) *Resolver {
+	cfg := &httpproxy.Config{HTTPProxy: env.HTTPProxy, HTTPSProxy: env.HTTPSProxy, NoProxy: env.NoProxy}
+	return &Resolver{proxyFor: cfg.ProxyFunc()}
+}
+
+// ProxyForURL returns the proxy URL for target, or "" to go direct. Targets
+// without a scheme (TCP host:port) are tunnelled, so they take HTTPS_PROXY.
+// NO_PROXY entries may be domains, IPs, CIDR ranges and host:port pairs;
+// loopback targets always go direct.
+func (r *Resolver) ProxyForURL(target string) (string, error) {
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	proxy, err := r.proxyFor(u)
+	if err != nil || proxy == nil {
+		return "", err
+	}
+	return proxy.String(), nil
+}
@@ -0,0 +1,23 @@
+package tcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// CheckInterceptionWithContext fetches the chain of ep.Target directly and
+// through each of the endpoint's proxies, and fails the probe when a path
+// was served a chain other than the target's own.
+func (c Checker) CheckInterceptionWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe {
+	opts := ep.Interception
+	start := time.Now()
+	report := httpx.CheckInterception(ctx, ep.Target, opts.ServerName, opts.Proxies, opts.ExpectedIssuers)
+
+	p := domain.NewSuccessfulProbe(ep, time.Since(start).Seconds()*1000)
+	p.Interception = &report
+	p.CheckInterception()
+	return p
+}
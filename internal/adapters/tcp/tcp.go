@@ -2,9 +2,13 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
 	"github.com/azargarov/rsvpck/internal/domain"
 	"net"
+	"net/url"
 	"strings"
 	"syscall"
 	"time"
@@ -50,6 +54,100 @@ func (c Checker) CheckWithContext(ctx context.Context, ep domain.Endpoint) domai
 	)
 }
 
+// CheckViaProxyWithContext opens a tunnel to ep.Target through proxyURL
+// (HTTP CONNECT or SOCKS5) and reports how long that took.
+func (c Checker) CheckViaProxyWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe {
+	if _, _, err := net.SplitHostPort(ep.Target); err != nil {
+		return domain.NewFailedProbe(
+			ep,
+			domain.StatusInvalid,
+			errors.New("invalid target format, expected host:port"),
+		)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, localTimeOut)
+	defer cancel()
+
+	trust, err := httpx.LoadTrust(ep.ProxyTLS())
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("proxy TLS settings: %w", err))
+	}
+	proxy := proxyDetails(proxyURL)
+	start := time.Now()
+	conn, err := dialViaProxy(ctx, ep, proxyURL, trust, proxy)
+	latencyMs := time.Since(start).Seconds() * 1000
+
+	if err != nil {
+		return proxyFailure(ep, proxy, err, ctx.Err())
+	}
+	conn.Close()
+
+	// the proxy answers CONNECT once it has reached the target
+	connectMs := 0.0
+	for _, s := range proxy.Stages {
+		if s.Name == domain.ProxyStageConnect {
+			connectMs = s.LatencyMs
+		}
+	}
+	proxy.Stages = append(proxy.Stages, domain.ProxyStage{Name: domain.ProxyStageTarget, Status: domain.StatusPass, LatencyMs: connectMs, Detail: "tunnel open"})
+
+	p := domain.NewSuccessfulProbe(
+		ep,
+		latencyMs,
+	)
+	p.Proxy = proxy
+	return p
+}
+
+// dialViaProxy opens a tunnel to ep.Target through proxyURL, trusting an
+// https:// proxy by trust and recording its certificates and each stage
+// into proxy.
+func dialViaProxy(ctx context.Context, ep domain.Endpoint, proxyURL string, trust *httpx.Trust, proxy *domain.ProxyDetails) (net.Conn, error) {
+	handshake := &httpx.Handshake{}
+	opts := httpx.ProxyOptions{
+		Trust:     trust,
+		Handshake: handshake,
+		OnTLS: func(state tls.ConnectionState) {
+			proxy.TLS = domain.NewTLSDetails(state.ServerName, state.PeerCertificates)
+			handshake.Describe(proxy.TLS)
+		},
+		OnStage: func(s domain.ProxyStage) {
+			proxy.Stages = append(proxy.Stages, s)
+		},
+	}
+	return httpx.DialViaProxyWithOptions(ctx, proxyURL, ep.Target, opts)
+}
+
+// proxyFailure is the probe for a tunnel that could not be opened, named
+// after the stage that failed.
+func proxyFailure(ep domain.Endpoint, proxy *domain.ProxyDetails, err, contextErr error) domain.Probe {
+	status := mapErrorToStatus(err, contextErr)
+	if status == domain.StatusInvalid {
+		status = domain.StatusConnectionRefused // refused by the proxy rather than malformed
+	}
+	var failErr error = fmt.Errorf("via proxy: %w", err)
+	if stage, ok := domain.FailedProxyStage(proxy.Stages); ok {
+		status = stage.FailureStatus(status)
+		failErr = fmt.Errorf("%s: via proxy: %w", proxy.Verdict(), err)
+	}
+	p := domain.NewFailedProbe(
+		ep,
+		status,
+		failErr,
+	)
+	p.Proxy = proxy
+	return p
+}
+
+// proxyDetails starts the record of the connection to the proxy.
+func proxyDetails(proxyURL string) *domain.ProxyDetails {
+	d := &domain.ProxyDetails{URL: proxyURL}
+	if u, err := url.Parse(proxyURL); err == nil {
+		d.URL = u.Redacted()
+	}
+	return d
+}
+
 func mapErrorToStatus(err, contextErr error) domain.Status {
 	if contextErr != nil {
 		if errors.Is(contextErr, context.DeadlineExceeded) ||
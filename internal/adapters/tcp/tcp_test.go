@@ -0,0 +1,70 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/testutil"
+)
+
+func listener(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckViaProxy_SOCKS5(t *testing.T) {
+	target := listener(t)
+	proxy := testutil.NewSOCKS5Server(t, "alice", "s3cret")
+	ep := domain.MustNewTCPEndpoint(target, domain.EndpointTypePublic, "tcp via socks")
+
+	p := Checker{}.CheckViaProxyWithContext(context.Background(), ep, proxy.URL("socks5h"))
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	if n := len(p.Proxy.Stages); n == 0 || p.Proxy.Stages[n-1].Name != domain.ProxyStageTarget || p.Proxy.Verdict() != "" {
+		t.Fatalf("want every stage passed up to the target, got %v", p.Proxy.Stages)
+	}
+
+	p = Checker{}.CheckViaProxyWithContext(context.Background(), ep, "socks5h://alice:wrong@"+proxy.Addr)
+	if p.Status != domain.StatusProxyAuth || p.Proxy.Verdict() != "proxy needs auth" {
+		t.Fatalf("want proxy auth failure, got %v (%s)", p.Status, p.Error)
+	}
+
+	proxy.Block[target] = true
+	p = Checker{}.CheckViaProxyWithContext(context.Background(), ep, proxy.URL("socks5h"))
+	if p.Status != domain.StatusProxyBlocked || p.Proxy.Verdict() != "proxy blocks the target" {
+		t.Fatalf("want refusal by the proxy, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckViaProxy_HTTPS(t *testing.T) {
+	target := listener(t)
+	proxy, caFile := testutil.NewTLSConnectProxy(t)
+	ep := domain.MustNewTCPEndpoint(target, domain.EndpointTypePublic, "tcp via https proxy")
+	ep.SetProxy(proxy.URL)
+	ep.Proxy.SetCAFile(caFile)
+
+	p := Checker{}.CheckViaProxyWithContext(context.Background(), ep, proxy.URL)
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	if p.Proxy == nil || p.Proxy.TLS == nil || len(p.Proxy.TLS.Certificates) == 0 {
+		t.Fatalf("want the proxy's certificates, got %+v", p.Proxy)
+	}
+}
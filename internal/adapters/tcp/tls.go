@@ -0,0 +1,139 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/adapters/httpx"
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+// tlsTimeout bounds connecting and the handshake of a TLS probe; a handshake
+// through a proxy takes longer than localTimeOut allows.
+const tlsTimeout = 5 * time.Second
+
+// CheckTLSWithContext connects to ep.Target, directly or through proxyURL
+// ("" for direct), and completes a TLS handshake for the endpoint's server
+// name, reporting the chain presented, what was negotiated, how long
+// connecting and the handshake took, and whether a second handshake resumes
+// the session. A chain close to expiry warns or fails the probe, as does a
+// session below the endpoint's requirements.
+func (c Checker) CheckTLSWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe {
+	host, _, err := net.SplitHostPort(ep.Target)
+	if err != nil {
+		return domain.NewFailedProbe(
+			ep,
+			domain.StatusInvalid,
+			errors.New("invalid target format, expected host:port"),
+		)
+	}
+	serverName := ep.TLS.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tlsTimeout)
+	defer cancel()
+
+	trust, err := httpx.LoadTrust(ep.TLS)
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("TLS settings: %w", err))
+	}
+
+	var (
+		proxy      *domain.ProxyDetails
+		proxyTrust *httpx.Trust
+	)
+	if proxyURL != "" {
+		proxyTrust, err = httpx.LoadTrust(ep.ProxyTLS())
+		if err != nil {
+			return domain.NewFailedProbe(ep, domain.StatusInvalid, fmt.Errorf("proxy TLS settings: %w", err))
+		}
+		proxy = proxyDetails(proxyURL)
+	}
+	// dial reaches the target as the probe does, recording into proxy
+	dial := func(proxy *domain.ProxyDetails) (net.Conn, error) {
+		if proxyURL == "" {
+			return (&net.Dialer{}).DialContext(ctx, "tcp", ep.Target)
+		}
+		return dialViaProxy(ctx, ep, proxyURL, proxyTrust, proxy)
+	}
+
+	start := time.Now()
+	conn, err := dial(proxy)
+	if err != nil {
+		if proxy != nil {
+			return proxyFailure(ep, proxy, err, ctx.Err())
+		}
+		return domain.NewFailedProbe(ep, mapErrorToStatus(err, ctx.Err()), err)
+	}
+	connectMs := time.Since(start).Seconds() * 1000
+
+	hsOpts := httpx.HandshakeOptions{ALPN: alpnOffer(ep.TLS.ALPN), Sessions: tls.NewLRUClientSessionCache(1)}
+	start = time.Now()
+	details, err := httpx.HandshakeOverConn(ctx, conn, serverName, trust, hsOpts)
+	handshakeMs := time.Since(start).Seconds() * 1000
+
+	if proxy != nil {
+		stage := domain.ProxyStage{Name: domain.ProxyStageTarget, Status: domain.StatusPass, LatencyMs: handshakeMs, Detail: "TLS handshake"}
+		if err != nil {
+			stage.Status, stage.Detail = domain.StatusFail, err.Error()
+		}
+		proxy.Stages = append(proxy.Stages, stage)
+	}
+	if ce, ok := httpx.AsCertError(err); ok {
+		details.ConnectMs = connectMs
+		details.HandshakeMs = handshakeMs
+		p := domain.NewFailedProbe(ep, domain.StatusCertInvalid,
+			domain.Errorf(domain.ErrorCodeCertInvalid, "certificate of %s for %q: %w", ep.Target, serverName, ce))
+		p.TLS = details
+		p.Proxy = proxy
+		return p
+	}
+	if err != nil {
+		status := domain.StatusFail
+		if mapErrorToStatus(err, ctx.Err()) == domain.StatusTimeout {
+			status = domain.StatusTimeout
+		}
+		p := domain.NewFailedProbe(ep, status,
+			domain.Errorf(domain.ErrorCodeTLSFailed, "TLS handshake with %s as %q: %w", ep.Target, serverName, err))
+		p.Proxy = proxy
+		return p
+	}
+	details.ConnectMs = connectMs
+	details.HandshakeMs = handshakeMs
+
+	// a second handshake offering the first one's session
+	if conn, err := dial(proxyDetails(proxyURL)); err == nil {
+		if again, err := httpx.HandshakeOverConn(ctx, conn, serverName, trust, hsOpts); err == nil {
+			details.ResumptionChecked, details.Resumed = true, again.Resumed
+		}
+	}
+
+	p := domain.NewSuccessfulProbe(ep, connectMs+handshakeMs)
+	p.TLS = details
+	p.Proxy = proxy
+	if details.VerifyError != "" {
+		p.MarkWarning(domain.Errorf(domain.ErrorCodeTLSFailed, "insecure mode, certificate not trusted: %s", details.VerifyError))
+	}
+	if proxy != nil && proxy.TLS != nil && proxy.TLS.VerifyError != "" && p.IsSuccessful() {
+		p.MarkWarning(domain.Errorf(domain.ErrorCodeTLSFailed, "insecure mode, proxy certificate not trusted: %s", proxy.TLS.VerifyError))
+	}
+	p.CheckTLSPolicy(ep.TLS, time.Now())
+	return p
+}
+
+// alpnOffer is what a TLS probe offers: what a browser would, and the
+// protocol the endpoint requires if that is something else.
+func alpnOffer(required string) []string {
+	offer := []string{"h2", "http/1.1"}
+	if required != "" && !slices.Contains(offer, required) {
+		offer = append([]string{required}, offer...)
+	}
+	return offer
+}
@@ -0,0 +1,190 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+	"github.com/azargarov/rsvpck/internal/testutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+// tlsListener serves handshakes with cert.
+func tlsListener(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	return tlsListenerWith(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+}
+
+func tlsListenerWith(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckTLS(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	target := tlsListener(t, ca.Issue(t, "insite.test", false))
+	ep := domain.MustNewTLSEndpoint(target, domain.EndpointTypePublic, false, "", "cert")
+	ep.SetTLSOptions(domain.TLSOptions{CAFile: testutil.WriteCertPEM(t, "ca.pem", ca.Cert), ServerName: "insite.test"})
+
+	p := Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if !p.IsSuccessful() || p.TLS == nil {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	if p.TLS.ServerName != "insite.test" || len(p.TLS.Certificates) != 2 || !strings.Contains(p.TLS.TrustAnchor, "Test Root") {
+		t.Fatalf("unexpected details %+v", p.TLS)
+	}
+	if p.TLS.HandshakeMs <= 0 || p.LatencyMs < p.TLS.HandshakeMs {
+		t.Fatalf("want handshake timing, got %+v latency %v", p.TLS, p.LatencyMs)
+	}
+
+	ep.TLS.ServerName = "other.test"
+	p = Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if p.Status != domain.StatusCertInvalid || !strings.Contains(p.Error, `for "other.test"`) {
+		t.Fatalf("want an invalid certificate for the wrong name, got %v (%s)", p.Status, p.Error)
+	}
+	if p.TLS == nil || p.TLS.Problem != domain.CertHostnameMismatch || len(p.TLS.Certificates) != 2 {
+		t.Fatalf("want the presented chain and a hostname mismatch, got %+v", p.TLS)
+	}
+
+	ep.TLS.Insecure = true
+	p = Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if !p.IsWarning() || p.TLS == nil || p.TLS.VerifyError == "" {
+		t.Fatalf("want an insecure-mode warning, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckTLS_ViaProxy(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	target := tlsListener(t, ca.Issue(t, "insite.test", false))
+	proxy := testutil.NewConnectProxy(t)
+	ep := domain.MustNewTLSEndpoint(target, domain.EndpointTypePublic, true, proxy.URL, "cert via proxy")
+	ep.SetTLSOptions(domain.TLSOptions{CAFile: testutil.WriteCertPEM(t, "ca.pem", ca.Cert)})
+
+	p := Checker{}.CheckTLSWithContext(context.Background(), ep, proxy.URL)
+	if !p.IsSuccessful() || p.TLS == nil || p.TLS.ConnectMs <= 0 {
+		t.Fatalf("want success through the proxy, got %v (%s)", p.Status, p.Error)
+	}
+	n := len(p.Proxy.Stages)
+	if n == 0 || p.Proxy.Stages[n-1].Name != domain.ProxyStageTarget || p.Proxy.Stages[n-1].Detail != "TLS handshake" {
+		t.Fatalf("want the handshake as the target stage, got %v", p.Proxy.Stages)
+	}
+}
+
+func TestCheckTLS_Expiry(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	now := time.Now()
+	target := tlsListener(t, ca.IssueBetween(t, "insite.test", now.Add(-time.Hour), now.Add(20*24*time.Hour+time.Hour)))
+	ep := domain.MustNewTLSEndpoint(target, domain.EndpointTypePublic, false, "", "cert")
+	opts := domain.TLSOptions{CAFile: testutil.WriteCertPEM(t, "ca.pem", ca.Cert), ServerName: "insite.test"}
+
+	ep.SetTLSOptions(opts)
+	p := Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if !p.IsWarning() || !strings.Contains(p.Error, "expires in 20 days") {
+		t.Fatalf("want a warning inside the default window, got %v (%s)", p.Status, p.Error)
+	}
+
+	opts.ExpiryWarnDays, opts.ExpiryCriticalDays = 90, 30
+	ep.SetTLSOptions(opts)
+	p = Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if p.Status != domain.StatusFail || p.TLS == nil || !strings.Contains(p.Error, "expires in 20 days") {
+		t.Fatalf("want a failure past the critical days, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckTLS_Session(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	cert := ca.Issue(t, "insite.test", false)
+	cert.OCSPStaple = ca.OCSPResponse(t, cert.Leaf, ocsp.Good)
+	target := tlsListenerWith(t, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}})
+	ep := domain.MustNewTLSEndpoint(target, domain.EndpointTypePublic, false, "", "cert")
+	opts := domain.TLSOptions{CAFile: testutil.WriteCertPEM(t, "ca.pem", ca.Cert), ServerName: "insite.test"}
+	ep.SetTLSOptions(opts)
+
+	p := Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if !p.IsSuccessful() {
+		t.Fatalf("want success, got %v (%s)", p.Status, p.Error)
+	}
+	d := p.TLS
+	if d.Version != tls.VersionTLS13 || d.CipherSuite == "" || d.ALPN != "h2" {
+		t.Fatalf("want TLS 1.3 with h2, got %s %q %q", d.VersionName(), d.CipherSuite, d.ALPN)
+	}
+	if !d.OCSPStapled || d.OCSPStatus != domain.OCSPGood {
+		t.Fatalf("want a good stapled response, got %v %q", d.OCSPStapled, d.OCSPStatus)
+	}
+	if !d.ResumptionChecked || !d.Resumed {
+		t.Fatalf("want the session resumed, got checked %v resumed %v", d.ResumptionChecked, d.Resumed)
+	}
+
+	cert.OCSPStaple = ca.OCSPResponse(t, cert.Leaf, ocsp.Revoked)
+	revoked := tlsListener(t, cert)
+	ep = domain.MustNewTLSEndpoint(revoked, domain.EndpointTypePublic, false, "", "cert")
+	ep.SetTLSOptions(opts)
+	if p := (Checker{}).CheckTLSWithContext(context.Background(), ep, ""); p.Status != domain.StatusCertInvalid || !strings.Contains(p.Error, "revoked") {
+		t.Fatalf("want a revoked certificate failed, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckTLS_Requirements(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	// a proxy that downgrades and strips h2 looks like this
+	target := tlsListenerWith(t, &tls.Config{
+		Certificates: []tls.Certificate{ca.Issue(t, "insite.test", false)},
+		MinVersion:   tls.VersionTLS10,
+		MaxVersion:   tls.VersionTLS10,
+		NextProtos:   []string{"http/1.1"},
+	})
+	ep := domain.MustNewTLSEndpoint(target, domain.EndpointTypePublic, false, "", "cert")
+	opts := domain.TLSOptions{CAFile: testutil.WriteCertPEM(t, "ca.pem", ca.Cert), ServerName: "insite.test"}
+
+	opts.MinVersion = tls.VersionTLS12
+	ep.SetTLSOptions(opts)
+	p := Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if p.Status != domain.StatusFail || !strings.Contains(p.Error, "negotiated TLS 1.0, below the required TLS 1.2") {
+		t.Fatalf("want the downgrade named, got %v (%s)", p.Status, p.Error)
+	}
+
+	opts.MinVersion, opts.ALPN = tls.VersionTLS10, "h2"
+	ep.SetTLSOptions(opts)
+	p = Checker{}.CheckTLSWithContext(context.Background(), ep, "")
+	if p.Status != domain.StatusFail || !strings.Contains(p.Error, "negotiated ALPN http/1.1, want h2") {
+		t.Fatalf("want the stripped h2 named, got %v (%s)", p.Status, p.Error)
+	}
+}
+
+func TestCheckInterception(t *testing.T) {
+	ca := testutil.NewCA(t, "Test Root")
+	target := tlsListener(t, ca.Issue(t, "insite.test", false))
+	clean := testutil.NewConnectProxy(t)
+	ep, _ := domain.NewInterceptionEndpoint(target, domain.EndpointTypePublic, "interception")
+	ep.SetInterceptionOptions(domain.InterceptionOptions{ServerName: "insite.test", Proxies: []string{clean.URL}})
+
+	p := Checker{}.CheckInterceptionWithContext(context.Background(), ep)
+	if !p.IsSuccessful() || p.Interception == nil || len(p.Interception.Paths) != 2 {
+		t.Fatalf("want both paths compared and passing, got %v (%s)", p.Status, p.Error)
+	}
+
+	inspecting := testutil.NewInspectingProxy(t)
+	ep.Interception.Proxies = []string{clean.URL, inspecting.URL}
+	p = Checker{}.CheckInterceptionWithContext(context.Background(), ep)
+	if p.Status != domain.StatusIntercepted || !strings.Contains(p.Error, testutil.InspectionCAName) {
+		t.Fatalf("want the inspecting proxy to fail the probe, got %v (%s)", p.Status, p.Error)
+	}
+}
@@ -50,6 +50,13 @@ func (e *Executor) Run(ctx context.Context, config domain.NetTestConfig) domain.
 	return domain.AnalyzeConnectivity(probes, config)
 }
 
+// RunEndpoints probes endpoints outside the connectivity analysis, as the
+// speedtest does.
+func (e *Executor) RunEndpoints(ctx context.Context, endpoints []domain.Endpoint) []domain.Probe {
+	defer e.pool.Stop()
+	return e.runEndpointCheck(ctx, endpoints)
+}
+
 func (e Executor) runEndpointCheck(parentctx context.Context, endpoints []domain.Endpoint) []domain.Probe {
 
 	n := len(endpoints)
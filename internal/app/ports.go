@@ -3,6 +3,8 @@ package app
 
 import (
 	"context"
+	"net/url"
+	"strings"
 
 	"github.com/azargarov/rsvpck/internal/domain"
 	"github.com/azargarov/rsvpck/internal/ports"
@@ -17,6 +19,8 @@ type CompositeProber struct {
 	dns  ports.DNSPort
 	http ports.HTTPPort
 	icmp ports.ICMPPort
+	pac    ports.PACPort         // routes endpoints configured with a PAC script
+	system ports.SystemProxyPort // routes endpoints by the environment's proxy settings
 }
 
 func NewCompositeProber(
@@ -28,21 +32,183 @@ func NewCompositeProber(
 	return &CompositeProber{tcp: tcp, dns: dns, http: http, icmp: icmp}
 }
 
+// WithPAC sets the evaluator for endpoints routed by a PAC script.
+func (p *CompositeProber) WithPAC(pac ports.PACPort) *CompositeProber {
+	p.pac = pac
+	return p
+}
+
+// WithSystemProxy sets the resolver for endpoints in proxy mode "system".
+func (p *CompositeProber) WithSystemProxy(system ports.SystemProxyPort) *CompositeProber {
+	p.system = system
+	return p
+}
+
 func (p *CompositeProber) Run(ctx context.Context, ep domain.Endpoint) domain.Probe {
 	switch ep.GetTargetType() {
 	case domain.TargetTypeICMP:
 		return p.icmp.CheckPingWithContext(ctx, ep)
 	case domain.TargetTypeTCP:
+		if ep.Proxy.UsesPAC() || ep.Proxy.UsesSystem() {
+			return p.runRouted(ctx, ep, p.tcp.CheckWithContext, p.tcp.CheckViaProxyWithContext)
+		}
+		if ep.MustUseProxy() {
+			return p.tcp.CheckViaProxyWithContext(ctx, ep, ep.Proxy.URL())
+		}
 		return p.tcp.CheckWithContext(ctx, ep)
+	case domain.TargetTypeTLS:
+		if ep.Proxy.UsesPAC() || ep.Proxy.UsesSystem() {
+			direct := func(ctx context.Context, ep domain.Endpoint) domain.Probe {
+				return p.tcp.CheckTLSWithContext(ctx, ep, "")
+			}
+			return p.runRouted(ctx, ep, direct, p.tcp.CheckTLSWithContext)
+		}
+		if ep.MustUseProxy() {
+			return p.tcp.CheckTLSWithContext(ctx, ep, ep.Proxy.URL())
+		}
+		return p.tcp.CheckTLSWithContext(ctx, ep, "")
+	case domain.TargetTypeInterception:
+		return p.tcp.CheckInterceptionWithContext(ctx, ep)
 	case domain.TargetTypeHTTP:
+		if ep.Proxy.UsesPAC() || ep.Proxy.UsesSystem() {
+			return p.runRouted(ctx, ep, p.http.CheckWithContext, p.http.CheckViaProxyWithContext)
+		}
 		if ep.MustUseProxy() {
 			return p.http.CheckViaProxyWithContext(ctx, ep, ep.Proxy.URL())
 		}
 		return p.http.CheckWithContext(ctx, ep)
+	case domain.TargetTypeCaptivePortal:
+		return p.http.CheckCaptivePortalWithContext(ctx, ep)
+	case domain.TargetTypeThroughput:
+		if ep.Proxy.UsesPAC() || ep.Proxy.UsesSystem() {
+			direct := func(ctx context.Context, ep domain.Endpoint) domain.Probe {
+				return p.http.CheckThroughputWithContext(ctx, ep, "")
+			}
+			return p.runRouted(ctx, ep, direct, p.http.CheckThroughputWithContext)
+		}
+		return p.http.CheckThroughputWithContext(ctx, ep, ep.Proxy.URL())
+	case domain.TargetTypeBandwidth:
+		return p.http.CheckBandwidthWithContext(ctx, ep)
 	case domain.TargetTypeDNS:
 		return p.dns.CheckWithContext(ctx, ep)
+	case domain.TargetTypeDoH:
+		if ep.Proxy.UsesPAC() || ep.Proxy.UsesSystem() {
+			direct := func(ctx context.Context, ep domain.Endpoint) domain.Probe {
+				return p.dns.CheckDoHWithContext(ctx, ep, "")
+			}
+			return p.runRouted(ctx, ep, direct, p.dns.CheckDoHWithContext)
+		}
+		return p.dns.CheckDoHWithContext(ctx, ep, ep.Proxy.URL())
+	case domain.TargetTypeDoT:
+		return p.dns.CheckDoTWithContext(ctx, ep)
 	default:
 		return domain.NewFailedProbe(ep, domain.StatusInvalid,
 			domain.Errorf(domain.ErrorCodeInvalidConfig, "unknown target type"))
 	}
 }
+
+// runRouted probes ep directly or through the proxy its PAC script or the
+// environment picks for it, and records that route on the probe. A PAC
+// script may name several routes; they are tried in order, as a browser
+// would, until one connects.
+func (p *CompositeProber) runRouted(
+	ctx context.Context,
+	ep domain.Endpoint,
+	direct func(context.Context, domain.Endpoint) domain.Probe,
+	viaProxy func(context.Context, domain.Endpoint, string) domain.Probe,
+) domain.Probe {
+	routes, source, err := p.route(ctx, ep)
+	if err != nil {
+		return domain.NewFailedProbe(ep, domain.StatusFail, err)
+	}
+
+	var (
+		probe  domain.Probe
+		failed []string
+	)
+	for i, r := range routes {
+		if r.proxyURL == "" {
+			probe = direct(ctx, ep)
+		} else {
+			probe = viaProxy(ctx, ep, r.proxyURL)
+		}
+		if probe.Proxy == nil {
+			probe.Proxy = &domain.ProxyDetails{URL: r.proxyURL}
+		}
+		probe.Proxy.Route = r.route
+		probe.Proxy.RouteSource = source
+		probe.Proxy.FailedRoutes = failed
+		if i == len(routes)-1 || connected(probe) || ctx.Err() != nil {
+			break
+		}
+		failed = append(failed, r.route)
+	}
+	return probe
+}
+
+// connected reports whether probe got through its route: the proxy was
+// reached, or going direct, the target was. What happened after that is
+// the target's answer and no reason to try another route.
+func connected(probe domain.Probe) bool {
+	if probe.IsSuccessful() {
+		return true
+	}
+	if stage, failed := domain.FailedProxyStage(probe.Proxy.Stages); failed {
+		return stage.Name != domain.ProxyStageTCP && stage.Name != domain.ProxyStageTLS
+	}
+	switch probe.Status {
+	case domain.StatusTimeout, domain.StatusConnectionRefused, domain.StatusDNSFailure:
+		return false
+	}
+	return true
+}
+
+// candidateRoute is one way to reach a target: through proxyURL, or direct
+// when it is empty, with the route as shown to the user.
+type candidateRoute struct {
+	proxyURL string
+	route    string
+}
+
+// route returns the routes for ep in order of preference and what chose
+// them.
+func (p *CompositeProber) route(ctx context.Context, ep domain.Endpoint) ([]candidateRoute, string, error) {
+	if ep.Proxy.UsesPAC() {
+		if p.pac == nil {
+			return nil, "", domain.Errorf(domain.ErrorCodePACFailed, "no PAC evaluator configured")
+		}
+		// FindProxyForURL takes a URL; a host:port target is asked for as https
+		target := ep.Target
+		if !strings.Contains(target, "://") {
+			target = "https://" + target
+		}
+		routes, err := p.pac.FindProxyWithContext(ctx, ep.Proxy.PAC(), target)
+		if err != nil {
+			return nil, "", err
+		}
+		out := make([]candidateRoute, 0, len(routes))
+		for _, r := range routes {
+			out = append(out, candidateRoute{proxyURL: r.ProxyURL(), route: r.String()})
+		}
+		return out, "PAC", nil
+	}
+
+	if p.system == nil {
+		return nil, "", domain.Errorf(domain.ErrorCodeInvalidConfig, "no system proxy resolver configured")
+	}
+	proxyURL, err := p.system.ProxyForURL(ep.Target)
+	if err != nil {
+		return nil, "", domain.Errorf(domain.ErrorCodeInvalidConfig, "environment proxy: %w", err)
+	}
+	if proxyURL == "" {
+		return []candidateRoute{{route: "DIRECT"}}, "environment", nil
+	}
+	return []candidateRoute{{proxyURL: proxyURL, route: "PROXY " + redacted(proxyURL)}}, "environment", nil
+}
+
+func redacted(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return rawURL
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/azargarov/rsvpck/internal/domain"
@@ -14,10 +16,17 @@ import (
 
 type FileSpec struct {
 	ProxyURL        string         `json:"proxyURL"        yaml:"proxyURL"`
+	ProxyCAFile     string         `json:"proxyCAFile"     yaml:"proxyCAFile"` // PEM roots for an https:// proxy
+	PACURL          string         `json:"pacURL"          yaml:"pacURL"`      // routes useProxy endpoints instead of proxyURL
+	PACFile         string         `json:"pacFile"         yaml:"pacFile"`
+	ProxyMode       string         `json:"proxyMode"       yaml:"proxyMode"` // "" (proxyURL or PAC) or "system"
 	VPNIPs			[]string	   `json:"vpnIPs"          yaml:"vpnIPs"`
+	ExpectedIssuers []string       `json:"expectedIssuers" yaml:"expectedIssuers"` // issuers a genuine chain may have; others are inspection CAs
+	TLS             *TLSSpec       `json:"tls"             yaml:"tls"` // default for HTTP and TCP endpoints and the certificate check
 	VPNEndpoints    []EndpointSpec `json:"vpnEndpoints"    yaml:"vpnEndpoints"`
 	DirectEndpoints []EndpointSpec `json:"directEndpoints" yaml:"directEndpoints"`
 	ProxyEndpoints  []EndpointSpec `json:"proxyEndpoints"  yaml:"proxyEndpoints"`
+	SpeedtestEndpoints []EndpointSpec `json:"speedtestEndpoints" yaml:"speedtestEndpoints"` // kind throughput or bandwidth, run by --speedtest
 }
 
 type EndpointSpec struct {
@@ -26,6 +35,96 @@ type EndpointSpec struct {
 	Kind     string `json:"kind"     yaml:"kind"`     
 	Note     string `json:"note"     yaml:"note"`     
 	UseProxy bool   `json:"useProxy" yaml:"useProxy"` 
+	AnyOf    string `json:"anyOf"    yaml:"anyOf"` // endpoints naming the same group pass when one of them does
+
+	// DNS, DoH and DoT
+	Query     string   `json:"query"     yaml:"query"`
+	Servers   []string `json:"servers"   yaml:"servers"`
+	Transport string   `json:"transport" yaml:"transport"`
+	Compare   bool     `json:"compare"   yaml:"compare"`
+	Record    string   `json:"record"    yaml:"record"`
+	Answers   []string `json:"expectAnswers" yaml:"expectAnswers"`
+	Partial   bool     `json:"expectPartial" yaml:"expectPartial"` // an expected value may match an answer's last field, "10 mx.example.com"
+	Hijack    bool     `json:"hijackCheck"   yaml:"hijackCheck"`
+
+	// HTTP
+	Method          string            `json:"method"          yaml:"method"`
+	Headers         map[string]string `json:"headers"         yaml:"headers"` // values may use $VAR / ${VAR}
+	Body            string            `json:"body"            yaml:"body"`
+	BodyFile        string            `json:"bodyFile"        yaml:"bodyFile"`
+	Expect          *HTTPExpectSpec   `json:"expect"          yaml:"expect"`
+	FollowRedirects bool              `json:"followRedirects" yaml:"followRedirects"`
+	MaxRedirects    int               `json:"maxRedirects"    yaml:"maxRedirects"`
+	AllowedHosts    []string          `json:"allowedHosts"    yaml:"allowedHosts"`
+
+	// Captive portal; the target and body default to a well-known check URL
+	ExpectStatus int    `json:"expectStatus" yaml:"expectStatus"`
+	ExpectBody   string `json:"expectBody"   yaml:"expectBody"`
+
+	// Throughput; the download size defaults to 10 MiB, the upload URL to the target
+	DownloadBytes int64   `json:"downloadBytes" yaml:"downloadBytes"`
+	UploadBytes   int64   `json:"uploadBytes"   yaml:"uploadBytes"`
+	UploadURL     string  `json:"uploadURL"     yaml:"uploadURL"`
+	StallMs       float64 `json:"stallMs"       yaml:"stallMs"`
+
+	// Bandwidth, against a peer running rsvpck serve; the port defaults to 5201
+	Seconds  int  `json:"seconds"  yaml:"seconds"` // per direction, default 5
+	Pings    int  `json:"pings"    yaml:"pings"`   // default 10
+	NoUpload bool `json:"noUpload" yaml:"noUpload"`
+
+	// TLS; the port defaults to 443, the SNI to the target's host
+	SNI string `json:"sni" yaml:"sni"`
+	Via string `json:"via" yaml:"via"` // a proxy to handshake through instead of proxyURL, such as a VPN IP
+
+	// HTTP, TCP through a proxy and TLS; replaces the top-level tls block
+	TLS *TLSSpec `json:"tls" yaml:"tls"`
+}
+
+type TLSSpec struct {
+	CAFile         string `json:"caFile"         yaml:"caFile"`
+	CADir          string `json:"caDir"          yaml:"caDir"`
+	ClientCert     string `json:"clientCert"     yaml:"clientCert"` // PEM, or PKCS#12 (.p12/.pfx) with the key
+	ClientKey      string `json:"clientKey"      yaml:"clientKey"`
+	ClientPassword string `json:"clientPassword" yaml:"clientPassword"` // of a PKCS#12 bundle; may use $VAR / ${VAR}
+	Insecure       bool   `json:"insecure"       yaml:"insecure"`
+
+	MinVersion string `json:"minVersion" yaml:"minVersion"` // "1.2"; a lower negotiated version fails the probe
+	ALPN       string `json:"alpn"       yaml:"alpn"`       // "h2"; another or no protocol fails the probe
+
+	// SHA-256 pins, hex or base64 ("sha256/..."); the chain must match one of any kind
+	SPKIPins           []string `json:"spkiPins"           yaml:"spkiPins"` // of a public key anywhere in the chain
+	LeafFingerprints   []string `json:"leafFingerprints"   yaml:"leafFingerprints"`
+	IssuerFingerprints []string `json:"issuerFingerprints" yaml:"issuerFingerprints"`
+
+	// days before a certificate expires to warn, and to fail; default 30 and 7, -1 for never
+	ExpiryWarnDays     int `json:"expiryWarnDays"     yaml:"expiryWarnDays"`
+	ExpiryCriticalDays int `json:"expiryCriticalDays" yaml:"expiryCriticalDays"`
+}
+
+type HTTPExpectSpec struct {
+	Status        statusList `json:"status"        yaml:"status"`
+	BodyContains  string     `json:"bodyContains"  yaml:"bodyContains"`
+	BodyRegex     string     `json:"bodyRegex"     yaml:"bodyRegex"`
+	BodyLimit     int64      `json:"bodyLimit"     yaml:"bodyLimit"`
+	Headers       []string   `json:"headers"       yaml:"headers"`
+	ForbidHeaders []string   `json:"forbidHeaders" yaml:"forbidHeaders"`
+	MaxLatencyMs  float64    `json:"maxLatencyMs"  yaml:"maxLatencyMs"`
+}
+
+// statusList accepts status codes written as numbers or as strings ("2xx").
+type statusList []string
+
+func (l *statusList) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	out := make(statusList, 0, len(raw))
+	for _, r := range raw {
+		out = append(out, strings.Trim(string(r), `"`))
+	}
+	*l = out
+	return nil
 }
 
 func LoadFromFile(path string) (domain.NetTestConfig, error) {
@@ -68,7 +167,44 @@ func parseConfigBytes(b []byte, ext string) (domain.NetTestConfig, error) {
 }
 
 func specToDomain(spec FileSpec) (domain.NetTestConfig, error) {
-	toEndpoint := func(s EndpointSpec) (domain.Endpoint, error) {
+	if spec.PACURL != "" && spec.PACFile != "" {
+		return domain.NetTestConfig{}, errors.New("pacURL and pacFile are mutually exclusive")
+	}
+	if spec.PACURL != "" {
+		if u, err := url.Parse(spec.PACURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return domain.NetTestConfig{}, fmt.Errorf("pacURL must be an http(s) URL, got %q", spec.PACURL)
+		}
+	}
+	if spec.PACFile != "" {
+		if _, err := os.Stat(spec.PACFile); err != nil {
+			return domain.NetTestConfig{}, fmt.Errorf("pacFile: %w", err)
+		}
+	}
+	pac := domain.PACSource{URL: spec.PACURL, File: spec.PACFile}
+	var system bool
+	switch spec.ProxyMode {
+	case "":
+	case "system":
+		if !pac.IsZero() {
+			return domain.NetTestConfig{}, errors.New(`proxyMode "system" cannot be combined with pacURL or pacFile`)
+		}
+		system = true
+	default:
+		return domain.NetTestConfig{}, fmt.Errorf("unknown proxyMode %q", spec.ProxyMode)
+	}
+
+	defaultTLS, err := tlsOptions(spec.TLS)
+	if err != nil {
+		return domain.NetTestConfig{}, fmt.Errorf("tls: %w", err)
+	}
+	endpointTLS := func(s EndpointSpec) (domain.TLSOptions, error) {
+		if s.TLS == nil {
+			return defaultTLS, nil
+		}
+		return tlsOptions(s.TLS)
+	}
+
+	kindEndpoint := func(s EndpointSpec) (domain.Endpoint, error) {
 		etype := domain.EndpointTypePublic
 		if s.Type == "vpn" {
 			etype = domain.EndpointTypeVPN
@@ -78,18 +214,145 @@ func specToDomain(spec FileSpec) (domain.NetTestConfig, error) {
 		case "icmp":
 			return domain.MustNewICMPEndpoint(s.Target, etype, s.Note), nil
 		case "dns":
-			return domain.MustNewDNSEndpoint(s.Target, etype, s.Note), nil
+			ep := domain.MustNewDNSEndpoint(s.Target, etype, s.Note)
+			opts, err := dnsOptions(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetDNSOptions(opts)
+			return ep, nil
+		case "doh", "dot":
+			var (
+				ep  domain.Endpoint
+				err error
+			)
+			if s.Kind == "doh" {
+				ep, err = domain.NewDoHEndpoint(s.Target, etype, s.Note)
+				if s.UseProxy {
+					ep.SetProxy(spec.ProxyURL)
+				}
+			} else {
+				ep, err = domain.NewDoTEndpoint(s.Target, etype, s.Note)
+			}
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			opts, err := dnsOptions(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetDNSOptions(opts)
+			return ep, nil
 		case "tcp":
-			return domain.MustNewTCPEndpoint(s.Target, etype, s.Note), nil
+			ep := domain.MustNewTCPEndpoint(s.Target, etype, s.Note)
+			if s.UseProxy {
+				ep.SetProxy(spec.ProxyURL)
+			}
+			tlsOpts, err := endpointTLS(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetTLSOptions(tlsOpts)
+			return ep, nil
+		case "tls":
+			ep, err := domain.NewTLSEndpoint(s.Target, etype, s.Note)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			switch {
+			case s.Via != "":
+				ep.SetProxy(s.Via)
+			case s.UseProxy:
+				ep.SetProxy(spec.ProxyURL)
+			}
+			tlsOpts, err := endpointTLS(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			tlsOpts.ServerName = s.SNI
+			ep.SetTLSOptions(tlsOpts)
+			return ep, nil
+		case "interception":
+			if s.UseProxy {
+				return domain.Endpoint{}, errors.New("interception checks go direct and through proxyURL and each VPN IP; useProxy is not supported")
+			}
+			ep, err := domain.NewInterceptionEndpoint(s.Target, etype, s.Note)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetInterceptionOptions(domain.InterceptionOptions{ServerName: s.SNI})
+			return ep, nil
 		case "http":
-			return domain.MustNewHTTPEndpoint(s.Target, etype, s.UseProxy, spec.ProxyURL, s.Note), nil
+			ep := domain.MustNewHTTPEndpoint(s.Target, etype, s.UseProxy, spec.ProxyURL, s.Note)
+			opts, err := httpOptions(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetHTTPOptions(opts)
+			tlsOpts, err := endpointTLS(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetTLSOptions(tlsOpts)
+			return ep, nil
+		case "captive":
+			target, opts := s.Target, domain.CaptivePortalOptions{ExpectStatus: s.ExpectStatus, ExpectBody: s.ExpectBody}
+			if target == "" {
+				target = domain.DefaultCaptivePortalURL
+				if opts.ExpectBody == "" {
+					opts.ExpectBody = domain.DefaultCaptivePortalBody
+				}
+			}
+			ep, err := domain.NewCaptivePortalEndpoint(target, etype, s.Note)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetCaptivePortalOptions(opts)
+			return ep, nil
+		case "throughput":
+			ep, err := domain.NewThroughputEndpoint(s.Target, etype, s.Note)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			if s.UseProxy {
+				ep.SetProxy(spec.ProxyURL)
+			}
+			opts, err := throughputOptions(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetThroughputOptions(opts)
+			tlsOpts, err := endpointTLS(s)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetTLSOptions(tlsOpts)
+			return ep, nil
+		case "bandwidth":
+			if s.UseProxy {
+				return domain.Endpoint{}, errors.New("bandwidth peers are reached directly; useProxy is not supported")
+			}
+			if s.Seconds < 0 || s.Seconds > 60 || s.Pings < 0 {
+				return domain.Endpoint{}, errors.New("seconds must be 0 to 60 and pings cannot be negative")
+			}
+			ep, err := domain.NewBandwidthEndpoint(s.Target, etype, s.Note)
+			if err != nil {
+				return domain.Endpoint{}, err
+			}
+			ep.SetBandwidthOptions(domain.BandwidthOptions{Seconds: s.Seconds, Pings: s.Pings, NoUpload: s.NoUpload})
+			return ep, nil
 		default:
 			return domain.Endpoint{}, fmt.Errorf("unknown endpoint kind: %s", s.Kind)
 		}
 	}
 
+	toEndpoint := func(s EndpointSpec) (domain.Endpoint, error) {
+		ep, err := kindEndpoint(s)
+		ep.AnyOf = s.AnyOf
+		return ep, err
+	}
+
 	var vpn, direct, proxy []domain.Endpoint
-	var err error
 
 	for _, e := range spec.VPNEndpoints {
 		ep, eerr := toEndpoint(e)
@@ -115,10 +378,296 @@ func specToDomain(spec FileSpec) (domain.NetTestConfig, error) {
 		}
 		proxy = append(proxy, ep)
 	}
+	var speedtest []domain.Endpoint
+	for _, e := range spec.SpeedtestEndpoints {
+		if e.Kind == "" {
+			e.Kind = "throughput"
+		}
+		if e.Kind != "throughput" && e.Kind != "bandwidth" {
+			err = fmt.Errorf("speedtest endpoint %q: kind must be throughput or bandwidth", e.Target)
+			break
+		}
+		ep, eerr := toEndpoint(e)
+		if eerr != nil {
+			err = fmt.Errorf("speedtest endpoint %q: %w", e.Target, eerr)
+			break
+		}
+		speedtest = append(speedtest, ep)
+	}
 	
 	if err != nil {
 		return domain.NetTestConfig{}, err
 	}
 
-	return domain.NewNetTestConfig(vpn, direct, proxy, spec.ProxyURL, spec.VPNIPs)
+	// a PAC script or the environment routes every kind that can go through
+	// a proxy, just as proxyURL does; an endpoint with its own via keeps it
+	if system || !pac.IsZero() {
+		specs := [][]EndpointSpec{spec.VPNEndpoints, spec.DirectEndpoints, spec.ProxyEndpoints, spec.SpeedtestEndpoints}
+		for n, eps := range [][]domain.Endpoint{vpn, direct, proxy, speedtest} {
+			for i := range eps {
+				if !eps[i].Proxy.Enabled() || specs[n][i].Via != "" {
+					continue
+				}
+				if system {
+					eps[i].Proxy.SetSystem()
+				} else {
+					eps[i].Proxy.SetPAC(pac)
+				}
+			}
+		}
+	}
+
+	if spec.ProxyCAFile != "" {
+		if _, err := os.Stat(spec.ProxyCAFile); err != nil {
+			return domain.NetTestConfig{}, fmt.Errorf("proxyCAFile: %w", err)
+		}
+		for _, eps := range [][]domain.Endpoint{vpn, direct, proxy, speedtest} {
+			for i := range eps {
+				if eps[i].Proxy.Enabled() {
+					eps[i].Proxy.SetCAFile(spec.ProxyCAFile)
+				}
+			}
+		}
+	}
+
+	cfg, err := domain.NewNetTestConfig(vpn, direct, proxy, spec.ProxyURL, spec.VPNIPs)
+	if err != nil {
+		return domain.NetTestConfig{}, err
+	}
+	// the paths are known only once the whole config is
+	for _, eps := range [][]domain.Endpoint{cfg.DirectEndpoints, cfg.ProxyEndpoints} {
+		for i := range eps {
+			if eps[i].TargetType == domain.TargetTypeInterception {
+				eps[i].Interception.Proxies = cfg.InterceptionProxies()
+				eps[i].Interception.ExpectedIssuers = spec.ExpectedIssuers
+			}
+		}
+	}
+	cfg.TLS = defaultTLS
+	cfg.SpeedtestEndpoints = speedtest
+	return cfg, nil
+}
+
+func throughputOptions(s EndpointSpec) (domain.ThroughputOptions, error) {
+	opts := domain.ThroughputOptions{
+		DownloadBytes: s.DownloadBytes,
+		UploadBytes:   s.UploadBytes,
+		UploadURL:     s.UploadURL,
+		StallMs:       s.StallMs,
+	}
+	if s.DownloadBytes < 0 || s.UploadBytes < 0 || s.StallMs < 0 {
+		return opts, errors.New("downloadBytes, uploadBytes and stallMs cannot be negative")
+	}
+	if s.UploadURL != "" {
+		if u, err := url.Parse(s.UploadURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opts, fmt.Errorf("uploadURL must be an http(s) URL, got %q", s.UploadURL)
+		}
+		if s.UploadBytes == 0 {
+			return opts, errors.New("uploadURL needs uploadBytes")
+		}
+	}
+	return opts, nil
+}
+
+// tlsOptions checks that the named files exist; their contents are read when
+// a probe runs.
+func tlsOptions(s *TLSSpec) (domain.TLSOptions, error) {
+	if s == nil {
+		return domain.TLSOptions{}, nil
+	}
+	opts := domain.TLSOptions{
+		CAFile:     s.CAFile,
+		CADir:      s.CADir,
+		ClientCert: s.ClientCert,
+		ClientKey:  s.ClientKey,
+		Insecure:   s.Insecure,
+
+		ALPN:       s.ALPN,
+
+		ExpiryWarnDays:     s.ExpiryWarnDays,
+		ExpiryCriticalDays: s.ExpiryCriticalDays,
+	}
+	for _, kind := range []struct {
+		name string
+		in   []string
+		out  *[]string
+	}{
+		{"spkiPins", s.SPKIPins, &opts.Pins.SPKI},
+		{"leafFingerprints", s.LeafFingerprints, &opts.Pins.Leaf},
+		{"issuerFingerprints", s.IssuerFingerprints, &opts.Pins.Issuer},
+	} {
+		for _, raw := range kind.in {
+			pin, err := domain.ParsePin(raw)
+			if err != nil {
+				return opts, fmt.Errorf("%s: %w", kind.name, err)
+			}
+			*kind.out = append(*kind.out, pin)
+		}
+	}
+	if s.MinVersion != "" {
+		v, err := domain.ParseTLSVersion(s.MinVersion)
+		if err != nil {
+			return opts, fmt.Errorf("minVersion: %w", err)
+		}
+		opts.MinVersion = v
+	}
+	if s.ClientKey != "" && s.ClientCert == "" {
+		return opts, errors.New("clientKey needs clientCert")
+	}
+	if warn, critical := opts.ExpiryThresholds(); warn >= 0 && critical > warn {
+		return opts, fmt.Errorf("expiryCriticalDays (%d) cannot exceed expiryWarnDays (%d)", critical, warn)
+	}
+	for name, path := range map[string]string{"caFile": s.CAFile, "caDir": s.CADir, "clientCert": s.ClientCert, "clientKey": s.ClientKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return opts, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	password, err := expandEnv(s.ClientPassword)
+	if err != nil {
+		return opts, fmt.Errorf("clientPassword: %w", err)
+	}
+	opts.ClientPassword = password
+	return opts, nil
+}
+
+func dnsOptions(s EndpointSpec) (domain.DNSOptions, error) {
+	transport, err := domain.ParseDNSTransport(s.Transport)
+	if err != nil {
+		return domain.DNSOptions{}, err
+	}
+	rtype, err := domain.ParseDNSRecordType(s.Record)
+	if err != nil {
+		return domain.DNSOptions{}, err
+	}
+	opts := domain.DNSOptions{Query: s.Query, Compare: s.Compare, RecordType: rtype, HijackCheck: s.Hijack, PartialMatch: s.Partial}
+	for _, raw := range s.Servers {
+		srv, err := domain.ParseDNSServer(raw, transport)
+		if err != nil {
+			return domain.DNSOptions{}, err
+		}
+		opts.Servers = append(opts.Servers, srv)
+	}
+	for _, raw := range s.Answers {
+		exp, err := domain.ParseDNSExpect(raw)
+		if err != nil {
+			return domain.DNSOptions{}, err
+		}
+		opts.Expect = append(opts.Expect, exp)
+	}
+	if opts.Compare && len(opts.Servers) == 0 {
+		return domain.DNSOptions{}, errors.New("compare mode needs at least one DNS server")
+	}
+	return opts, nil
+}
+
+func httpOptions(s EndpointSpec) (domain.HTTPOptions, error) {
+	opts := domain.HTTPOptions{
+		FollowRedirects: s.FollowRedirects,
+		MaxRedirects:    s.MaxRedirects,
+		AllowedHosts:    s.AllowedHosts,
+	}
+	if s.MaxRedirects < 0 {
+		return opts, errors.New("maxRedirects cannot be negative")
+	}
+	if (s.MaxRedirects > 0 || len(s.AllowedHosts) > 0) && !s.FollowRedirects {
+		return opts, errors.New("maxRedirects and allowedHosts need followRedirects: true")
+	}
+	req, err := httpRequest(s)
+	if err != nil {
+		return opts, err
+	}
+	opts.Request = req
+	if s.Expect == nil {
+		return opts, nil
+	}
+	e := s.Expect
+	exp := domain.HTTPExpect{
+		BodyContains: e.BodyContains,
+		BodyLimit:    e.BodyLimit,
+		MaxLatencyMs: e.MaxLatencyMs,
+	}
+	for _, raw := range e.Status {
+		r, err := domain.ParseHTTPStatusRange(raw)
+		if err != nil {
+			return opts, err
+		}
+		exp.Statuses = append(exp.Statuses, r)
+	}
+	if e.BodyRegex != "" {
+		re, err := regexp.Compile(e.BodyRegex)
+		if err != nil {
+			return opts, fmt.Errorf("invalid body regex %q: %w", e.BodyRegex, err)
+		}
+		exp.BodyRegex = re
+	}
+	for _, raw := range e.Headers {
+		h, err := domain.ParseHTTPHeaderMatch(raw)
+		if err != nil {
+			return opts, err
+		}
+		exp.RequireHeaders = append(exp.RequireHeaders, h)
+	}
+	for _, raw := range e.ForbidHeaders {
+		h, err := domain.ParseHTTPHeaderMatch(raw)
+		if err != nil {
+			return opts, err
+		}
+		exp.ForbidHeaders = append(exp.ForbidHeaders, h)
+	}
+	if exp.BodyLimit < 0 || exp.MaxLatencyMs < 0 {
+		return opts, errors.New("bodyLimit and maxLatencyMs cannot be negative")
+	}
+	opts.Expect = exp
+	return opts, nil
+}
+
+func httpRequest(s EndpointSpec) (domain.Request, error) {
+	method, err := domain.ParseHTTPMethod(s.Method)
+	if err != nil {
+		return domain.Request{}, err
+	}
+	req := domain.Request{Method: method}
+	for name, raw := range s.Headers {
+		value, err := expandEnv(raw)
+		if err != nil {
+			return domain.Request{}, fmt.Errorf("header %q: %w", name, err)
+		}
+		if req.Headers == nil {
+			req.Headers = make(map[string]string, len(s.Headers))
+		}
+		req.Headers[name] = value
+	}
+	switch {
+	case s.Body != "" && s.BodyFile != "":
+		return domain.Request{}, errors.New("body and bodyFile are mutually exclusive")
+	case s.BodyFile != "":
+		b, err := os.ReadFile(s.BodyFile)
+		if err != nil {
+			return domain.Request{}, fmt.Errorf("bodyFile: %w", err)
+		}
+		req.Body = b
+	case s.Body != "":
+		req.Body = []byte(s.Body)
+	}
+	return req, nil
+}
+
+// expandEnv replaces $VAR and ${VAR} with environment values. An unset
+// variable is an error, so a missing token is not sent as an empty header.
+func expandEnv(s string) (string, error) {
+	var missing []string
+	out := os.Expand(s, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s not set", strings.Join(missing, ", "))
+	}
+	return out, nil
 }
@@ -1,15 +1,44 @@
 package domain
 
 import (
+	"fmt"
 	"time"
 )
 
-func AnalyzeConnectivity(probes []Probe, _ NetTestConfig) ConnectivityResult {
+func AnalyzeConnectivity(probes []Probe, config NetTestConfig) ConnectivityResult {
 	r := ConnectivityResult{
 		Probes:    probes,
 		Timestamp: time.Now(),
 	}
 	r.DetermineMode()
+	r.Diagnoses = collectDiagnoses(probes)
+	if d := proxyMismatch(config); d != "" {
+		r.Diagnoses = append(r.Diagnoses, d)
+	}
 	return r
 }
 
+// proxyMismatch warns when the environment points other software at a proxy
+// other than the one configured for these checks.
+func proxyMismatch(config NetTestConfig) string {
+	env := config.EnvProxy.Primary()
+	if env == "" || config.ProxyURL == "" || SameProxy(env, config.ProxyURL) {
+		return ""
+	}
+	return fmt.Sprintf("environment proxy %s differs from the configured proxy %s; other software on this host may take a different route",
+		redactProxyURL(env), redactProxyURL(config.ProxyURL))
+}
+
+func collectDiagnoses(probes []Probe) []string {
+	var out []string
+	for _, p := range probes {
+		if p.DNS != nil {
+			out = append(out, p.DNS.Diagnoses...)
+		}
+		if p.Interception != nil {
+			out = append(out, p.Interception.Findings...)
+		}
+	}
+	return dedup(out)
+}
+
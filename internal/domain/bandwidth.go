@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Defaults for a bandwidth endpoint, the client side of rsvpck serve.
+const (
+	DefaultBandwidthPort    = "5201"
+	DefaultBandwidthSeconds = 5
+	DefaultBandwidthPings   = 10
+)
+
+// BandwidthOptions describe a probe against a peer running rsvpck serve.
+type BandwidthOptions struct {
+	Seconds  int  // per direction; 0 means DefaultBandwidthSeconds
+	Pings    int  // echo round trips for RTT and jitter; 0 means DefaultBandwidthPings
+	NoUpload bool // measure the download only
+}
+
+func (o BandwidthOptions) Duration() time.Duration {
+	if o.Seconds > 0 {
+		return time.Duration(o.Seconds) * time.Second
+	}
+	return DefaultBandwidthSeconds * time.Second
+}
+
+func (o BandwidthOptions) PingCount() int {
+	if o.Pings > 0 {
+		return o.Pings
+	}
+	return DefaultBandwidthPings
+}
+
+// RTTStats summarize the echo round trips of a bandwidth probe. Jitter is
+// the mean difference between consecutive round trips.
+type RTTStats struct {
+	Samples  int
+	MinMs    float64
+	AvgMs    float64
+	MaxMs    float64
+	JitterMs float64
+}
+
+func NewRTTStats(samplesMs []float64) RTTStats {
+	if len(samplesMs) == 0 {
+		return RTTStats{}
+	}
+	s := RTTStats{Samples: len(samplesMs), MinMs: math.Inf(1)}
+	var sum, diffs float64
+	for i, ms := range samplesMs {
+		sum += ms
+		s.MinMs = min(s.MinMs, ms)
+		s.MaxMs = max(s.MaxMs, ms)
+		if i > 0 {
+			diffs += math.Abs(ms - samplesMs[i-1])
+		}
+	}
+	s.AvgMs = sum / float64(len(samplesMs))
+	if len(samplesMs) > 1 {
+		s.JitterMs = diffs / float64(len(samplesMs)-1)
+	}
+	return s
+}
+
+func (s RTTStats) String() string {
+	if s.Samples == 0 {
+		return "no round trips"
+	}
+	return fmt.Sprintf("min/avg/max %.2f/%.2f/%.2f ms, jitter %.2f ms (%d pings)",
+		s.MinMs, s.AvgMs, s.MaxMs, s.JitterMs, s.Samples)
+}
+
+// BandwidthTransfer is one direction of a bandwidth probe: the whole
+// transfer and each second of it.
+type BandwidthTransfer struct {
+	TransferStats
+	Intervals []TransferStats
+}
+
+// BandwidthDetails are what a bandwidth probe measured.
+type BandwidthDetails struct {
+	Server   string // the version the peer reported
+	RTT      RTTStats
+	Download BandwidthTransfer
+	Upload   *BandwidthTransfer // nil when the upload was skipped or not reached
+}
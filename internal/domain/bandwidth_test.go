@@ -0,0 +1,52 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestNewRTTStats(t *testing.T) {
+	s := domain.NewRTTStats([]float64{10, 14, 12, 20})
+	if s.Samples != 4 || s.MinMs != 10 || s.MaxMs != 20 || s.AvgMs != 14 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	// |14-10| + |12-14| + |20-12| over three pairs
+	if s.JitterMs != 14.0/3 {
+		t.Fatalf("JitterMs = %v, want %v", s.JitterMs, 14.0/3)
+	}
+	if got := s.String(); got != "min/avg/max 10.00/14.00/20.00 ms, jitter 4.67 ms (4 pings)" {
+		t.Fatalf("String = %q", got)
+	}
+	if one := domain.NewRTTStats([]float64{7}); one.JitterMs != 0 || one.AvgMs != 7 {
+		t.Fatalf("want no jitter from one sample, got %+v", one)
+	}
+	if (domain.NewRTTStats(nil)).String() != "no round trips" {
+		t.Fatal("want no round trips")
+	}
+}
+
+func TestBandwidthOptions(t *testing.T) {
+	var o domain.BandwidthOptions
+	if o.Duration().Seconds() != domain.DefaultBandwidthSeconds || o.PingCount() != domain.DefaultBandwidthPings {
+		t.Fatalf("unexpected defaults %v %d", o.Duration(), o.PingCount())
+	}
+	o = domain.BandwidthOptions{Seconds: 2, Pings: 3}
+	if o.Duration().Seconds() != 2 || o.PingCount() != 3 {
+		t.Fatalf("unexpected options %v %d", o.Duration(), o.PingCount())
+	}
+}
+
+func TestNewBandwidthEndpoint(t *testing.T) {
+	for in, want := range map[string]string{"relay.corp": "relay.corp:5201", "10.0.0.5:7000": "10.0.0.5:7000", "[::1]": "[::1]:5201"} {
+		ep, err := domain.NewBandwidthEndpoint(in, domain.EndpointTypePublic, "relay")
+		if err != nil || ep.Target != want || ep.TargetType != domain.TargetTypeBandwidth {
+			t.Errorf("NewBandwidthEndpoint(%q) = %q, %v; want %q", in, ep.Target, err, want)
+		}
+	}
+	for _, in := range []string{"", "http://relay.corp:5201"} {
+		if _, err := domain.NewBandwidthEndpoint(in, domain.EndpointTypePublic, "relay"); err == nil {
+			t.Errorf("want an error for %q", in)
+		}
+	}
+}
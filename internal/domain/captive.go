@@ -0,0 +1,39 @@
+package domain
+
+import "strings"
+
+// DefaultCaptivePortalURL answers exactly DefaultCaptivePortalBody when
+// nothing sits between it and the client.
+const (
+	DefaultCaptivePortalURL  = "http://detectportal.firefox.com/success.txt"
+	DefaultCaptivePortalBody = "success"
+)
+
+// CaptivePortalOptions describe the known answer of a captive portal check.
+type CaptivePortalOptions struct {
+	ExpectStatus int    // 0 means 200
+	ExpectBody   string // compared with surrounding whitespace trimmed; "" accepts any body
+}
+
+func (o CaptivePortalOptions) Status() int {
+	if o.ExpectStatus != 0 {
+		return o.ExpectStatus
+	}
+	return 200
+}
+
+// BodyMatches reports whether body is the expected answer.
+func (o CaptivePortalOptions) BodyMatches(body string) bool {
+	return o.ExpectBody == "" || strings.TrimSpace(body) == strings.TrimSpace(o.ExpectBody)
+}
+
+// CaptivePortalDetails lists the signs of a captive portal a check found.
+type CaptivePortalDetails struct {
+	Reasons      []string
+	LoginURL     string   // where the request was redirected, if it was
+	PrivateAddrs []string // private-range DNS answers for the check's host
+}
+
+func (d CaptivePortalDetails) Detected() bool {
+	return len(d.Reasons) > 0
+}
@@ -8,6 +8,9 @@ type NetTestConfig struct {
 	ProxyEndpoints  []Endpoint
 	ProxyURL        string
 	VPNIPs			[]string
+	EnvProxy        EnvProxy // as discovered at startup, for comparison with ProxyURL
+	TLS             TLSOptions // for the certificate check
+	SpeedtestEndpoints []Endpoint // throughput and bandwidth probes, run on request only
 }
 
 func NewNetTestConfig(
@@ -21,8 +24,10 @@ func NewNetTestConfig(
 		if ep.Type != EndpointTypeVPN {
 			return NetTestConfig{}, errors.New("all VPN endpoints must be of type VPN")
 		}
-		if ep.TargetType != TargetTypeTCP && ep.TargetType != TargetTypeICMP {
-			return NetTestConfig{}, errors.New("VPN endpoints must be TCP or ICMP")
+		switch ep.TargetType {
+		case TargetTypeTCP, TargetTypeICMP, TargetTypeTLS:
+		default:
+			return NetTestConfig{}, errors.New("VPN endpoints must be TCP, ICMP or TLS")
 		}
 	}
 
@@ -31,9 +36,9 @@ func NewNetTestConfig(
 			return NetTestConfig{}, errors.New("direct endpoints must be of type Public")
 		}
 		switch ep.TargetType {
-		case TargetTypeTCP, TargetTypeICMP, TargetTypeDNS, TargetTypeHTTP:
+		case TargetTypeTCP, TargetTypeICMP, TargetTypeDNS, TargetTypeHTTP, TargetTypeDoH, TargetTypeDoT, TargetTypeCaptivePortal, TargetTypeTLS, TargetTypeInterception:
 		default:
-			return NetTestConfig{}, errors.New("direct endpoints must be TCP, ICMP, DNS, or HTTP")
+			return NetTestConfig{}, errors.New("direct endpoints must be TCP, ICMP, DNS, HTTP, DoH, DoT, captive, TLS or interception")
 		}
 	}
 	for _, ep := range ProxyEndpoints {
@@ -41,9 +46,14 @@ func NewNetTestConfig(
 			return NetTestConfig{}, errors.New("proxy endpoint must be of type Public")
 		}
 		switch ep.TargetType {
-		case TargetTypeICMP, TargetTypeDNS, TargetTypeHTTP:
+		case TargetTypeICMP, TargetTypeDNS, TargetTypeTCP, TargetTypeHTTP, TargetTypeDoH, TargetTypeTLS, TargetTypeInterception:
 		default:
-			return NetTestConfig{}, errors.New("proxy endpoints must be ICMP or HTTP")
+			return NetTestConfig{}, errors.New("proxy endpoints must be ICMP, DNS, TCP, HTTP, DoH, TLS or interception")
+		}
+	}
+	for _, ep := range append(directEndpoints, ProxyEndpoints...) {
+		if ep.IsEncryptedDNS() && ep.DNS.Query == "" {
+			return NetTestConfig{}, errors.New("DoH/DoT endpoints need a name to query")
 		}
 	}
 
@@ -68,6 +78,25 @@ func (c NetTestConfig) HasProxyChecks() bool {
 	return len(c.ProxyEndpoints) > 0
 }
 
+// InterceptionProxies lists the paths, besides direct, the TLS interception
+// checks fetch chains through: ProxyURL, then each VPN IP.
+func (c NetTestConfig) InterceptionProxies() []string {
+	var out []string
+next:
+	for _, p := range append([]string{c.ProxyURL}, c.VPNIPs...) {
+		if p == "" {
+			continue
+		}
+		for _, seen := range out {
+			if SameProxy(seen, p) {
+				continue next
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
 func (c NetTestConfig) HasICMPChecks() bool {
 	for _, ep := range c.DirectEndpoints {
 		if ep.TargetType == TargetTypeICMP {
@@ -110,6 +139,63 @@ func MustNewHTTPEndpoint(url string, typ EndpointType, overProxy bool, proxyURL
 	return ep
 }
 
+func MustNewDoHEndpoint(url string, typ EndpointType, overProxy bool, proxyURL string, desc string) Endpoint {
+	ep, err := NewDoHEndpoint(url, typ, desc)
+	if err != nil {
+		panic("invalid DoH endpoint: " + url + " - " + err.Error())
+	}
+	if overProxy {
+		ep.SetProxy(proxyURL)
+	}
+	return ep
+}
+
+func MustNewCaptivePortalEndpoint(url string, typ EndpointType, desc string) Endpoint {
+	ep, err := NewCaptivePortalEndpoint(url, typ, desc)
+	if err != nil {
+		panic("invalid captive portal endpoint: " + url + " - " + err.Error())
+	}
+	return ep
+}
+
+func MustNewThroughputEndpoint(url string, typ EndpointType, overProxy bool, proxyURL string, desc string) Endpoint {
+	ep, err := NewThroughputEndpoint(url, typ, desc)
+	if err != nil {
+		panic("invalid throughput endpoint: " + url + " - " + err.Error())
+	}
+	if overProxy {
+		ep.SetProxy(proxyURL)
+	}
+	return ep
+}
+
+func MustNewTLSEndpoint(hostPort string, typ EndpointType, overProxy bool, proxyURL string, desc string) Endpoint {
+	ep, err := NewTLSEndpoint(hostPort, typ, desc)
+	if err != nil {
+		panic("invalid TLS endpoint: " + hostPort + " - " + err.Error())
+	}
+	if overProxy {
+		ep.SetProxy(proxyURL)
+	}
+	return ep
+}
+
+func MustNewBandwidthEndpoint(hostPort string, typ EndpointType, desc string) Endpoint {
+	ep, err := NewBandwidthEndpoint(hostPort, typ, desc)
+	if err != nil {
+		panic("invalid bandwidth endpoint: " + hostPort + " - " + err.Error())
+	}
+	return ep
+}
+
+func MustNewDoTEndpoint(hostPort string, typ EndpointType, desc string) Endpoint {
+	ep, err := NewDoTEndpoint(hostPort, typ, desc)
+	if err != nil {
+		panic("invalid DoT endpoint: " + hostPort + " - " + err.Error())
+	}
+	return ep
+}
+
 func MustNewICMPEndpoint(host string, typ EndpointType, description string) Endpoint {
 	ep, err := NewICMPEndpoint(host, typ, description)
 	if err != nil {
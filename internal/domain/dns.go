@@ -0,0 +1,330 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+const defaultDNSPort = "53"
+
+type DNSTransport int
+
+const (
+	DNSTransportUDP DNSTransport = iota
+	DNSTransportTCP
+)
+
+func (t DNSTransport) String() string {
+	switch t {
+	case DNSTransportUDP:
+		return "udp"
+	case DNSTransportTCP:
+		return "tcp"
+	default:
+		return "unknown"
+	}
+}
+
+func ParseDNSTransport(s string) (DNSTransport, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "udp":
+		return DNSTransportUDP, nil
+	case "tcp":
+		return DNSTransportTCP, nil
+	default:
+		return DNSTransportUDP, fmt.Errorf("unknown DNS transport %q (expected udp or tcp)", s)
+	}
+}
+
+// DNSServer is a resolver queried directly instead of the system one.
+type DNSServer struct {
+	Address   string // host:port
+	Transport DNSTransport
+}
+
+// ParseDNSServer accepts "1.1.1.1", "1.1.1.1:53", "[2606:4700::1111]:53"
+// and an optional "udp://" or "tcp://" prefix overriding def.
+func ParseDNSServer(s string, def DNSTransport) (DNSServer, error) {
+	s = strings.TrimSpace(s)
+	transport := def
+	if scheme, rest, ok := strings.Cut(s, "://"); ok {
+		t, err := ParseDNSTransport(scheme)
+		if err != nil {
+			return DNSServer{}, err
+		}
+		transport, s = t, rest
+	}
+	if s == "" {
+		return DNSServer{}, errors.New("DNS server address cannot be empty")
+	}
+
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.Trim(s, "[]"), defaultDNSPort
+	}
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return DNSServer{}, fmt.Errorf("invalid DNS server address %q", s)
+	}
+	return DNSServer{Address: net.JoinHostPort(host, port), Transport: transport}, nil
+}
+
+func (s DNSServer) String() string {
+	if s.Transport == DNSTransportUDP {
+		return s.Address
+	}
+	return s.Address + "/" + s.Transport.String()
+}
+
+type DNSRecordType int
+
+const (
+	DNSRecordHost DNSRecordType = iota // A and AAAA, as a plain host lookup returns them
+	DNSRecordA
+	DNSRecordAAAA
+	DNSRecordCNAME
+	DNSRecordMX
+	DNSRecordTXT
+	DNSRecordSRV
+	DNSRecordPTR
+)
+
+var dnsRecordTypeToString = map[DNSRecordType]string{
+	DNSRecordHost:  "HOST",
+	DNSRecordA:     "A",
+	DNSRecordAAAA:  "AAAA",
+	DNSRecordCNAME: "CNAME",
+	DNSRecordMX:    "MX",
+	DNSRecordTXT:   "TXT",
+	DNSRecordSRV:   "SRV",
+	DNSRecordPTR:   "PTR",
+}
+
+func (t DNSRecordType) String() string {
+	if str, ok := dnsRecordTypeToString[t]; ok {
+		return str
+	}
+	return "unknown"
+}
+
+func ParseDNSRecordType(s string) (DNSRecordType, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return DNSRecordHost, nil
+	}
+	for t, str := range dnsRecordTypeToString {
+		if str == s {
+			return t, nil
+		}
+	}
+	return DNSRecordHost, fmt.Errorf("unsupported DNS record type %q", s)
+}
+
+// DNSExpect is one accepted answer: either a CIDR range or an exact value.
+type DNSExpect struct {
+	prefix netip.Prefix
+	value  string
+}
+
+func ParseDNSExpect(s string) (DNSExpect, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DNSExpect{}, errors.New("expected DNS answer cannot be empty")
+	}
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return DNSExpect{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return DNSExpect{prefix: prefix.Masked()}, nil
+	}
+	return DNSExpect{value: normalizeDNSName(s)}, nil
+}
+
+// Matches reports whether answer is accepted. Values are compared with the
+// whole answer; with partial, its last field will do too, so
+// "mx.example.com" accepts the MX answer "10 mx.example.com".
+func (e DNSExpect) Matches(answer string, partial bool) bool {
+	if e.prefix.IsValid() {
+		addr, err := netip.ParseAddr(answer)
+		return err == nil && e.prefix.Contains(addr.Unmap())
+	}
+	answer = normalizeDNSName(answer)
+	if answer == e.value {
+		return true
+	}
+	fields := strings.Fields(answer)
+	return partial && len(fields) > 1 && fields[len(fields)-1] == e.value
+}
+
+func (e DNSExpect) String() string {
+	if e.prefix.IsValid() {
+		return e.prefix.String()
+	}
+	return e.value
+}
+
+func normalizeDNSName(s string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")
+}
+
+// DNSOptions tune how a DNS endpoint is resolved. With no servers the
+// system resolver is used.
+type DNSOptions struct {
+	Query        string // name looked up through DoH/DoT servers
+	Servers      []DNSServer
+	Compare      bool // query the system resolver and every server side by side
+	RecordType   DNSRecordType
+	Expect       []DNSExpect // every answer must match one of these, if set
+	PartialMatch bool        // an expectation may match the last field of an answer only
+	HijackCheck  bool        // compare the system resolver against public ones
+}
+
+// UnexpectedAnswers returns the answers no expectation accepts.
+func (o DNSOptions) UnexpectedAnswers(answers []string) []string {
+	if len(o.Expect) == 0 {
+		return nil
+	}
+	var bad []string
+	for _, a := range answers {
+		ok := false
+		for _, e := range o.Expect {
+			if e.Matches(a, o.PartialMatch) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			bad = append(bad, a)
+		}
+	}
+	return bad
+}
+
+// DNSServerResult is the answer of a single resolver. An empty Server
+// denotes the system resolver.
+type DNSServerResult struct {
+	Server    string
+	Status    Status
+	Answers   []string
+	LatencyMs float64
+	Error     string
+
+	// Wire-level facts, known when the server was queried directly.
+	RCode         string // NOERROR, NXDOMAIN, SERVFAIL, REFUSED, ...
+	Authoritative bool
+	Truncated     bool   // the UDP reply had the TC bit set
+	TCPFallback   bool   // the query was retried over TCP
+	Responder     string // address the reply actually came from
+	NegativeSOA   string // zone of the SOA sent with a negative answer
+}
+
+func (r DNSServerResult) IsSuccessful() bool {
+	return r.Status == StatusPass
+}
+
+func (r DNSServerResult) Name() string {
+	if r.Server == "" {
+		return "system"
+	}
+	return r.Server
+}
+
+type DNSDetails struct {
+	RecordType DNSRecordType
+	Results    []DNSServerResult
+	Diagnoses  []string
+}
+
+// DiagnoseDNSAnswers compares the system resolver's answer for name with the
+// answers of public resolvers. With expectations set, a system answer the
+// public resolvers don't share is reported as a local rewrite. Without them,
+// internal or sinkhole addresses are reported as split-horizon DNS, and any
+// other system answer sharing nothing with the public ones as a mismatch;
+// CDNs answer differently per resolver, so one common answer is enough.
+func DiagnoseDNSAnswers(opts DNSOptions, name string, system DNSServerResult, public []DNSServerResult) []string {
+	if len(system.Answers) == 0 {
+		return nil
+	}
+	var publicAnswers []string
+	publicExpected := false
+	for _, r := range public {
+		if len(r.Answers) == 0 {
+			continue
+		}
+		publicAnswers = append(publicAnswers, r.Answers...)
+		if len(opts.Expect) > 0 && len(opts.UnexpectedAnswers(r.Answers)) == 0 {
+			publicExpected = true
+		}
+	}
+	if len(publicAnswers) == 0 {
+		return nil
+	}
+
+	sys := strings.Join(system.Answers, ", ")
+	pub := strings.Join(dedup(publicAnswers), ", ")
+
+	if len(opts.Expect) > 0 {
+		if len(opts.UnexpectedAnswers(system.Answers)) > 0 && publicExpected {
+			return []string{fmt.Sprintf(
+				"DNS for %s is rewritten locally: system resolver answers %s, public resolvers answer %s",
+				name, sys, pub)}
+		}
+		return nil
+	}
+
+	if allInternal(system.Answers) && !allInternal(publicAnswers) {
+		return []string{fmt.Sprintf(
+			"split-horizon or sinkholed DNS for %s: system resolver answers %s, public resolvers answer %s",
+			name, sys, pub)}
+	}
+	if !overlaps(system.Answers, publicAnswers) {
+		return []string{fmt.Sprintf(
+			"DNS for %s differs from public resolvers: system resolver answers %s, public resolvers answer %s",
+			name, sys, pub)}
+	}
+	return nil
+}
+
+// overlaps reports whether the two answer sets share an answer.
+func overlaps(a, b []string) bool {
+	seen := make(map[string]bool, len(a))
+	for _, v := range a {
+		seen[normalizeDNSName(v)] = true
+	}
+	for _, v := range b {
+		if seen[normalizeDNSName(v)] {
+			return true
+		}
+	}
+	return false
+}
+
+// allInternal reports whether every answer is a private, loopback or
+// unspecified address. Non-address answers count as not internal.
+func allInternal(answers []string) bool {
+	for _, a := range answers {
+		addr, err := netip.ParseAddr(a)
+		if err != nil {
+			return false
+		}
+		if !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsUnspecified() && !addr.IsLinkLocalUnicast() {
+			return false
+		}
+	}
+	return len(answers) > 0
+}
+
+func dedup(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	out := values[:0:0]
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestParseDNSServer(t *testing.T) {
+	cases := []struct {
+		in   string
+		def  domain.DNSTransport
+		want domain.DNSServer
+	}{
+		{"1.1.1.1", domain.DNSTransportUDP, domain.DNSServer{Address: "1.1.1.1:53", Transport: domain.DNSTransportUDP}},
+		{"8.8.8.8:5353", domain.DNSTransportTCP, domain.DNSServer{Address: "8.8.8.8:5353", Transport: domain.DNSTransportTCP}},
+		{"tcp://10.0.0.2", domain.DNSTransportUDP, domain.DNSServer{Address: "10.0.0.2:53", Transport: domain.DNSTransportTCP}},
+		{"udp://[2606:4700::1111]:53", domain.DNSTransportTCP, domain.DNSServer{Address: "[2606:4700::1111]:53", Transport: domain.DNSTransportUDP}},
+		{"2606:4700::1111", domain.DNSTransportUDP, domain.DNSServer{Address: "[2606:4700::1111]:53", Transport: domain.DNSTransportUDP}},
+	}
+	for _, tc := range cases {
+		got, err := domain.ParseDNSServer(tc.in, tc.def)
+		if err != nil {
+			t.Fatalf("ParseDNSServer(%q) unexpected error: %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseDNSServer(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "quic://1.1.1.1", "udp://"} {
+		if _, err := domain.ParseDNSServer(bad, domain.DNSTransportUDP); err == nil {
+			t.Fatalf("ParseDNSServer(%q) expected error", bad)
+		}
+	}
+}
+
+func TestDNSOptions_UnexpectedAnswers(t *testing.T) {
+	var expect []domain.DNSExpect
+	for _, s := range []string{"10.0.0.0/8", "mx.example.com.", "2001:db8::/32"} {
+		e, err := domain.ParseDNSExpect(s)
+		if err != nil {
+			t.Fatalf("ParseDNSExpect(%q): %v", s, err)
+		}
+		expect = append(expect, e)
+	}
+	opts := domain.DNSOptions{Expect: expect}
+
+	ok := []string{"10.1.2.3", "2001:db8::1", "MX.example.com"}
+	if bad := opts.UnexpectedAnswers(ok); len(bad) != 0 {
+		t.Fatalf("want all answers accepted, got %v", bad)
+	}
+	if bad := opts.UnexpectedAnswers([]string{"10 mx.example.com."}); len(bad) != 1 {
+		t.Fatalf("want a partial match rejected by default, got %v", bad)
+	}
+	partial := domain.DNSOptions{Expect: expect, PartialMatch: true}
+	if bad := partial.UnexpectedAnswers([]string{"10 mx.example.com."}); len(bad) != 0 {
+		t.Fatalf("want the last field accepted when asked for, got %v", bad)
+	}
+	bad := opts.UnexpectedAnswers([]string{"10.1.2.3", "192.0.2.1", "mx2.example.com"})
+	if len(bad) != 2 || bad[0] != "192.0.2.1" || bad[1] != "mx2.example.com" {
+		t.Fatalf("unexpected mismatch list %v", bad)
+	}
+
+	if bad := (domain.DNSOptions{}).UnexpectedAnswers([]string{"192.0.2.1"}); bad != nil {
+		t.Fatalf("no expectations must accept everything, got %v", bad)
+	}
+	if _, err := domain.ParseDNSExpect("10.0.0.0/33"); err == nil {
+		t.Fatalf("expected error for invalid CIDR")
+	}
+}
+
+func TestParseDNSRecordType(t *testing.T) {
+	for in, want := range map[string]domain.DNSRecordType{
+		"":     domain.DNSRecordHost,
+		"a":    domain.DNSRecordA,
+		"AAAA": domain.DNSRecordAAAA,
+		"mx":   domain.DNSRecordMX,
+		"PTR":  domain.DNSRecordPTR,
+	} {
+		got, err := domain.ParseDNSRecordType(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseDNSRecordType(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := domain.ParseDNSRecordType("NS"); err == nil {
+		t.Fatalf("expected error for unsupported record type")
+	}
+}
+
+func TestDiagnoseDNSAnswers(t *testing.T) {
+	sys := func(answers ...string) domain.DNSServerResult {
+		return domain.DNSServerResult{Status: domain.StatusPass, Answers: answers}
+	}
+	pub := func(answers ...string) []domain.DNSServerResult {
+		return []domain.DNSServerResult{{Server: "1.1.1.1:53", Status: domain.StatusPass, Answers: answers}}
+	}
+
+	// internal answer locally, public answer outside: split-horizon
+	if got := domain.DiagnoseDNSAnswers(domain.DNSOptions{}, "insite.example.com", sys("10.1.1.1"), pub("203.0.113.5")); len(got) != 1 {
+		t.Fatalf("want split-horizon finding, got %v", got)
+	}
+	// answer sets sharing nothing are reported even without expectations
+	if got := domain.DiagnoseDNSAnswers(domain.DNSOptions{}, "cdn.example.com", sys("198.51.100.7"), pub("203.0.113.5")); len(got) != 1 {
+		t.Fatalf("want a finding for disjoint answers, got %v", got)
+	}
+	// CDN style differences sharing an answer are not
+	if got := domain.DiagnoseDNSAnswers(domain.DNSOptions{}, "cdn.example.com", sys("198.51.100.7", "203.0.113.5"), pub("203.0.113.5", "203.0.113.6")); len(got) != 0 {
+		t.Fatalf("want no finding for overlapping answers, got %v", got)
+	}
+
+	exp, _ := domain.ParseDNSExpect("203.0.113.0/24")
+	opts := domain.DNSOptions{Expect: []domain.DNSExpect{exp}}
+	if got := domain.DiagnoseDNSAnswers(opts, "insite.example.com", sys("198.51.100.7"), pub("203.0.113.5")); len(got) != 1 {
+		t.Fatalf("want rewrite finding, got %v", got)
+	}
+	// nobody gives the expected answer: that is a mismatch, not a local rewrite
+	if got := domain.DiagnoseDNSAnswers(opts, "insite.example.com", sys("198.51.100.7"), pub("198.51.100.8")); len(got) != 0 {
+		t.Fatalf("want no rewrite finding, got %v", got)
+	}
+	if got := domain.DiagnoseDNSAnswers(opts, "insite.example.com", domain.DNSServerResult{}, pub("203.0.113.5")); len(got) != 0 {
+		t.Fatalf("want no finding without system answers, got %v", got)
+	}
+}
+
+func TestAnalyzeConnectivity_DNSWarning(t *testing.T) {
+	dnsEp := domain.MustNewDNSEndpoint("example.com", domain.EndpointTypePublic, "")
+	tcpEp := domain.MustNewTCPEndpoint("example.com:443", domain.EndpointTypePublic, "")
+
+	warn := domain.NewSuccessfulProbe(dnsEp, 2)
+	warn.MarkWarning(nil)
+	warn.DNS = &domain.DNSDetails{Diagnoses: []string{"rewritten"}}
+	twin := warn
+	twin.DNS = &domain.DNSDetails{Diagnoses: []string{"rewritten"}}
+
+	r := domain.AnalyzeConnectivity([]domain.Probe{warn, twin, domain.NewSuccessfulProbe(tcpEp, 5)}, domain.NetTestConfig{})
+	if r.Mode != domain.ModeDirect {
+		t.Fatalf("a DNS warning must still count as resolved, got %v", r.Mode)
+	}
+	if len(r.Diagnoses) != 1 || r.Diagnoses[0] != "rewritten" {
+		t.Fatalf("want one deduplicated diagnosis, got %v", r.Diagnoses)
+	}
+}
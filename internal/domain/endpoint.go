@@ -14,6 +14,18 @@ const (
 	TargetTypeTCP                            // host:port for TCP-connect
 	TargetTypeICMP                           // to ping
 	TargetTypeDNS
+	TargetTypeDoH                            // https:// URL of a DNS-over-HTTPS server
+	TargetTypeDoT                            // host:port of a DNS-over-TLS server
+	TargetTypeCaptivePortal                  // http:// URL with a known answer
+	TargetTypeThroughput                     // http:// or https:// URL to download from
+	TargetTypeBandwidth                      // host:port of a peer running rsvpck serve
+	TargetTypeTLS                            // host:port to complete a TLS handshake with
+	TargetTypeInterception                   // host:port whose chain is compared across paths
+)
+
+const (
+	defaultDoTPort = "853"
+	defaultTLSPort = "443"
 )
 
 func (t EndpointTargetType) String() string {
@@ -26,6 +38,20 @@ func (t EndpointTargetType) String() string {
 		return "DNS"
 	case TargetTypeICMP:
 		return "icmp"
+	case TargetTypeDoH:
+		return "doh"
+	case TargetTypeDoT:
+		return "dot"
+	case TargetTypeCaptivePortal:
+		return "captive"
+	case TargetTypeThroughput:
+		return "throughput"
+	case TargetTypeBandwidth:
+		return "bandwidth"
+	case TargetTypeTLS:
+		return "tls"
+	case TargetTypeInterception:
+		return "interception"
 	default:
 		return "unknown"
 	}
@@ -54,17 +80,68 @@ type Endpoint struct {
 	TargetType    EndpointTargetType
 	Type          EndpointType
 	Proxy         ProxyConfig
+	DNS           DNSOptions
+	HTTP          HTTPOptions
+	Captive       CaptivePortalOptions
+	Throughput    ThroughputOptions
+	Bandwidth     BandwidthOptions
+	TLS           TLSOptions
+	Interception  InterceptionOptions
 	Description   string
+	AnyOf         string // endpoints sharing it are alternatives: the group fails only if all do
 }
 
 func (e Endpoint) MustUseProxy() bool {
-	return e.TargetType == TargetTypeHTTP && e.Proxy.MustUseProxy()
+	switch e.TargetType {
+	case TargetTypeHTTP, TargetTypeDoH, TargetTypeTCP, TargetTypeThroughput, TargetTypeTLS:
+		return e.Proxy.MustUseProxy()
+	}
+	return false
 }
 
 func (e *Endpoint) SetProxy(proxy string){
 	e.Proxy.Set(proxy)
 }
 
+func (e *Endpoint) SetDNSOptions(opts DNSOptions) {
+	e.DNS = opts
+}
+
+func (e *Endpoint) SetCaptivePortalOptions(opts CaptivePortalOptions) {
+	e.Captive = opts
+}
+
+func (e *Endpoint) SetThroughputOptions(opts ThroughputOptions) {
+	e.Throughput = opts
+}
+
+func (e *Endpoint) SetBandwidthOptions(opts BandwidthOptions) {
+	e.Bandwidth = opts
+}
+
+func (e *Endpoint) SetHTTPOptions(opts HTTPOptions) {
+	e.HTTP = opts
+}
+
+func (e *Endpoint) SetTLSOptions(opts TLSOptions) {
+	e.TLS = opts
+}
+
+func (e *Endpoint) SetInterceptionOptions(opts InterceptionOptions) {
+	e.Interception = opts
+}
+
+// ProxyTLS is the trust for an https:// proxy: the endpoint's CA bundle and
+// insecure mode, with the proxy CA file in place of its caFile when set. The
+// client certificate is for the target and is not shown to the proxy.
+func (e Endpoint) ProxyTLS() TLSOptions {
+	opts := TLSOptions{CAFile: e.TLS.CAFile, CADir: e.TLS.CADir, Insecure: e.TLS.Insecure}
+	if file := e.Proxy.CAFile(); file != "" {
+		opts.CAFile = file
+	}
+	return opts
+}
+
 func (e Endpoint) String() string {
 	str := fmt.Sprintf("Target: %s, TType: %s, Type: %s, Descr: %s",
 		e.Target, e.TargetType.String(), e.Type.String(), e.Description)
@@ -136,6 +213,124 @@ func NewDNSEndpoint(host string, typ EndpointType, description string) (Endpoint
 	}, nil
 }
 
+func NewDoHEndpoint(url string, typ EndpointType, description string) (Endpoint, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return Endpoint{}, errors.New("DoH endpoint must start with https://")
+	}
+	return Endpoint{
+		Target:      url,
+		TargetType:  TargetTypeDoH,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
+// NewDoTEndpoint accepts "host" or "host:port"; the port defaults to 853.
+func NewDoTEndpoint(hostPort string, typ EndpointType, description string) (Endpoint, error) {
+	hostPort = strings.TrimSpace(hostPort)
+	if hostPort == "" {
+		return Endpoint{}, errors.New("DoT server cannot be empty")
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), defaultDoTPort)
+	}
+	return Endpoint{
+		Target:      hostPort,
+		TargetType:  TargetTypeDoT,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
+// NewCaptivePortalEndpoint takes a plain-HTTP URL: a portal cannot answer
+// for an https:// one without failing verification, which hides what it did.
+func NewCaptivePortalEndpoint(url string, typ EndpointType, description string) (Endpoint, error) {
+	if !strings.HasPrefix(url, "http://") {
+		return Endpoint{}, errors.New("captive portal check must use a plain http:// URL")
+	}
+	return Endpoint{
+		Target:      url,
+		TargetType:  TargetTypeCaptivePortal,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
+// NewThroughputEndpoint takes the URL the probe downloads from.
+func NewThroughputEndpoint(url string, typ EndpointType, description string) (Endpoint, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return Endpoint{}, errors.New("throughput endpoint must start with http:// or https://")
+	}
+	return Endpoint{
+		Target:      url,
+		TargetType:  TargetTypeThroughput,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
+// NewTLSEndpoint accepts "host" or "host:port"; the port defaults to 443.
+func NewTLSEndpoint(hostPort string, typ EndpointType, description string) (Endpoint, error) {
+	hostPort = strings.TrimSpace(hostPort)
+	if hostPort == "" {
+		return Endpoint{}, errors.New("TLS target cannot be empty")
+	}
+	if strings.Contains(hostPort, "://") {
+		return Endpoint{}, errors.New("TLS target must be host or host:port, not a URL")
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), defaultTLSPort)
+	}
+	return Endpoint{
+		Target:      hostPort,
+		TargetType:  TargetTypeTLS,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
+// NewInterceptionEndpoint accepts "host" or "host:port" of a TLS server
+// whose chain is fetched on every path; the port defaults to 443.
+func NewInterceptionEndpoint(hostPort string, typ EndpointType, description string) (Endpoint, error) {
+	hostPort = strings.TrimSpace(hostPort)
+	if hostPort == "" {
+		return Endpoint{}, errors.New("interception target cannot be empty")
+	}
+	if strings.Contains(hostPort, "://") {
+		return Endpoint{}, errors.New("interception target must be host or host:port, not a URL")
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), defaultTLSPort)
+	}
+	return Endpoint{
+		Target:      hostPort,
+		TargetType:  TargetTypeInterception,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
+// NewBandwidthEndpoint accepts "host" or "host:port" of a peer running
+// rsvpck serve; the port defaults to 5201.
+func NewBandwidthEndpoint(hostPort string, typ EndpointType, description string) (Endpoint, error) {
+	hostPort = strings.TrimSpace(hostPort)
+	if hostPort == "" {
+		return Endpoint{}, errors.New("bandwidth peer cannot be empty")
+	}
+	if strings.Contains(hostPort, "://") {
+		return Endpoint{}, errors.New("bandwidth peer must be host or host:port, not a URL")
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(strings.Trim(hostPort, "[]"), DefaultBandwidthPort)
+	}
+	return Endpoint{
+		Target:      hostPort,
+		TargetType:  TargetTypeBandwidth,
+		Type:        typ,
+		Description: description,
+	}, nil
+}
+
 func (e Endpoint) GetTargetType() EndpointTargetType {
 	return e.TargetType
 }
@@ -171,3 +366,8 @@ func (e Endpoint) IsTCP() bool {
 func (e Endpoint) IsHTTP() bool {
 	return e.TargetType == TargetTypeHTTP
 }
+
+// IsEncryptedDNS reports DNS-over-HTTPS and DNS-over-TLS endpoints.
+func (e Endpoint) IsEncryptedDNS() bool {
+	return e.TargetType == TargetTypeDoH || e.TargetType == TargetTypeDoT
+}
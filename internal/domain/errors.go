@@ -4,6 +4,7 @@ package domain
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 type ErrorCode int
@@ -18,6 +19,26 @@ const (
 	ErrorCodeICMPFailed
 	ErrorCodeHTTPClientError
 	ErrorCodeExecFailed
+	ErrorCodeDNSUnexpectedAnswer
+	ErrorCodeTLSFailed
+	ErrorCodeDNSNXDomain
+	ErrorCodeDNSServerFailure
+	ErrorCodeDNSRefused
+	ErrorCodeHTTPUnexpectedStatus
+	ErrorCodeHTTPBodyMismatch
+	ErrorCodeHTTPHeaderMismatch
+	ErrorCodeHTTPTooSlow
+	ErrorCodeHTTPTooManyRedirects
+	ErrorCodeHTTPRedirectNotAllowed
+	ErrorCodePACFailed
+	ErrorCodeCaptivePortal
+	ErrorCodeProxyBlocked
+	ErrorCodeThroughputFailed
+	ErrorCodeBandwidthPeer
+	ErrorCodeCertInvalid
+	ErrorCodeCertExpiring
+	ErrorCodePinMismatch
+	ErrorCodeTLSIntercepted
 )
 
 func (ec ErrorCode) Error() string {
@@ -38,6 +59,46 @@ func (ec ErrorCode) Error() string {
 		return "ICMP ping failed"
 	case ErrorCodeExecFailed:
 		return "external command execution failed"
+	case ErrorCodeDNSUnexpectedAnswer:
+		return "DNS answer did not match expectations"
+	case ErrorCodeTLSFailed:
+		return "TLS handshake failed"
+	case ErrorCodeDNSNXDomain:
+		return "DNS name does not exist (NXDOMAIN)"
+	case ErrorCodeDNSServerFailure:
+		return "DNS server failure (SERVFAIL)"
+	case ErrorCodeDNSRefused:
+		return "DNS query refused (REFUSED)"
+	case ErrorCodeHTTPUnexpectedStatus:
+		return "HTTP status not in the expected set"
+	case ErrorCodeHTTPBodyMismatch:
+		return "HTTP body did not match expectations"
+	case ErrorCodeHTTPHeaderMismatch:
+		return "HTTP headers did not match expectations"
+	case ErrorCodeHTTPTooSlow:
+		return "HTTP response slower than allowed"
+	case ErrorCodeHTTPTooManyRedirects:
+		return "too many HTTP redirects"
+	case ErrorCodeHTTPRedirectNotAllowed:
+		return "HTTP redirected to a host not allowed"
+	case ErrorCodePACFailed:
+		return "PAC script evaluation failed"
+	case ErrorCodeCaptivePortal:
+		return "request intercepted by a captive portal"
+	case ErrorCodeProxyBlocked:
+		return "proxy refused the target"
+	case ErrorCodeThroughputFailed:
+		return "throughput transfer failed"
+	case ErrorCodeBandwidthPeer:
+		return "peer is not an rsvpck server"
+	case ErrorCodeCertInvalid:
+		return "certificate verification failed"
+	case ErrorCodeCertExpiring:
+		return "certificate expires soon"
+	case ErrorCodePinMismatch:
+		return "certificate pin mismatch"
+	case ErrorCodeTLSIntercepted:
+		return "TLS interception detected"
 	default:
 		return fmt.Sprintf("unknown error code: %d", ec)
 	}
@@ -81,6 +142,40 @@ func (e *wrappedError) Is(target error) bool {
 	return errors.Is(e.inner, target)
 }
 
+// JoinErrors combines errs into one error reported on a single line. Each
+// wrapped error code still matches IsErrorCode.
+func JoinErrors(errs ...error) error {
+	var nonNil []error
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+	return &joinedError{errs: nonNil}
+}
+
+type joinedError struct {
+	errs []error
+}
+
+func (e *joinedError) Error() string {
+	msgs := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *joinedError) Unwrap() []error {
+	return e.errs
+}
+
 func ErrInvalidConfig(reason string) error {
 	return Errorf(ErrorCodeInvalidConfig, "invalid config: %s", reason)
 }
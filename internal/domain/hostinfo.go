@@ -15,7 +15,7 @@ type HostInfo struct {
 	SN       string `string:"include" display:"Serial number"`
 	OS       string `string:"include" display:"Operating system"`
 	RT       string `string:"include" display:"Routing table"`
-	TLSCert  []TLSCertificate
+	Proxy    string `string:"include" display:"Environment proxy"`
 }
 
 type NetInfo struct {
@@ -23,11 +23,18 @@ type NetInfo struct {
 }
 
 type TLSCertificate struct {
-	Subject   string    `string:"include"`
-	Issuer    string    //`string:"include"`
-	NotBefore time.Time `string:"include"`
-	NotAfter  time.Time `string:"include"`
-	Valid     bool      `string:"include"`
+	Subject            string    `string:"include"`
+	Issuer             string    //`string:"include"`
+	NotBefore          time.Time `string:"include"`
+	NotAfter           time.Time `string:"include"`
+	Valid              bool      `string:"include"`
+	SPKI               string    // hex SHA-256 of the public key
+	SANs               []string  // DNS names, IP addresses, emails and URIs
+	Serial             string    // hex
+	KeyType            string    // "RSA", "ECDSA P-256", "Ed25519"
+	KeyBits            int
+	Fingerprint        string    // hex SHA-256 of the whole certificate
+	SignatureAlgorithm string
 }
 
 func (t TLSCertificate) String() string {
@@ -35,12 +42,8 @@ func (t TLSCertificate) String() string {
 	return autostr.String(t, autostrCfg)
 }
 
-func NewTLSCertificate() []TLSCertificate {
-	return []TLSCertificate{}
-}
-
 func NewHostInfo() HostInfo {
 
-	return HostInfo{TLSCert: NewTLSCertificate()}
+	return HostInfo{}
 
 }
@@ -0,0 +1,211 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultHTTPBodyLimit caps how much of a response body is read for matching.
+const DefaultHTTPBodyLimit = 64 << 10
+
+// HTTPStatusRange is an inclusive range of accepted status codes.
+type HTTPStatusRange struct {
+	Min, Max int
+}
+
+// ParseHTTPStatusRange accepts "204", "2xx" and "200-299".
+func ParseHTTPStatusRange(s string) (HTTPStatusRange, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		base := int(s[0]-'0') * 100
+		return HTTPStatusRange{Min: base, Max: base + 99}, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	min, err := strconv.Atoi(strings.TrimSpace(lo))
+	if err != nil {
+		return HTTPStatusRange{}, fmt.Errorf("invalid HTTP status %q", s)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+			return HTTPStatusRange{}, fmt.Errorf("invalid HTTP status range %q", s)
+		}
+	}
+	if min < 100 || max > 599 || min > max {
+		return HTTPStatusRange{}, fmt.Errorf("invalid HTTP status %q", s)
+	}
+	return HTTPStatusRange{Min: min, Max: max}, nil
+}
+
+func (r HTTPStatusRange) Contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+func (r HTTPStatusRange) String() string {
+	switch {
+	case r.Min == r.Max:
+		return strconv.Itoa(r.Min)
+	case r.Min%100 == 0 && r.Max == r.Min+99:
+		return fmt.Sprintf("%dxx", r.Min/100)
+	default:
+		return fmt.Sprintf("%d-%d", r.Min, r.Max)
+	}
+}
+
+// HTTPHeaderMatch names a header and, optionally, a value it must contain
+// (case-insensitively). An empty Value matches any value.
+type HTTPHeaderMatch struct {
+	Name  string
+	Value string
+}
+
+// ParseHTTPHeaderMatch accepts "Name" or "Name: value".
+func ParseHTTPHeaderMatch(s string) (HTTPHeaderMatch, error) {
+	name, value, _ := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return HTTPHeaderMatch{}, fmt.Errorf("invalid header %q", s)
+	}
+	return HTTPHeaderMatch{Name: name, Value: strings.TrimSpace(value)}, nil
+}
+
+// Matches reports whether any of the header's values satisfies m.
+func (m HTTPHeaderMatch) Matches(values []string) bool {
+	for _, v := range values {
+		if m.Value == "" || strings.Contains(strings.ToLower(v), strings.ToLower(m.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m HTTPHeaderMatch) String() string {
+	if m.Value == "" {
+		return m.Name
+	}
+	return m.Name + ": " + m.Value
+}
+
+// HTTPExpect describes the response an HTTP endpoint must return. The zero
+// value accepts any 2xx or 3xx status.
+type HTTPExpect struct {
+	Statuses       []HTTPStatusRange
+	BodyContains   string
+	BodyRegex      *regexp.Regexp
+	BodyLimit      int64 // bytes read for matching; 0 means DefaultHTTPBodyLimit
+	RequireHeaders []HTTPHeaderMatch
+	ForbidHeaders  []HTTPHeaderMatch
+	MaxLatencyMs   float64
+}
+
+func (e HTTPExpect) StatusAllowed(code int) bool {
+	if len(e.Statuses) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, r := range e.Statuses {
+		if r.Contains(code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e HTTPExpect) StatusString() string {
+	if len(e.Statuses) == 0 {
+		return "2xx or 3xx"
+	}
+	parts := make([]string, 0, len(e.Statuses))
+	for _, r := range e.Statuses {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ChecksBody reports whether the response body has to be read.
+func (e HTTPExpect) ChecksBody() bool {
+	return e.BodyContains != "" || e.BodyRegex != nil
+}
+
+func (e HTTPExpect) Limit() int64 {
+	if e.BodyLimit > 0 {
+		return e.BodyLimit
+	}
+	return DefaultHTTPBodyLimit
+}
+
+// DefaultHTTPMaxRedirects is the hop limit when following redirects.
+const DefaultHTTPMaxRedirects = 10
+
+// HTTPOptions tune how an HTTP endpoint is requested and judged.
+type HTTPOptions struct {
+	Request Request // method, headers and body sent to the target
+	Expect  HTTPExpect
+
+	FollowRedirects bool
+	MaxRedirects    int      // 0 means DefaultHTTPMaxRedirects
+	AllowedHosts    []string // the final host must be one of these, if set
+}
+
+func (o HTTPOptions) RedirectLimit() int {
+	if o.MaxRedirects > 0 {
+		return o.MaxRedirects
+	}
+	return DefaultHTTPMaxRedirects
+}
+
+// HostAllowed reports whether host may serve the final response. Entries
+// starting with "*." or "." also accept any subdomain.
+func (o HTTPOptions) HostAllowed(host string) bool {
+	if len(o.AllowedHosts) == 0 {
+		return true
+	}
+	host = normalizeDNSName(host)
+	for _, allowed := range o.AllowedHosts {
+		allowed = normalizeDNSName(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok {
+			allowed = suffix
+		}
+		if strings.HasPrefix(allowed, ".") {
+			if host == allowed[1:] || strings.HasSuffix(host, allowed) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPHop is one response in a followed redirect chain.
+type HTTPHop struct {
+	URL        string
+	StatusCode int
+	LatencyMs  float64
+}
+
+type HTTPDetails struct {
+	StatusCode int
+	Failures   []string   // every unmet expectation, in check order
+	Timing     HTTPTiming // of the last request when redirects are followed
+	Hops       []HTTPHop  // the redirect chain, final response included
+}
+
+// HTTPTiming breaks the latency of a request down by phase. A zero phase did
+// not happen or did not finish: no DNS lookup for an IP target, no TLS for
+// plain http, no CONNECT without a proxy.
+type HTTPTiming struct {
+	DNSMs          float64
+	ConnectMs      float64 // TCP connect to the target, or to the proxy
+	ProxyTLSMs     float64 // TLS handshake with an https:// proxy
+	ProxyConnectMs float64 // CONNECT round trip through the proxy
+	TLSMs          float64
+	TTFBMs         float64 // request written to first response byte
+}
+
+func (t HTTPTiming) IsZero() bool {
+	return t == HTTPTiming{}
+}
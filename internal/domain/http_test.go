@@ -0,0 +1,79 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestParseHTTPStatusRange(t *testing.T) {
+	cases := map[string]domain.HTTPStatusRange{
+		"204":     {Min: 204, Max: 204},
+		"2xx":     {Min: 200, Max: 299},
+		"200-302": {Min: 200, Max: 302},
+	}
+	for in, want := range cases {
+		got, err := domain.ParseHTTPStatusRange(in)
+		if err != nil || got != want {
+			t.Fatalf("ParseHTTPStatusRange(%q) = %v, %v; want %v", in, got, err, want)
+		}
+		if got.String() != in {
+			t.Fatalf("String() = %q, want %q", got.String(), in)
+		}
+	}
+	for _, bad := range []string{"", "abc", "6xx", "99", "302-200"} {
+		if _, err := domain.ParseHTTPStatusRange(bad); err == nil {
+			t.Fatalf("ParseHTTPStatusRange(%q): expected error", bad)
+		}
+	}
+}
+
+func TestHTTPExpect_StatusAllowed(t *testing.T) {
+	var exp domain.HTTPExpect
+	if !exp.StatusAllowed(302) || exp.StatusAllowed(404) {
+		t.Fatalf("zero expectation must accept 2xx/3xx only")
+	}
+	exp.Statuses = []domain.HTTPStatusRange{{Min: 401, Max: 401}}
+	if !exp.StatusAllowed(401) || exp.StatusAllowed(200) {
+		t.Fatalf("explicit set must replace the default")
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	if domain.JoinErrors(nil, nil) != nil {
+		t.Fatalf("joining nils must give nil")
+	}
+	err := domain.JoinErrors(
+		domain.Errorf(domain.ErrorCodeHTTPBodyMismatch, "body"),
+		errors.New("plain"),
+		domain.Errorf(domain.ErrorCodeHTTPTooSlow, "slow"),
+	)
+	if err.Error() != "body; plain; slow" {
+		t.Fatalf("unexpected message %q", err)
+	}
+	if !domain.IsErrorCode(err, domain.ErrorCodeHTTPBodyMismatch) || !domain.IsErrorCode(err, domain.ErrorCodeHTTPTooSlow) {
+		t.Fatalf("codes lost in %v", err)
+	}
+}
+
+func TestHTTPOptions_HostAllowed(t *testing.T) {
+	opts := domain.HTTPOptions{AllowedHosts: []string{"example.com", "*.corp.example", ".cdn.example"}}
+	for host, want := range map[string]bool{
+		"example.com":      true,
+		"EXAMPLE.com.":     true,
+		"www.example.com":  false,
+		"corp.example":     true,
+		"a.b.corp.example": true,
+		"cdn.example":      true,
+		"x.cdn.example":    true,
+		"portal.local":     false,
+	} {
+		if got := opts.HostAllowed(host); got != want {
+			t.Fatalf("HostAllowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if !(domain.HTTPOptions{}).HostAllowed("anything") {
+		t.Fatalf("an empty list must allow any host")
+	}
+}
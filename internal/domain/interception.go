@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChainObservation is the certificate chain a target presented on one path.
+type ChainObservation struct {
+	Path         string           // "direct" or the proxy it went through
+	Certificates []TLSCertificate // leaf first; empty when the fetch failed
+	Err          error
+}
+
+func (o ChainObservation) Leaf() (TLSCertificate, bool) {
+	if o.Err != nil || len(o.Certificates) == 0 {
+		return TLSCertificate{}, false
+	}
+	return o.Certificates[0], true
+}
+
+// PathName is the path as shown to the user, credentials redacted.
+func (o ChainObservation) PathName() string {
+	return pathName(o.Path)
+}
+
+// InterceptionOptions are the paths an interception check fetches the
+// target's chain on, besides direct, and the issuers a genuine chain has.
+type InterceptionOptions struct {
+	ServerName      string   // SNI; the target's host when empty
+	Proxies         []string // proxy URLs or host:port
+	ExpectedIssuers []string // checked on top of comparing the paths; empty compares the paths only
+}
+
+// InterceptionReport compares the chains of one target across paths.
+type InterceptionReport struct {
+	Target   string
+	Paths    []ChainObservation
+	Findings []string // one line per intercepted path, or per pair of disagreeing paths
+}
+
+func (r InterceptionReport) Inspected() bool {
+	return len(r.Findings) > 0
+}
+
+// Fetched reports whether any path returned a chain to compare.
+func (r InterceptionReport) Fetched() bool {
+	for _, o := range r.Paths {
+		if _, ok := o.Leaf(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareChains flags the paths on which the target was served a chain other
+// than its own. The paths are always compared pairwise, and a different leaf
+// key or a different issuer tells them apart: a path differing from the
+// direct one is intercepted, and without a direct chain two proxies that
+// disagree are reported together. With expectedIssuers set, a leaf issued by
+// none of them is intercepted too, and is not reported again for differing;
+// a direct chain flagged that way is no reference for the others. An issuer
+// matches an expected entry that its DN contains, ignoring case.
+func CompareChains(target string, paths []ChainObservation, expectedIssuers []string) InterceptionReport {
+	r := InterceptionReport{Target: target, Paths: paths}
+
+	flagged := make(map[int]bool)
+	if len(expectedIssuers) > 0 {
+		for i, o := range paths {
+			if leaf, ok := o.Leaf(); ok && !issuerExpected(leaf.Issuer, expectedIssuers) {
+				flagged[i] = true
+				r.Findings = append(r.Findings, inspectedBy(target, o, leaf))
+			}
+		}
+	}
+
+	// the direct chain is the reference, unless it is missing or flagged
+	reference := func(i int) bool {
+		_, ok := paths[i].Leaf()
+		return ok && paths[i].Path == "direct" && !flagged[i]
+	}
+	haveDirect := false
+	for i := range paths {
+		if reference(i) {
+			haveDirect = true
+		}
+	}
+	for i, a := range paths {
+		leafA, ok := a.Leaf()
+		if !ok {
+			continue
+		}
+		for j := i + 1; j < len(paths); j++ {
+			b := paths[j]
+			leafB, ok := b.Leaf()
+			if !ok || !chainsDiffer(leafA, leafB) {
+				continue
+			}
+			switch {
+			case reference(i):
+				if !flagged[j] {
+					flagged[j] = true
+					r.Findings = append(r.Findings, inspectedBy(target, b, leafB))
+				}
+			case reference(j):
+				if !flagged[i] {
+					flagged[i] = true
+					r.Findings = append(r.Findings, inspectedBy(target, a, leafA))
+				}
+			case !haveDirect && !flagged[i] && !flagged[j]:
+				// no direct chain to tell which one is genuine
+				r.Findings = append(r.Findings, fmt.Sprintf("TLS chains of %s differ: %s served by %s, %s served by %s",
+					target, a.PathName(), issuerName(leafA.Issuer), b.PathName(), issuerName(leafB.Issuer)))
+			}
+		}
+	}
+	return r
+}
+
+// chainsDiffer reports two leaves with a different key or issuer; either
+// alone is enough for an inspection CA re-signing with its own.
+func chainsDiffer(a, b TLSCertificate) bool {
+	return a.SPKI != b.SPKI || a.Issuer != b.Issuer
+}
+
+func inspectedBy(target string, o ChainObservation, leaf TLSCertificate) string {
+	return fmt.Sprintf("TLS inspected by %s (%s, %s)", issuerName(leaf.Issuer), target, o.PathName())
+}
+
+func issuerExpected(issuer string, expected []string) bool {
+	issuer = strings.ToLower(issuer)
+	for _, e := range expected {
+		if e != "" && strings.Contains(issuer, strings.ToLower(e)) {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerName shortens a DN to its common name, or its organization.
+func issuerName(dn string) string {
+	for _, key := range []string{"CN=", "O="} {
+		for _, part := range strings.Split(dn, ",") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(part), key); ok && v != "" {
+				return v
+			}
+		}
+	}
+	return dn
+}
+
+func pathName(path string) string {
+	if path == "direct" {
+		return "direct"
+	}
+	return "via " + redactProxyURL(path)
+}
@@ -1,5 +1,12 @@
 package domain
 
+import (
+	"fmt"
+	"strings"
+)
+
+// Request is an HTTP request. As the template of an HTTP probe, an empty
+// Method means GET and an empty URL means the endpoint target.
 type Request struct {
 	Method  string
 	URL     string
@@ -12,3 +19,25 @@ type Response struct {
 	Headers    map[string]string
 	Body       []byte
 }
+
+// MethodOrGet returns the request method, GET if none is set.
+func (r Request) MethodOrGet() string {
+	if r.Method == "" {
+		return "GET"
+	}
+	return r.Method
+}
+
+// ParseHTTPMethod upper-cases and checks a method name.
+func ParseHTTPMethod(s string) (string, error) {
+	m := strings.ToUpper(strings.TrimSpace(s))
+	if m == "" {
+		return "", nil
+	}
+	for _, c := range m {
+		if c < 'A' || c > 'Z' {
+			return "", fmt.Errorf("invalid HTTP method %q", s)
+		}
+	}
+	return m, nil
+}
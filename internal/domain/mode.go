@@ -7,6 +7,7 @@ const (
 	ModeDirect
 	ModeViaProxy
 	ModeViaVPN
+	ModeCaptivePortal // the network intercepts traffic until someone signs in
 )
 
 func (m ConnectivityMode) String() string {
@@ -19,6 +20,8 @@ func (m ConnectivityMode) String() string {
 		return "via_proxy"
 	case ModeViaVPN:
 		return "via_vpn"
+	case ModeCaptivePortal:
+		return "captive_portal"
 	default:
 		return "unknown"
 	}
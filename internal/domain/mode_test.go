@@ -92,3 +92,33 @@ func TestEndpoints_Validation(t *testing.T) {
 		t.Fatalf("expected DNS endpoint validation error")
 	}
 }
+
+func TestDetermineMode_CaptivePortal(t *testing.T) {
+	dns := domain.MustNewDNSEndpoint("example.com", domain.EndpointTypePublic, "")
+	httpEp := domain.MustNewHTTPEndpoint("http://example.com", domain.EndpointTypePublic, false, "", "")
+	portal := domain.MustNewCaptivePortalEndpoint(domain.DefaultCaptivePortalURL, domain.EndpointTypePublic, "")
+
+	captive := mkProbe(portal, domain.StatusCaptivePortal, 3)
+	captive.Captive = &domain.CaptivePortalDetails{Reasons: []string{"response body replaced"}}
+
+	// the portal answers plain HTTP itself, so the direct probe passes
+	r := domain.ConnectivityResult{
+		Probes: []domain.Probe{
+			mkProbe(dns, domain.StatusPass, 1),
+			mkProbe(httpEp, domain.StatusPass, 5),
+			captive,
+		},
+	}
+	r.DetermineMode()
+	if r.Mode != domain.ModeCaptivePortal || r.IsConnected {
+		t.Fatalf("want ModeCaptivePortal not connected, got %v connected=%v", r.Mode, r.IsConnected)
+	}
+
+	// a working proxy still gets out
+	proxied := domain.MustNewHTTPEndpoint("https://example.com", domain.EndpointTypePublic, true, "http://proxy.local:8080", "")
+	r.Probes = append(r.Probes, mkProbe(proxied, domain.StatusPass, 9))
+	r.DetermineMode()
+	if r.Mode != domain.ModeViaProxy {
+		t.Fatalf("want ModeViaProxy, got %v", r.Mode)
+	}
+}
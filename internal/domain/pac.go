@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PACSource names a proxy auto-config script, by URL or local file.
+type PACSource struct {
+	URL  string
+	File string
+}
+
+func (s PACSource) IsZero() bool {
+	return s.URL == "" && s.File == ""
+}
+
+func (s PACSource) String() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return s.File
+}
+
+type ProxyRouteKind int
+
+const (
+	ProxyRouteDirect ProxyRouteKind = iota
+	ProxyRouteHTTP
+	ProxyRouteHTTPS
+	ProxyRouteSOCKS
+)
+
+// ProxyRoute is one entry of a FindProxyForURL result, such as
+// "PROXY proxy.corp:3128" or "DIRECT".
+type ProxyRoute struct {
+	Kind ProxyRouteKind
+	Host string // host:port; empty for DIRECT
+}
+
+// ParsePACResult splits a FindProxyForURL result into its routes, in order
+// of preference. An empty result means DIRECT. Entries of unsupported types
+// (SOCKS4) are skipped, as a browser would.
+func ParsePACResult(s string) ([]ProxyRoute, error) {
+	var routes []ProxyRoute
+	var skipped []string
+	for _, entry := range strings.Split(s, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		keyword := strings.ToUpper(fields[0])
+		if keyword == "DIRECT" {
+			routes = append(routes, ProxyRoute{Kind: ProxyRouteDirect})
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid PAC entry %q", strings.TrimSpace(entry))
+		}
+		var kind ProxyRouteKind
+		switch keyword {
+		case "PROXY", "HTTP":
+			kind = ProxyRouteHTTP
+		case "HTTPS":
+			kind = ProxyRouteHTTPS
+		case "SOCKS", "SOCKS5":
+			kind = ProxyRouteSOCKS
+		default:
+			skipped = append(skipped, keyword)
+			continue
+		}
+		routes = append(routes, ProxyRoute{Kind: kind, Host: fields[1]})
+	}
+	if len(routes) == 0 && len(skipped) > 0 {
+		return nil, fmt.Errorf("no supported route in PAC result %q", s)
+	}
+	if len(routes) == 0 {
+		routes = append(routes, ProxyRoute{Kind: ProxyRouteDirect})
+	}
+	return routes, nil
+}
+
+func (r ProxyRoute) IsDirect() bool {
+	return r.Kind == ProxyRouteDirect
+}
+
+// ProxyURL returns the proxy URL for the route, or "" for DIRECT.
+func (r ProxyRoute) ProxyURL() string {
+	switch r.Kind {
+	case ProxyRouteHTTP:
+		return "http://" + r.Host
+	case ProxyRouteHTTPS:
+		return "https://" + r.Host
+	case ProxyRouteSOCKS:
+		return "socks5://" + r.Host
+	default:
+		return ""
+	}
+}
+
+func (r ProxyRoute) String() string {
+	switch r.Kind {
+	case ProxyRouteHTTP:
+		return "PROXY " + r.Host
+	case ProxyRouteHTTPS:
+		return "HTTPS " + r.Host
+	case ProxyRouteSOCKS:
+		return "SOCKS5 " + r.Host
+	default:
+		return "DIRECT"
+	}
+}
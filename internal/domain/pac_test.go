@@ -0,0 +1,40 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestParsePACResult(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string // ProxyURL of each route
+	}{
+		{"", []string{""}},
+		{"DIRECT", []string{""}},
+		{"PROXY proxy.test:3128; DIRECT", []string{"http://proxy.test:3128", ""}},
+		{"  HTTPS tls.test:443 ;SOCKS socks.test:1080; ", []string{"https://tls.test:443", "socks5://socks.test:1080"}},
+		{"SOCKS4 old.test:1080; HTTP proxy.test:80", []string{"http://proxy.test:80"}},
+	}
+	for _, tc := range cases {
+		routes, err := domain.ParsePACResult(tc.in)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if len(routes) != len(tc.want) {
+			t.Fatalf("%q: got %v", tc.in, routes)
+		}
+		for i, r := range routes {
+			if r.ProxyURL() != tc.want[i] {
+				t.Errorf("%q: route %d is %q, want %q", tc.in, i, r.ProxyURL(), tc.want[i])
+			}
+		}
+	}
+
+	for _, bad := range []string{"PROXY", "PROXY a b", "SOCKS4 old.test:1080"} {
+		if _, err := domain.ParsePACResult(bad); err == nil {
+			t.Errorf("%q: want an error", bad)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// CertPins are what a chain must present beyond validating: the SHA-256 of
+// the public key of any certificate in it, or of the leaf or its issuer
+// whole. All values are lowercase hex. Any one pin matching passes, so
+// several allow for rotation.
+type CertPins struct {
+	SPKI   []string
+	Leaf   []string
+	Issuer []string
+}
+
+func (p CertPins) IsZero() bool {
+	return len(p.SPKI) == 0 && len(p.Leaf) == 0 && len(p.Issuer) == 0
+}
+
+// Matches reports whether chain, leaf first, presents one of the pins.
+func (p CertPins) Matches(chain []TLSCertificate) bool {
+	for _, c := range chain {
+		if containsPin(p.SPKI, c.SPKI) {
+			return true
+		}
+	}
+	if len(chain) > 0 && containsPin(p.Leaf, chain[0].Fingerprint) {
+		return true
+	}
+	return len(chain) > 1 && containsPin(p.Issuer, chain[1].Fingerprint)
+}
+
+// Presented names the values of chain the pins compare, of the kinds pinned,
+// as they would be written into the configuration or a bypass list.
+func (p CertPins) Presented(chain []TLSCertificate) string {
+	if len(chain) == 0 {
+		return "no certificates"
+	}
+	var parts []string
+	if len(p.SPKI) > 0 {
+		for i, c := range chain {
+			parts = append(parts, ChainRole(chain, i)+" SPKI "+SPKIPin(c.SPKI))
+		}
+	}
+	if len(p.Leaf) > 0 {
+		parts = append(parts, "leaf fingerprint "+chain[0].Fingerprint)
+	}
+	if len(p.Issuer) > 0 {
+		if len(chain) > 1 {
+			parts = append(parts, "issuer fingerprint "+chain[1].Fingerprint)
+		} else {
+			parts = append(parts, "no issuer")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ChainRole names the place of chain[i], leaf first: "leaf", "root" for a
+// self-signed certificate, "intermediate" otherwise.
+func ChainRole(chain []TLSCertificate, i int) string {
+	switch {
+	case i == 0:
+		return "leaf"
+	case chain[i].Issuer != "" && chain[i].Issuer == chain[i].Subject:
+		return "root"
+	}
+	return "intermediate"
+}
+
+func containsPin(pins []string, value string) bool {
+	for _, pin := range pins {
+		if pin == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePin reads a SHA-256 pin written as hex, with or without colons, or
+// as base64 with an optional "sha256/" prefix, the form of HPKP and curl's
+// --pinnedpubkey. It returns lowercase hex.
+func ParsePin(s string) (string, error) {
+	v := strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(v, "sha256/"); ok {
+		v = strings.TrimPrefix(rest, "/")
+	}
+	if h := strings.ToLower(strings.ReplaceAll(v, ":", "")); len(h) == 64 {
+		if _, err := hex.DecodeString(h); err == nil {
+			return h, nil
+		}
+	}
+	if b, err := base64.StdEncoding.DecodeString(v); err == nil && len(b) == 32 {
+		return hex.EncodeToString(b), nil
+	}
+	return "", fmt.Errorf("pin %q is not a SHA-256 in hex or base64", s)
+}
+
+// SPKIPin writes a hex SPKI hash the way pins are usually given,
+// "sha256/" and base64.
+func SPKIPin(spkiHex string) string {
+	b, err := hex.DecodeString(spkiHex)
+	if err != nil {
+		return spkiHex
+	}
+	return "sha256/" + base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,66 @@
+package domain_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestParsePin(t *testing.T) {
+	const want = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for _, in := range []string{
+		want,
+		strings.ToUpper(want),
+		"01:23:45:67:89:ab:cd:ef:01:23:45:67:89:ab:cd:ef:01:23:45:67:89:ab:cd:ef:01:23:45:67:89:ab:cd:ef",
+		"ASNFZ4mrze8BI0VniavN7wEjRWeJq83vASNFZ4mrze8=",
+		"sha256/ASNFZ4mrze8BI0VniavN7wEjRWeJq83vASNFZ4mrze8=",
+		"sha256//ASNFZ4mrze8BI0VniavN7wEjRWeJq83vASNFZ4mrze8=",
+	} {
+		if got, err := domain.ParsePin(in); err != nil || got != want {
+			t.Errorf("ParsePin(%q) = %q, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"", "abc", "sha1/AAAA", strings.Repeat("z", 64)} {
+		if _, err := domain.ParsePin(in); err == nil {
+			t.Errorf("ParsePin(%q): want an error", in)
+		}
+	}
+	if got := domain.SPKIPin(want); got != "sha256/ASNFZ4mrze8BI0VniavN7wEjRWeJq83vASNFZ4mrze8=" {
+		t.Errorf("SPKIPin = %q", got)
+	}
+}
+
+func TestCheckPins(t *testing.T) {
+	chain := []domain.TLSCertificate{
+		{Subject: "CN=insite", Issuer: "CN=Sub CA", SPKI: "aa", Fingerprint: "a1"},
+		{Subject: "CN=Sub CA", Issuer: "CN=Root CA", SPKI: "bb", Fingerprint: "b1"},
+		{Subject: "CN=Root CA", Issuer: "CN=Root CA", SPKI: "cc", Fingerprint: "c1"},
+	}
+	probe := func() domain.Probe {
+		return domain.Probe{Status: domain.StatusPass, TLS: &domain.TLSDetails{Certificates: chain}}
+	}
+
+	for name, pins := range map[string]domain.CertPins{
+		"spki of the root":    {SPKI: []string{"old", "cc"}},
+		"leaf fingerprint":    {Leaf: []string{"a1"}},
+		"issuer fingerprint":  {Issuer: []string{"b1"}},
+		"one kind of several": {SPKI: []string{"old"}, Issuer: []string{"b1"}},
+	} {
+		p := probe()
+		if p.CheckPins(pins); !p.IsSuccessful() {
+			t.Errorf("%s: want a match, got %v (%s)", name, p.Status, p.Error)
+		}
+	}
+
+	p := probe()
+	p.CheckPins(domain.CertPins{SPKI: []string{"old"}, Issuer: []string{"a1"}})
+	if p.Status != domain.StatusPinMismatch || !strings.Contains(p.Error, "issuer fingerprint b1") {
+		t.Fatalf("want a mismatch naming what was presented, got %v (%s)", p.Status, p.Error)
+	}
+	for _, want := range []string{"leaf SPKI " + domain.SPKIPin("aa"), "intermediate SPKI " + domain.SPKIPin("bb"), "root SPKI " + domain.SPKIPin("cc")} {
+		if !strings.Contains(p.Error, want) {
+			t.Errorf("want %q among the presented pins, got %s", want, p.Error)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"crypto/tls"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -11,12 +13,24 @@ type Probe struct {
 	LatencyMs float64
 	Error     string
 	Timestamp time.Time
+	DNS       *DNSDetails
+	TLS       *TLSDetails
+	HTTP      *HTTPDetails
+	Proxy     *ProxyDetails
+	Captive   *CaptivePortalDetails
+	Throughput *ThroughputDetails
+	Bandwidth  *BandwidthDetails
+	Interception *InterceptionReport
 }
 
 func (p Probe) IsSuccessful() bool {
 	return p.Status == StatusPass
 }
 
+func (p Probe) IsWarning() bool {
+	return p.Status == StatusWarning
+}
+
 func (p Probe) IsSkipped() bool {
 	return p.Status == StatusSkipped
 }
@@ -65,6 +79,99 @@ func (p *Probe) MarkSuccess(latMs float64) {
 	p.Timestamp = time.Now()
 }
 
+// CheckTLSPolicy holds a passing probe's session to the pins, requirements
+// and expiry thresholds of opts, in that order.
+func (p *Probe) CheckTLSPolicy(opts TLSOptions, now time.Time) {
+	p.CheckPins(opts.Pins)
+	p.CheckTLSRequirements(opts)
+	p.CheckCertExpiry(opts, now)
+}
+
+// CheckPins fails a passing probe whose chain presents none of pins, naming
+// what it presented instead.
+func (p *Probe) CheckPins(pins CertPins) {
+	if p.TLS == nil || pins.IsZero() || !p.Status.IsSuccess() {
+		return
+	}
+	if !pins.Matches(p.TLS.Certificates) {
+		p.MarkFailure(StatusPinMismatch, Errorf(ErrorCodePinMismatch, "no pin matches; presented %s", pins.Presented(p.TLS.Certificates)))
+	}
+}
+
+// CheckTLSRequirements fails a passing probe whose stapled OCSP response
+// revokes its certificate, or whose session was negotiated below the
+// minimum version of opts or without the ALPN protocol it asks for: the
+// marks of a proxy that downgrades or strips h2.
+func (p *Probe) CheckTLSRequirements(opts TLSOptions) {
+	if p.TLS == nil || p.TLS.Version == 0 || !p.Status.IsSuccess() {
+		return
+	}
+	switch {
+	case p.TLS.OCSPStatus == OCSPRevoked:
+		p.MarkFailure(StatusCertInvalid, Errorf(ErrorCodeCertInvalid, "the stapled OCSP response says the certificate is revoked"))
+	case opts.MinVersion != 0 && p.TLS.Version < opts.MinVersion:
+		p.MarkFailure(StatusFail, Errorf(ErrorCodeTLSFailed, "negotiated %s, below the required %s",
+			p.TLS.VersionName(), tls.VersionName(opts.MinVersion)))
+	case opts.ALPN != "" && p.TLS.ALPN != opts.ALPN:
+		got := p.TLS.ALPN
+		if got == "" {
+			got = "none"
+		}
+		p.MarkFailure(StatusFail, Errorf(ErrorCodeTLSFailed, "negotiated ALPN %s, want %s", got, opts.ALPN))
+	}
+}
+
+// CheckCertExpiry fails a passing probe whose chain has a certificate
+// expiring within the critical days of opts, or warns within the warn days.
+func (p *Probe) CheckCertExpiry(opts TLSOptions, now time.Time) {
+	if p.TLS == nil || !p.Status.IsSuccess() {
+		return
+	}
+	cert, ok := p.TLS.FirstToExpire()
+	if !ok {
+		return
+	}
+	warn, critical := opts.ExpiryThresholds()
+	days := cert.DaysLeft(now)
+	err := Errorf(ErrorCodeCertExpiring, "certificate %s expires in %d days (%s)",
+		cert.Subject, days, cert.NotAfter.Format("2006-01-02"))
+	switch {
+	case critical >= 0 && days < critical:
+		p.MarkFailure(StatusFail, err)
+	case warn >= 0 && days < warn && p.IsSuccessful():
+		p.MarkWarning(err)
+	}
+}
+
+// CheckInterception fails the probe as intercepted when its report found
+// any path intercepted, or as failed when no path returned a chain at all.
+func (p *Probe) CheckInterception() {
+	r := p.Interception
+	if r == nil {
+		return
+	}
+	if r.Inspected() {
+		p.MarkFailure(StatusIntercepted, Errorf(ErrorCodeTLSIntercepted, "%s", strings.Join(r.Findings, "; ")))
+		return
+	}
+	if !r.Fetched() {
+		var reasons []string
+		for _, o := range r.Paths {
+			if o.Err != nil {
+				reasons = append(reasons, fmt.Sprintf("%s: %v", o.PathName(), o.Err))
+			}
+		}
+		p.MarkFailure(StatusFail, Errorf(ErrorCodeTLSFailed, "no chain fetched for %s (%s)", r.Target, strings.Join(reasons, "; ")))
+	}
+}
+
+// MarkWarning keeps the probe successful but flags it with a reason.
+func (p *Probe) MarkWarning(err error) {
+	p.Status = StatusWarning
+	p.Error = safeErr(err)
+	p.Timestamp = time.Now()
+}
+
 func (p *Probe) MarkFailure(st Status, err error) {
 	p.Status = st
 	p.Error = safeErr(err)
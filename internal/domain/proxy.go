@@ -1,13 +1,18 @@
 package domain
 
 import(
+	"net"
 	"net/url"
 	"fmt"
+	"strings"
 )
 
 type ProxyConfig struct {
 	enabled bool
 	url     string 
+	caFile  string // extra roots for https:// proxies
+	pac     PACSource
+	system  bool // route by HTTP_PROXY, HTTPS_PROXY and NO_PROXY
 }
 
 func NewProxyConfig(enabled bool, url string) ProxyConfig {
@@ -30,11 +35,54 @@ func (p ProxyConfig) URL() string {
 	return p.url 
 }
 
+// SetCAFile adds the PEM certificates in path to the roots an https:// proxy
+// is verified against.
+func (p *ProxyConfig) SetCAFile(path string) {
+	p.caFile = path
+}
+
+func (p ProxyConfig) CAFile() string {
+	return p.caFile
+}
+
+// SetPAC routes the endpoint by a proxy auto-config script, which takes
+// precedence over the URL.
+func (p *ProxyConfig) SetPAC(src PACSource) {
+	p.enabled = true
+	p.pac = src
+}
+
+func (p ProxyConfig) PAC() PACSource {
+	return p.pac
+}
+
+func (p ProxyConfig) UsesPAC() bool {
+	return p.enabled && !p.pac.IsZero()
+}
+
+// SetSystem routes the endpoint by the proxy settings of the environment.
+func (p *ProxyConfig) SetSystem() {
+	p.enabled = true
+	p.system = true
+}
+
+func (p ProxyConfig) UsesSystem() bool {
+	return p.enabled && p.system
+}
+
+// MustUseProxy reports whether the endpoint is tested through a proxy: a
+// fixed URL, or one a PAC script or the environment picks per target.
 func (p ProxyConfig) MustUseProxy() bool { 
-	return p.enabled && p.url != ""
+	return p.enabled && (p.url != "" || p.UsesPAC() || p.system)
 }
 
 func (p ProxyConfig) String() string {
+	if p.UsesPAC() {
+		return fmt.Sprintf("Proxy enabled: PAC %s", p.pac)
+	}
+	if p.UsesSystem() {
+		return "Proxy enabled: system"
+	}
 	if p.enabled {
 		return fmt.Sprintf("Proxy enabled: %s", p.url)
 	}
@@ -45,6 +93,103 @@ func (p ProxyConfig) IsValid() bool {
 	if !p.enabled {
 		return true 
 	}
+	if p.UsesPAC() || p.UsesSystem() {
+		return true
+	}
 	_, err := url.Parse(p.url)
 	return err == nil && p.url != ""
-}
\ No newline at end of file
+}
+
+// ProxyDetails describes the connection to the proxy itself.
+type ProxyDetails struct {
+	URL   string      // credentials redacted; empty for a DIRECT route
+	TLS   *TLSDetails // set for https:// proxies
+	Route       string // the route chosen for the target, e.g. "PROXY proxy.corp:3128"
+	RouteSource string // what chose it: "PAC" or "environment"
+	FailedRoutes []string // routes tried before Route that did not connect
+	Stages      []ProxyStage
+}
+
+// Verdict is ProxyVerdict of the stages.
+func (d ProxyDetails) Verdict() string {
+	return ProxyVerdict(d.Stages)
+}
+
+// DefaultProxyPort is the port assumed for a proxy URL of scheme that names none.
+func DefaultProxyPort(scheme string) string {
+	switch scheme {
+	case "https":
+		return "443"
+	case "socks5", "socks5h":
+		return "1080"
+	default:
+		return "80"
+	}
+}
+
+// EnvProxy holds the proxy settings found in the environment.
+type EnvProxy struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+}
+
+func (e EnvProxy) IsZero() bool {
+	return e == EnvProxy{}
+}
+
+// String lists the variables that are set, with credentials redacted.
+func (e EnvProxy) String() string {
+	var parts []string
+	if e.HTTPSProxy != "" {
+		parts = append(parts, "HTTPS_PROXY="+redactProxyURL(e.HTTPSProxy))
+	}
+	if e.HTTPProxy != "" {
+		parts = append(parts, "HTTP_PROXY="+redactProxyURL(e.HTTPProxy))
+	}
+	if e.NoProxy != "" {
+		parts = append(parts, "NO_PROXY="+e.NoProxy)
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Primary is the proxy most traffic would take: HTTPS_PROXY, else HTTP_PROXY.
+func (e EnvProxy) Primary() string {
+	if e.HTTPSProxy != "" {
+		return e.HTTPSProxy
+	}
+	return e.HTTPProxy
+}
+
+// SameProxy reports whether two proxy URLs name the same host and port.
+// Scheme-less values are taken as http://, as the environment variables are.
+func SameProxy(a, b string) bool {
+	ha, okA := proxyAddr(a)
+	hb, okB := proxyAddr(b)
+	return okA && okB && strings.EqualFold(ha, hb)
+}
+
+func proxyAddr(s string) (string, bool) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	port := u.Port()
+	if port == "" {
+		port = DefaultProxyPort(u.Scheme)
+	}
+	return net.JoinHostPort(u.Hostname(), port), true
+}
+
+func redactProxyURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package domain
+
+import "strings"
+
+// AuthChallenge is one challenge of a Proxy-Authenticate header.
+type AuthChallenge struct {
+	Scheme string            // as sent, e.g. "Digest"
+	Params map[string]string // keys lowercased; empty for token68 schemes
+}
+
+// Realm is the challenge's realm, or "".
+func (c AuthChallenge) Realm() string {
+	return c.Params["realm"]
+}
+
+// Is reports whether the challenge is for scheme, ignoring case.
+func (c AuthChallenge) Is(scheme string) bool {
+	return strings.EqualFold(c.Scheme, scheme)
+}
+
+func (c AuthChallenge) String() string {
+	if realm := c.Realm(); realm != "" {
+		return c.Scheme + ` realm="` + realm + `"`
+	}
+	return c.Scheme
+}
+
+// AuthOffer lists the challenges for display, e.g.
+// `Basic realm="corp", NTLM`.
+func AuthOffer(challenges []AuthChallenge) string {
+	parts := make([]string, len(challenges))
+	for i, c := range challenges {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SupportedProxyAuth are the schemes credentials in a proxy URL are
+// answered with.
+var SupportedProxyAuth = []string{"Basic", "Digest"}
+
+// OffersSupportedAuth reports whether any challenge is one rsvpck answers.
+func OffersSupportedAuth(challenges []AuthChallenge) bool {
+	for _, c := range challenges {
+		for _, s := range SupportedProxyAuth {
+			if c.Is(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package domain
+
+import "fmt"
+
+// ProxyStageName names one step of reaching a target through a proxy.
+type ProxyStageName string
+
+const (
+	ProxyStageTCP     ProxyStageName = "proxy TCP" // connecting to the proxy
+	ProxyStageTLS     ProxyStageName = "proxy TLS" // handshake with an https:// proxy
+	ProxyStageConnect ProxyStageName = "CONNECT"   // the proxy accepting the tunnel or request
+	ProxyStageAuth    ProxyStageName = "auth"      // the proxy's authentication challenge
+	ProxyStageTarget  ProxyStageName = "target"    // the target answering through the proxy
+)
+
+// ProxyStage is the outcome of one stage. Stages after the first failure are
+// not attempted and not recorded.
+type ProxyStage struct {
+	Name      ProxyStageName
+	Status    Status
+	LatencyMs float64
+	Detail    string // e.g. `proxy offers Basic realm="corp"`
+}
+
+func (s ProxyStage) String() string {
+	text := fmt.Sprintf("%s: %s %.2f ms", s.Name, s.Status, s.LatencyMs)
+	if s.Detail != "" {
+		text += " (" + s.Detail + ")"
+	}
+	return text
+}
+
+// ProxyVerdict sums up the stages for support: which side of the proxy the
+// problem is on. It is empty when every stage passed.
+func ProxyVerdict(stages []ProxyStage) string {
+	s, failed := FailedProxyStage(stages)
+	if !failed {
+		return ""
+	}
+	switch s.Name {
+	case ProxyStageTCP, ProxyStageTLS:
+		return "proxy down"
+	case ProxyStageAuth:
+		return "proxy needs auth"
+	case ProxyStageConnect:
+		return "proxy blocks the target"
+	default:
+		return "target unreachable through the proxy"
+	}
+}
+
+// FailedProxyStage returns the stage that failed, if any.
+func FailedProxyStage(stages []ProxyStage) (ProxyStage, bool) {
+	for _, s := range stages {
+		if !s.Status.IsSuccess() {
+			return s, true
+		}
+	}
+	return ProxyStage{}, false
+}
+
+// FailureStatus is the probe status for a failure at this stage: the proxy
+// asking for credentials and the proxy refusing the target have their own,
+// other stages keep the status the error maps to.
+func (s ProxyStage) FailureStatus(fallback Status) Status {
+	switch s.Name {
+	case ProxyStageAuth:
+		return StatusProxyAuth
+	case ProxyStageConnect:
+		return StatusProxyBlocked
+	}
+	return fallback
+}
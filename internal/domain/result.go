@@ -8,10 +8,11 @@ type ConnectivityResult struct {
 	Probes      []Probe
 	Timestamp   time.Time
 	Summary     string
+	Diagnoses   []string
 }
 
 func NewConnectivityResult(mode ConnectivityMode, probes []Probe) ConnectivityResult {
-	isConnected := mode != ModeNone
+	isConnected := mode.IsConnected()
 	summary := buildSummary(mode)
 	return ConnectivityResult{
 		Mode:        mode,
@@ -32,30 +33,117 @@ func (r ConnectivityResult) SuccessfulProbes() []Probe {
 	return success
 }
 
+// WarningProbes are the probes that passed with a reason to look closer.
+func (r ConnectivityResult) WarningProbes() []Probe {
+	var warned []Probe
+	for _, p := range r.Probes {
+		if p.IsWarning() {
+			warned = append(warned, p)
+		}
+	}
+	return warned
+}
+
 func (r ConnectivityResult) FailedProbes() []Probe {
 	var failed []Probe
 	for _, p := range r.Probes {
-		if !p.IsSuccessful() {
+		if !p.Status.IsSuccess() && !p.IsSkipped() {
 			failed = append(failed, p)
 		}
 	}
 	return failed
 }
 
+// Exit codes of a run, from best to worst.
+const (
+	ExitOK           = 0 // every probe on the connected path passed
+	ExitWarning      = 1 // some probes on the connected path passed with warnings, none failed
+	ExitFailure      = 2 // connected, but some probes on the connected path failed
+	ExitNotConnected = 3
+	ExitUsage        = 4 // the config or a flag is invalid; nothing was checked
+)
+
+// ExitCode is the worst outcome on the path the run connected through: a
+// failed direct probe does not fail a run that got out via the proxy.
+func (r ConnectivityResult) ExitCode() int {
+	if !r.IsConnected {
+		return ExitNotConnected
+	}
+	return worstOutcome(r.Probes, r.onConnectedPath)
+}
+
+// ProbesExitCode is the worst outcome of probes run on their own, such as
+// the speed tests: a failure over a warning over a pass.
+func ProbesExitCode(probes []Probe) int {
+	return worstOutcome(probes, func(Probe) bool { return true })
+}
+
+// worstOutcome is ExitOK, ExitWarning or ExitFailure for the probes counted.
+// An AnyOf group counts as its best member, so one of several fallbacks
+// getting through is enough; skipped probes do not count.
+func worstOutcome(probes []Probe, counted func(Probe) bool) int {
+	worst := ExitOK
+	groups := make(map[string]int)
+	for _, p := range probes {
+		if !counted(p) || p.IsSkipped() {
+			continue
+		}
+		outcome := ExitOK
+		switch {
+		case !p.Status.IsSuccess():
+			outcome = ExitFailure
+		case p.IsWarning():
+			outcome = ExitWarning
+		}
+		if g := p.Endpoint.AnyOf; g != "" {
+			if best, seen := groups[g]; !seen || outcome < best {
+				groups[g] = outcome
+			}
+			continue
+		}
+		worst = max(worst, outcome)
+	}
+	for _, outcome := range groups {
+		worst = max(worst, outcome)
+	}
+	return worst
+}
+
+// onConnectedPath reports whether p went the way Mode says the run connected.
+// Interception checks compare every path, so they always count.
+func (r ConnectivityResult) onConnectedPath(p Probe) bool {
+	if p.Endpoint.TargetType == TargetTypeInterception {
+		return r.Mode.IsConnected()
+	}
+	switch r.Mode {
+	case ModeDirect:
+		return !p.Endpoint.IsVPN() && !p.Endpoint.MustUseProxy()
+	case ModeViaProxy:
+		return !p.Endpoint.IsVPN() && p.Endpoint.MustUseProxy()
+	case ModeViaVPN:
+		return p.Endpoint.IsVPN()
+	}
+	return false
+}
+
 func (r *ConnectivityResult) DetermineMode() {
 	var (
 		vpnOK, directOK, proxyOK, dnsOK bool
+		captive                         bool
 	)
 
 	for _, p := range r.Probes {
-		if p.IsDNSProbe() && p.IsSuccessful() {
+		if p.IsDNSProbe() && p.Status.IsSuccess() {
 			dnsOK = true
 			break
 		}
 	}
 
 	for _, p := range r.Probes {
-		if !p.IsSuccessful() {
+		if p.Captive != nil && p.Captive.Detected() {
+			captive = true
+		}
+		if !p.Status.IsSuccess() {
 			continue
 		}
 
@@ -74,6 +162,11 @@ func (r *ConnectivityResult) DetermineMode() {
 		}
 	}
 
+	// behind a portal, direct probes may pass against the portal itself
+	if captive {
+		directOK = false
+	}
+
 	switch {
 	case directOK && dnsOK:
 		r.Mode = ModeDirect
@@ -81,6 +174,8 @@ func (r *ConnectivityResult) DetermineMode() {
 		r.Mode = ModeViaProxy
 	case vpnOK:
 		r.Mode = ModeViaVPN
+	case captive:
+		r.Mode = ModeCaptivePortal
 	default:
 		r.Mode = ModeNone
 	}
@@ -97,6 +192,8 @@ func buildSummary(mode ConnectivityMode) string {
 		return "Direct internet."
 	case ModeViaProxy:
 		return "Internet via proxy"
+	case ModeCaptivePortal:
+		return "Captive portal: sign in on the network's login page first."
 	default:
 		return "No connection"
 	}
@@ -103,3 +103,92 @@ func Test_Summary_MatchesMode_OnConstruction(t *testing.T) {
 		}
 	}
 }
+
+func Test_ExitCode_WarningsDistinctFromFailures(t *testing.T) {
+	pass := domain.Probe{Status: domain.StatusPass}
+	warn := domain.Probe{Status: domain.StatusWarning}
+	fail := domain.Probe{Status: domain.StatusFail}
+
+	cases := []struct {
+		mode   domain.ConnectivityMode
+		probes []domain.Probe
+		want   int
+	}{
+		{domain.ModeDirect, []domain.Probe{pass}, domain.ExitOK},
+		{domain.ModeDirect, []domain.Probe{pass, warn}, domain.ExitWarning},
+		{domain.ModeDirect, []domain.Probe{warn, fail}, domain.ExitFailure},
+		{domain.ModeNone, []domain.Probe{fail}, domain.ExitNotConnected},
+	}
+	for _, tc := range cases {
+		cr := domain.NewConnectivityResult(tc.mode, tc.probes)
+		if got := cr.ExitCode(); got != tc.want {
+			t.Errorf("ExitCode(%v, %d probes) = %d, want %d", tc.mode, len(tc.probes), got, tc.want)
+		}
+	}
+
+	cr := domain.NewConnectivityResult(domain.ModeDirect, []domain.Probe{pass, warn, fail})
+	if len(cr.WarningProbes()) != 1 || len(cr.FailedProbes()) != 1 {
+		t.Fatalf("want the warning counted apart from the failure, got %d warnings and %d failures",
+			len(cr.WarningProbes()), len(cr.FailedProbes()))
+	}
+}
+
+func Test_ExitCode_OnlyTheConnectedPath(t *testing.T) {
+	direct := domain.MustNewTCPEndpoint("insite.example.com:443", domain.EndpointTypePublic, "")
+	proxied := domain.MustNewTCPEndpoint("insite.example.com:443", domain.EndpointTypePublic, "")
+	proxied.SetProxy("http://proxy.corp.test:3128")
+	vpn := domain.MustNewTCPEndpoint("10.0.0.1:443", domain.EndpointTypeVPN, "")
+
+	directDown := domain.NewFailedProbe(direct, domain.StatusTimeout, nil)
+	viaProxy := domain.NewSuccessfulProbe(proxied, 1)
+	vpnDown := domain.NewFailedProbe(vpn, domain.StatusTimeout, nil)
+
+	cr := domain.NewConnectivityResult(domain.ModeViaProxy, []domain.Probe{directDown, viaProxy, vpnDown})
+	if got := cr.ExitCode(); got != domain.ExitOK {
+		t.Fatalf("want the blocked direct and VPN paths ignored via the proxy, got %d", got)
+	}
+	cr = domain.NewConnectivityResult(domain.ModeDirect, []domain.Probe{directDown, viaProxy})
+	if got := cr.ExitCode(); got != domain.ExitFailure {
+		t.Fatalf("want a failed direct probe to fail a direct run, got %d", got)
+	}
+}
+
+func Test_ProbesExitCode(t *testing.T) {
+	pass := domain.Probe{Status: domain.StatusPass}
+	warn := domain.Probe{Status: domain.StatusWarning}
+	fail := domain.Probe{Status: domain.StatusFail}
+
+	for _, tc := range []struct {
+		probes []domain.Probe
+		want   int
+	}{
+		{nil, domain.ExitOK},
+		{[]domain.Probe{pass}, domain.ExitOK},
+		{[]domain.Probe{pass, warn}, domain.ExitWarning},
+		{[]domain.Probe{fail, warn}, domain.ExitFailure},
+	} {
+		if got := domain.ProbesExitCode(tc.probes); got != tc.want {
+			t.Errorf("ProbesExitCode(%d probes) = %d, want %d", len(tc.probes), got, tc.want)
+		}
+	}
+}
+
+func Test_ExitCode_AnyOfGroup(t *testing.T) {
+	relay := func(addr string) domain.Endpoint {
+		ep, _ := domain.NewTLSEndpoint("insite.example.com", domain.EndpointTypeVPN, "")
+		ep.SetProxy(addr)
+		ep.AnyOf = "insite-cert"
+		return ep
+	}
+	deadRelay := domain.NewFailedProbe(relay("10.25.0.20:8080"), domain.StatusTimeout, nil)
+	liveRelay := domain.NewSuccessfulProbe(relay("150.2.101.89:443"), 1)
+
+	cr := domain.NewConnectivityResult(domain.ModeViaVPN, []domain.Probe{deadRelay, liveRelay})
+	if got := cr.ExitCode(); got != domain.ExitOK {
+		t.Fatalf("want one relay getting through to pass the group, got %d", got)
+	}
+	cr = domain.NewConnectivityResult(domain.ModeViaVPN, []domain.Probe{deadRelay, deadRelay})
+	if got := cr.ExitCode(); got != domain.ExitFailure {
+		t.Fatalf("want the group failed when every relay fails, got %d", got)
+	}
+}
@@ -7,15 +7,23 @@ import (
 
 type TCPChecker interface {
 	CheckWithContext(ctx context.Context, ep Endpoint) Probe
+	CheckViaProxyWithContext(ctx context.Context, ep Endpoint, proxyURL string) Probe
+	CheckTLSWithContext(ctx context.Context, ep Endpoint, proxyURL string) Probe
+	CheckInterceptionWithContext(ctx context.Context, ep Endpoint) Probe
 }
 
 type DNSChecker interface {
 	CheckWithContext(ctx context.Context, ep Endpoint) Probe
+	CheckDoHWithContext(ctx context.Context, ep Endpoint, proxyURL string) Probe
+	CheckDoTWithContext(ctx context.Context, ep Endpoint) Probe
 }
 
 type HTTPChecker interface {
 	CheckWithContext(ctx context.Context, ep Endpoint) Probe
 	CheckViaProxyWithContext(ctx context.Context, ep Endpoint, proxyURL string) Probe
+	CheckCaptivePortalWithContext(ctx context.Context, ep Endpoint) Probe
+	CheckThroughputWithContext(ctx context.Context, ep Endpoint, proxyURL string) Probe
+	CheckBandwidthWithContext(ctx context.Context, ep Endpoint) Probe
 }
 
 type ICMPChecker interface {
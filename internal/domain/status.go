@@ -15,12 +15,19 @@ const (
 	StatusDNSFailure
 	StatusHTTPError
 	StatusProxyAuth
+	StatusDNSMismatch
+	StatusHTTPMismatch
+	StatusCaptivePortal
+	StatusProxyBlocked
+	StatusCertInvalid
+	StatusPinMismatch
+	StatusIntercepted
 )
 
 func (s Status) IsValid() bool {
 	switch s {
 	case StatusUnknown, StatusSkipped, StatusFail, StatusPass, StatusWarning, StatusTimeout,
-		StatusConnectionRefused, StatusInvalid, StatusDNSFailure, StatusHTTPError, StatusProxyAuth:
+		StatusConnectionRefused, StatusInvalid, StatusDNSFailure, StatusHTTPError, StatusProxyAuth, StatusDNSMismatch, StatusHTTPMismatch, StatusCaptivePortal, StatusProxyBlocked, StatusCertInvalid, StatusPinMismatch, StatusIntercepted:
 		return true
 	}
 	return false
@@ -55,6 +62,20 @@ func (s Status) String() string {
 		return "HTTP Error"
 	case StatusProxyAuth:
 		return "Proxy Auth error"
+	case StatusDNSMismatch:
+		return "Unexpected DNS answer"
+	case StatusHTTPMismatch:
+		return "Unexpected HTTP response"
+	case StatusCaptivePortal:
+		return "Captive portal"
+	case StatusProxyBlocked:
+		return "Blocked by proxy"
+	case StatusCertInvalid:
+		return "Certificate invalid"
+	case StatusPinMismatch:
+		return "Pin mismatch"
+	case StatusIntercepted:
+		return "TLS intercepted"
 	}
 	return "Undefined"
 }
@@ -0,0 +1,80 @@
+package domain
+
+import "fmt"
+
+// Defaults for a throughput endpoint that names no sizes.
+const (
+	DefaultThroughputDownloadBytes = 10 << 20
+	DefaultThroughputStallMs       = 500
+)
+
+// ThroughputOptions describe the transfers of a throughput probe.
+type ThroughputOptions struct {
+	DownloadBytes int64   // read from the target; 0 means DefaultThroughputDownloadBytes
+	UploadBytes   int64   // POSTed after the download; 0 skips the upload
+	UploadURL     string  // "" means the target
+	StallMs       float64 // a gap between reads this long counts as a stall; 0 means the default
+}
+
+func (o ThroughputOptions) Download() int64 {
+	if o.DownloadBytes > 0 {
+		return o.DownloadBytes
+	}
+	return DefaultThroughputDownloadBytes
+}
+
+func (o ThroughputOptions) StallThresholdMs() float64 {
+	if o.StallMs > 0 {
+		return o.StallMs
+	}
+	return DefaultThroughputStallMs
+}
+
+// TransferStats measure one direction of a throughput probe.
+type TransferStats struct {
+	Bytes          int64
+	DurationMs     float64 // of the body transfer
+	TTFBMs         float64 // from sending the request to the first response byte
+	Stalls         int
+	LongestStallMs float64
+}
+
+// Mbps is the transfer rate in megabits per second.
+func (s TransferStats) Mbps() float64 {
+	if s.DurationMs <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) * 8 / (s.DurationMs / 1000) / 1e6
+}
+
+func (s TransferStats) String() string {
+	text := fmt.Sprintf("%s in %.0f ms, %.2f Mbps, TTFB %.2f ms", FormatBytes(s.Bytes), s.DurationMs, s.Mbps(), s.TTFBMs)
+	switch s.Stalls {
+	case 0:
+		return text + ", no stalls"
+	case 1:
+		return text + fmt.Sprintf(", 1 stall of %.0f ms", s.LongestStallMs)
+	default:
+		return text + fmt.Sprintf(", %d stalls, longest %.0f ms", s.Stalls, s.LongestStallMs)
+	}
+}
+
+// ThroughputDetails are the transfers a throughput probe made.
+type ThroughputDetails struct {
+	Download TransferStats
+	Upload   *TransferStats // nil when no upload was asked for
+}
+
+// FormatBytes shows n in binary units, e.g. "10.0 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
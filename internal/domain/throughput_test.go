@@ -0,0 +1,32 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestTransferStats(t *testing.T) {
+	s := domain.TransferStats{Bytes: 10 << 20, DurationMs: 1000, TTFBMs: 42}
+	if got := s.Mbps(); got < 83.8 || got > 83.9 {
+		t.Fatalf("Mbps = %v, want 10 MiB/s in megabits", got)
+	}
+	if got := s.String(); got != "10.0 MiB in 1000 ms, 83.89 Mbps, TTFB 42.00 ms, no stalls" {
+		t.Fatalf("String = %q", got)
+	}
+	s.Stalls, s.LongestStallMs = 2, 612
+	if got := s.String(); got != "10.0 MiB in 1000 ms, 83.89 Mbps, TTFB 42.00 ms, 2 stalls, longest 612 ms" {
+		t.Fatalf("String = %q", got)
+	}
+	if (domain.TransferStats{Bytes: 1}).Mbps() != 0 {
+		t.Fatal("want no rate without a duration")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 20: "5.0 MiB", 3 << 30: "3.0 GiB"} {
+		if got := domain.FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TLSDetails describes the TLS session a probe went through.
+type TLSDetails struct {
+	ServerName   string
+	Certificates []TLSCertificate // as presented by the server, leaf first
+	TrustAnchor  string           // the root that validated the chain and where it came from
+	VerifyError  string           // why the chain failed verification
+	Problem      CertProblem      // VerifyError, named; "" when the chain verified
+	ClientCert   string           // subject of the client certificate sent, if the server asked
+	ConnectMs    float64          // to open the connection, or the tunnel through a proxy; TLS probes only
+	HandshakeMs  float64          // of the TLS handshake; TLS probes only
+
+	Version     uint16 // negotiated, as crypto/tls numbers it
+	CipherSuite string
+	ALPN        string // protocol the server picked, "" for none
+	OCSPStapled bool
+	OCSPStatus  string // of the stapled response: "good", "revoked", "unknown" or why it could not be read
+
+	ResumptionChecked bool // a second handshake offered the session of the first; TLS probes only
+	Resumed           bool // and the server took it
+}
+
+// Statuses of a stapled OCSP response that could be read.
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+)
+
+// VersionName is the negotiated version, such as "TLS 1.3".
+func (d TLSDetails) VersionName() string {
+	if d.Version == 0 {
+		return ""
+	}
+	return tls.VersionName(d.Version)
+}
+
+// TLSOptions are the trust and identity settings of a TLS connection.
+type TLSOptions struct {
+	CAFile         string // PEM roots added to the system store
+	CADir          string // directory of PEM roots, added likewise
+	ClientCert     string // PEM certificate, or a PKCS#12 bundle (.p12, .pfx) holding the key too
+	ClientKey      string // PEM key; unused for PKCS#12
+	ClientPassword string // of the PKCS#12 bundle
+	Insecure       bool   // complete the handshake despite a failed verification, and report it
+	ServerName     string // SNI to send instead of the target's host; TLS probes only
+	MinVersion     uint16 // lowest version the server may negotiate; 0 for any
+	ALPN           string // protocol the server must pick, such as "h2"
+	Pins           CertPins
+
+	// days before a certificate in the chain expires to warn, and to fail;
+	// 0 for the defaults, negative for never
+	ExpiryWarnDays     int
+	ExpiryCriticalDays int
+}
+
+// ParseTLSVersion reads a version written as "1.2", "TLS1.2" or "TLS 1.2".
+func ParseTLSVersion(s string) (uint16, error) {
+	v := strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS"))
+	switch v {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, want 1.0 to 1.3", s)
+}
+
+// Days before expiry at which a certificate turns a probe into a warning,
+// and a failure, unless the endpoint says otherwise.
+const (
+	DefaultCertWarnDays     = 30
+	DefaultCertCriticalDays = 7
+)
+
+// ExpiryThresholds returns the warn and critical days in effect; -1 turns
+// the check off.
+func (o TLSOptions) ExpiryThresholds() (warn, critical int) {
+	pick := func(days, def int) int {
+		switch {
+		case days == 0:
+			return def
+		case days < 0:
+			return -1
+		}
+		return days
+	}
+	return pick(o.ExpiryWarnDays, DefaultCertWarnDays), pick(o.ExpiryCriticalDays, DefaultCertCriticalDays)
+}
+
+// FirstToExpire returns the certificate of the chain that expires first.
+func (d TLSDetails) FirstToExpire() (TLSCertificate, bool) {
+	if len(d.Certificates) == 0 {
+		return TLSCertificate{}, false
+	}
+	first := d.Certificates[0]
+	for _, c := range d.Certificates[1:] {
+		if c.NotAfter.Before(first.NotAfter) {
+			first = c
+		}
+	}
+	return first, true
+}
+
+// DaysLeft is the whole days from now until the certificate expires.
+func (t TLSCertificate) DaysLeft(now time.Time) int {
+	return int(t.NotAfter.Sub(now) / (24 * time.Hour))
+}
+
+// CertProblem names why a chain failed verification.
+type CertProblem string
+
+const (
+	CertExpired          CertProblem = "expired"
+	CertNotYetValid      CertProblem = "not yet valid"
+	CertUnknownAuthority CertProblem = "unknown authority"
+	CertHostnameMismatch CertProblem = "hostname mismatch"
+	CertWeakSignature    CertProblem = "weak signature"
+	CertIncompleteChain  CertProblem = "incomplete chain"
+	CertInvalid          CertProblem = "invalid" // any other reason, such as a wrong key usage
+)
+
+func (o TLSOptions) IsZero() bool {
+	return reflect.DeepEqual(o, TLSOptions{})
+}
+
+func NewTLSCertificateFromX509(cert *x509.Certificate, now time.Time) TLSCertificate {
+	keyType, keyBits := publicKeyType(cert)
+	sum := sha256.Sum256(cert.Raw)
+	return TLSCertificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		Valid:              !now.Before(cert.NotBefore) && !now.After(cert.NotAfter),
+		SPKI:               SPKIFingerprint(cert),
+		SANs:               subjectAltNames(cert),
+		Serial:             cert.SerialNumber.Text(16),
+		KeyType:            keyType,
+		KeyBits:            keyBits,
+		Fingerprint:        hex.EncodeToString(sum[:]),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+	}
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+func publicKeyType(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name, key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	default:
+		return cert.PublicKeyAlgorithm.String(), 0
+	}
+}
+
+// SPKIFingerprint is the hex SHA-256 of the certificate's public key, the
+// value key pinning compares.
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+func NewTLSDetails(serverName string, chain []*x509.Certificate) *TLSDetails {
+	now := time.Now()
+	d := &TLSDetails{ServerName: serverName, Certificates: make([]TLSCertificate, 0, len(chain))}
+	for _, cert := range chain {
+		d.Certificates = append(d.Certificates, NewTLSCertificateFromX509(cert, now))
+	}
+	return d
+}
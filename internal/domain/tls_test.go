@@ -0,0 +1,83 @@
+package domain_test
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azargarov/rsvpck/internal/domain"
+)
+
+func TestCheckCertExpiry(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	probe := func(leafDays, rootDays int) domain.Probe {
+		p := domain.Probe{Status: domain.StatusPass}
+		p.TLS = &domain.TLSDetails{Certificates: []domain.TLSCertificate{
+			{Subject: "CN=leaf", NotAfter: now.Add(time.Duration(leafDays)*24*time.Hour + time.Hour)},
+			{Subject: "CN=root", NotAfter: now.Add(time.Duration(rootDays)*24*time.Hour + time.Hour)},
+		}}
+		return p
+	}
+
+	cases := []struct {
+		name             string
+		leaf, root       int
+		opts             domain.TLSOptions
+		want             domain.Status
+		wantErrSubstring string
+	}{
+		{"far off", 90, 3650, domain.TLSOptions{}, domain.StatusPass, ""},
+		{"leaf inside the warn window", 20, 3650, domain.TLSOptions{}, domain.StatusWarning, "CN=leaf expires in 20 days"},
+		{"root past critical", 90, 3, domain.TLSOptions{}, domain.StatusFail, "CN=root expires in 3 days"},
+		{"custom thresholds", 50, 3650, domain.TLSOptions{ExpiryWarnDays: 60, ExpiryCriticalDays: 14}, domain.StatusWarning, "expires in 50 days"},
+		{"checks off", 3, 3650, domain.TLSOptions{ExpiryWarnDays: -1, ExpiryCriticalDays: -1}, domain.StatusPass, ""},
+	}
+	for _, tc := range cases {
+		p := probe(tc.leaf, tc.root)
+		p.CheckCertExpiry(tc.opts, now)
+		if p.Status != tc.want || !strings.Contains(p.Error, tc.wantErrSubstring) {
+			t.Errorf("%s: got %v (%s), want %v with %q", tc.name, p.Status, p.Error, tc.want, tc.wantErrSubstring)
+		}
+	}
+
+	failed := domain.Probe{Status: domain.StatusCertInvalid, Error: "unknown authority"}
+	failed.TLS = probe(1, 1).TLS
+	failed.CheckCertExpiry(domain.TLSOptions{}, now)
+	if failed.Status != domain.StatusCertInvalid || failed.Error != "unknown authority" {
+		t.Fatalf("a failed probe keeps its own error, got %v (%s)", failed.Status, failed.Error)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for in, want := range map[string]uint16{"1.0": tls.VersionTLS10, "TLS1.2": tls.VersionTLS12, "tls 1.3": tls.VersionTLS13} {
+		if got, err := domain.ParseTLSVersion(in); err != nil || got != want {
+			t.Errorf("ParseTLSVersion(%q) = %x, %v; want %x", in, got, err, want)
+		}
+	}
+	if _, err := domain.ParseTLSVersion("SSLv3"); err == nil {
+		t.Error("want SSLv3 rejected")
+	}
+}
+
+func TestCheckTLSRequirements(t *testing.T) {
+	probe := func(version uint16, alpn string) domain.Probe {
+		p := domain.Probe{Status: domain.StatusPass}
+		p.TLS = &domain.TLSDetails{Version: version, ALPN: alpn}
+		return p
+	}
+	required := domain.TLSOptions{MinVersion: tls.VersionTLS12, ALPN: "h2"}
+
+	p := probe(tls.VersionTLS13, "h2")
+	if p.CheckTLSRequirements(required); !p.IsSuccessful() {
+		t.Fatalf("want TLS 1.3 with h2 to pass, got %v (%s)", p.Status, p.Error)
+	}
+	p = probe(tls.VersionTLS11, "h2")
+	if p.CheckTLSRequirements(required); p.Status != domain.StatusFail || !strings.Contains(p.Error, "TLS 1.1, below the required TLS 1.2") {
+		t.Fatalf("want the downgrade failed, got %v (%s)", p.Status, p.Error)
+	}
+	p = probe(tls.VersionTLS13, "")
+	if p.CheckTLSRequirements(required); p.Status != domain.StatusFail || !strings.Contains(p.Error, "ALPN none, want h2") {
+		t.Fatalf("want the missing h2 failed, got %v (%s)", p.Status, p.Error)
+	}
+}
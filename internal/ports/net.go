@@ -9,17 +9,33 @@ import (
 
 type TCPPort interface {
 	CheckWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
+	CheckViaProxyWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe
+	CheckTLSWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe
+	CheckInterceptionWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
 }
 
 type DNSPort interface {
 	CheckWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
+	CheckDoHWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe
+	CheckDoTWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
 }
 
 type HTTPPort interface {
 	CheckWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
 	CheckViaProxyWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe
+	CheckCaptivePortalWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
+	CheckThroughputWithContext(ctx context.Context, ep domain.Endpoint, proxyURL string) domain.Probe
+	CheckBandwidthWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
 }
 
 type ICMPPort interface {
 	CheckPingWithContext(ctx context.Context, ep domain.Endpoint) domain.Probe
 }
+
+type PACPort interface {
+	FindProxyWithContext(ctx context.Context, src domain.PACSource, target string) ([]domain.ProxyRoute, error)
+}
+
+type SystemProxyPort interface {
+	ProxyForURL(target string) (string, error)
+}
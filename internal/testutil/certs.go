@@ -0,0 +1,175 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// validity is how long test certificates last, well clear of the expiry
+// warnings.
+const validity = 365 * 24 * time.Hour
+
+// CA is a throwaway certificate authority for tests.
+type CA struct {
+	Cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func NewCA(t *testing.T, name string) *CA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"Test Corp"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CA %s: %v", name, err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &CA{Cert: cert, key: key}
+}
+
+// Issue signs a certificate for name: a server certificate valid for name,
+// localhost and 127.0.0.1, or with client set a client certificate. The chain
+// includes the CA.
+func (ca *CA) Issue(t *testing.T, name string, client bool) tls.Certificate {
+	t.Helper()
+	cert, err := ca.issue(name, client, time.Now().Add(-time.Hour), time.Now().Add(validity))
+	if err != nil {
+		t.Fatalf("issue %s: %v", name, err)
+	}
+	return cert
+}
+
+// IssueBetween signs a server certificate for name valid from notBefore to
+// notAfter, such as one already expired.
+func (ca *CA) IssueBetween(t *testing.T, name string, notBefore, notAfter time.Time) tls.Certificate {
+	t.Helper()
+	cert, err := ca.issue(name, false, notBefore, notAfter)
+	if err != nil {
+		t.Fatalf("issue %s: %v", name, err)
+	}
+	return cert
+}
+
+// Intermediate is a CA signed by ca; what it issues chains to it alone.
+func (ca *CA) Intermediate(t *testing.T, name string) *CA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"Test Corp"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("intermediate %s: %v", name, err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &CA{Cert: cert, key: key}
+}
+
+func (ca *CA) issue(name string, client bool, notBefore, notAfter time.Time) (tls.Certificate, error) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	} else {
+		tmpl.DNSNames = []string{name, "localhost"}
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der, ca.Cert.Raw}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// WriteCertPEM writes the certificates to a PEM file in a temporary directory.
+func WriteCertPEM(t *testing.T, name string, certs ...*x509.Certificate) string {
+	t.Helper()
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return writeTemp(t, name, data)
+}
+
+// WriteKeyPairPEM writes the leaf and its key to PEM files.
+func WriteKeyPairPEM(t *testing.T, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certFile = WriteCertPEM(t, "client.pem", cert.Leaf)
+	keyFile = writeTemp(t, "client-key.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// OCSPResponse is a response signed by ca for leaf, with status ocsp.Good,
+// ocsp.Revoked or ocsp.Unknown, to staple to a server certificate.
+func (ca *CA) OCSPResponse(t *testing.T, leaf *x509.Certificate, status int) []byte {
+	t.Helper()
+	tmpl := ocsp.Response{
+		Status:       status,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}
+	if status == ocsp.Revoked {
+		tmpl.RevokedAt = time.Now().Add(-time.Hour)
+	}
+	der, err := ocsp.CreateResponse(ca.Cert, ca.Cert, tmpl, ca.key)
+	if err != nil {
+		t.Fatalf("OCSP response: %v", err)
+	}
+	return der
+}
@@ -0,0 +1,92 @@
+package testutil
+
+import (
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// NewConnectProxy starts a plain http:// forward proxy: CONNECT requests are
+// tunnelled, absolute-URI requests are forwarded.
+func NewConnectProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(forward))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// NewTLSConnectProxy is NewConnectProxy behind TLS, for https:// proxy URLs.
+// It also returns a PEM file with the proxy's certificate, to trust it by.
+func NewTLSConnectProxy(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(forward))
+	// clients that do not trust the proxy are part of the tests
+	proxy.Config.ErrorLog = log.New(io.Discard, "", 0)
+	proxy.StartTLS()
+	t.Cleanup(proxy.Close)
+
+	caFile := filepath.Join(t.TempDir(), "proxy-ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw})
+	if err := os.WriteFile(caFile, block, 0o600); err != nil {
+		t.Fatalf("write proxy CA: %v", err)
+	}
+	return proxy, caFile
+}
+
+// NewPolicyProxy is NewConnectProxy answering a request with the status
+// policy returns for it instead, unless that is 0. A 407 carries a Basic
+// challenge.
+func NewPolicyProxy(t *testing.T, policy func(r *http.Request) int) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := policy(r)
+		if code == 0 {
+			forward(w, r)
+			return
+		}
+		if code == http.StatusProxyAuthRequired {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="corp"`)
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func forward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	_, _ = io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go func() { _, _ = io.Copy(upstream, client); upstream.Close() }()
+	_, _ = io.Copy(client, upstream)
+	client.Close()
+}
@@ -0,0 +1,61 @@
+package testutil
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// DigestRealm is the realm NewDigestProxy challenges with.
+const DigestRealm = "corp"
+
+const (
+	digestNonce  = "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	digestOpaque = "5ccc069c403ebaf9f0171e9517f40e41"
+)
+
+// NewDigestProxy is NewConnectProxy accepting only Digest (MD5, qop=auth)
+// credentials for user and password. Its 407s also offer NTLM, which
+// clients are expected to skip.
+func NewDigestProxy(t *testing.T, user, password string) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !digestValid(r, user, password) {
+			w.Header().Add("Proxy-Authenticate", "NTLM")
+			w.Header().Add("Proxy-Authenticate", `Digest realm="`+DigestRealm+`", qop="auth,auth-int", nonce="`+digestNonce+`", opaque="`+digestOpaque+`"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		forward(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func digestValid(r *http.Request, user, password string) bool {
+	authz, ok := strings.CutPrefix(r.Header.Get("Proxy-Authorization"), "Digest ")
+	if !ok {
+		return false
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(authz, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+	uri := r.RequestURI
+	if r.Method == http.MethodConnect {
+		uri = r.Host
+	}
+	h := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := h(user + ":" + DigestRealm + ":" + password)
+	ha2 := h(r.Method + ":" + params["uri"])
+	want := h(ha1 + ":" + digestNonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+	return params["username"] == user && params["uri"] == uri && params["qop"] == "auth" &&
+		params["opaque"] == digestOpaque && params["response"] == want
+}
@@ -0,0 +1,48 @@
+package testutil
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// InspectionCAName is the issuer of the certificates NewInspectingProxy forges.
+const InspectionCAName = "Test Inspection CA"
+
+// NewInspectingProxy starts an http:// proxy that answers CONNECT itself,
+// terminating TLS with a certificate for the requested host signed by its
+// own CA, as SSL-inspecting corporate proxies do.
+func NewInspectingProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	ca := NewCA(t, InspectionCAName)
+	forge := func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := ca.issue(hello.ServerName, false, time.Now().Add(-time.Hour), time.Now().Add(validity))
+		return &cert, err
+	}
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		_, _ = io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+		serveInspected(tls.Server(client, &tls.Config{GetCertificate: forge}))
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// serveInspected finishes the handshake and drains the client until it hangs up.
+func serveInspected(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = io.Copy(io.Discard, conn)
+}
@@ -0,0 +1,177 @@
+// Package testutil holds in-process servers shared by adapter tests.
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// SOCKS5Server is a minimal SOCKS5 proxy (RFC 1928) supporting CONNECT and,
+// if User is set, username/password authentication (RFC 1929).
+type SOCKS5Server struct {
+	Addr string
+
+	// User and Password are required when User is not empty.
+	User, Password string
+	// Block lists host:port targets refused with "not allowed by ruleset".
+	Block map[string]bool
+
+	mu       sync.Mutex
+	requests []string // targets as received: a name for socks5h, an IP for socks5
+}
+
+// NewSOCKS5Server starts a proxy on 127.0.0.1 that stops with the test.
+func NewSOCKS5Server(t *testing.T, user, password string) *SOCKS5Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("socks5: listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &SOCKS5Server{Addr: ln.Addr().String(), User: user, Password: password, Block: map[string]bool{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// URL returns the proxy URL for scheme ("socks5" or "socks5h"), with the
+// server's credentials.
+func (s *SOCKS5Server) URL(scheme string) string {
+	if s.User == "" {
+		return scheme + "://" + s.Addr
+	}
+	return fmt.Sprintf("%s://%s:%s@%s", scheme, s.User, s.Password, s.Addr)
+}
+
+// Requests returns the CONNECT targets seen so far.
+func (s *SOCKS5Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *SOCKS5Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(conn, hdr[:]); err != nil || hdr[0] != 5 {
+		return
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	want := byte(0x00)
+	if s.User != "" {
+		want = 0x02
+	}
+	if !contains(methods, want) {
+		_, _ = conn.Write([]byte{5, 0xff})
+		return
+	}
+	_, _ = conn.Write([]byte{5, want})
+	if want == 0x02 && !s.authenticate(conn) {
+		return
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil || req[1] != 0x01 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 0x01, 0x04:
+		ip := make([]byte, 4)
+		if req[3] == 0x04 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 0x03:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	var portBuf [2]byte
+	if _, err := io.ReadFull(conn, portBuf[:]); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(portBuf[0])<<8|int(portBuf[1])))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, target)
+	s.mu.Unlock()
+
+	reply := func(code byte) {
+		_, _ = conn.Write([]byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0})
+	}
+	if s.Block[target] {
+		reply(0x02)
+		return
+	}
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		reply(0x05)
+		return
+	}
+	defer upstream.Close()
+	reply(0x00)
+
+	go func() { _, _ = io.Copy(upstream, conn); _ = upstream.Close() }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func (s *SOCKS5Server) authenticate(conn net.Conn) bool {
+	read := func() (string, bool) {
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", false
+		}
+		b := make([]byte, n[0])
+		_, err := io.ReadFull(conn, b)
+		return string(b), err == nil
+	}
+	var ver [1]byte
+	if _, err := io.ReadFull(conn, ver[:]); err != nil {
+		return false
+	}
+	user, ok1 := read()
+	pass, ok2 := read()
+	if !ok1 || !ok2 || user != s.User || pass != s.Password {
+		_, _ = conn.Write([]byte{1, 1})
+		return false
+	}
+	_, _ = conn.Write([]byte{1, 0})
+	return true
+}
+
+func contains(b []byte, v byte) bool {
+	for _, x := range b {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}